@@ -0,0 +1,66 @@
+// Command import loads reservations and owner blocks from a CSV file, like the admin import page.
+//
+//	go run ./cmd/import -dry-run reservations.csv
+//
+// See importer.Columns for the columns of the file. Nothing is imported unless every line is valid.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com.br/Leodf/bookings/internal/config"
+	"github.com.br/Leodf/bookings/internal/driver"
+	"github.com.br/Leodf/bookings/internal/importer"
+	"github.com.br/Leodf/bookings/internal/repository/dbrepo"
+)
+
+func main() {
+	dsn := flag.String("dsn", "host=localhost port=5432 dbname=bookings user=admin password=123", "database connection string")
+	dryRun := flag.Bool("dry-run", false, "only check the file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: import [-dry-run] [-dsn dsn] file.csv\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	db, err := driver.ConnectSQL(*dsn)
+	if err != nil {
+		log.Fatal("Cannot connect database! Dying...")
+	}
+	defer db.SQL.Close()
+
+	var app config.AppConfig
+	repo := dbrepo.NewPostgresRepo(db.SQL, &app)
+
+	report, err := importer.Run(repo, f, *dryRun)
+	for _, e := range report.Errors {
+		fmt.Println(e)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case report.Imported:
+		fmt.Printf("Imported %d reservations and %d blocks\n", report.Reservations, report.Blocks)
+	case report.Valid():
+		fmt.Printf("The file is valid, %d reservations and %d blocks can be imported\n", report.Reservations, report.Blocks)
+	default:
+		fmt.Printf("Nothing imported, %d lines have errors\n", len(report.Errors))
+		os.Exit(1)
+	}
+}
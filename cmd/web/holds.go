@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/repository"
+)
+
+// holdSweepInterval is how often the expired checkout holds are released
+const holdSweepInterval = time.Minute
+
+// unpaidReservationTimeout is how long a reservation can wait for its payment after the guest was sent
+// to checkout, before it is cancelled and its room given back
+const unpaidReservationTimeout = time.Hour
+
+// sweepHolds releases the expired checkout holds in the background. The availability queries
+// already ignore them, this keeps them from piling up. It also cancels the online reservations
+// whose checkout was declined or abandoned, which would otherwise keep their room forever.
+func sweepHolds(db repository.DatabaseRepo) {
+	go func() {
+		ticker := time.NewTicker(holdSweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			n, err := db.DeleteExpiredHolds()
+			if err != nil {
+				errorLog.Println(err)
+			} else if n > 0 {
+				infoLog.Printf("Released %d expired holds", n)
+			}
+
+			n, err = db.CancelUnpaidReservations(time.Now().Add(-unpaidReservationTimeout))
+			if err != nil {
+				errorLog.Println(err)
+			} else if n > 0 {
+				infoLog.Printf("Cancelled %d unpaid reservations", n)
+			}
+		}
+	}()
+}
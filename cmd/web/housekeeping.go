@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/repository"
+)
+
+// housekeepingInterval is how often the stays ending today are checked for rooms to clean
+const housekeepingInterval = time.Hour
+
+// generateHousekeepingTasks opens the cleaning of the rooms of the stays that ended in the background,
+// catching up on the days the server was down, the guests checked out at the desk having theirs
+// opened right away
+func generateHousekeepingTasks(db repository.DatabaseRepo) {
+	generate := func() {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		n, err := db.GenerateHousekeepingTasks(today)
+		if err != nil {
+			errorLog.Println(err)
+			return
+		}
+		if n > 0 {
+			infoLog.Printf("Opened %d housekeeping tasks", n)
+		}
+	}
+
+	go func() {
+		generate()
+
+		ticker := time.NewTicker(housekeepingInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			generate()
+		}
+	}()
+}
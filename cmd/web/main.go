@@ -15,6 +15,7 @@ import (
 	"github.com.br/Leodf/bookings/internal/handler"
 	"github.com.br/Leodf/bookings/internal/helpers"
 	"github.com.br/Leodf/bookings/internal/model"
+	"github.com.br/Leodf/bookings/internal/payment"
 	"github.com.br/Leodf/bookings/internal/render"
 )
 
@@ -37,6 +38,12 @@ func main() {
 	fmt.Println("Starting mail listener...")
 	listenForMail()
 
+	fmt.Println("Starting hold sweeper...")
+	sweepHolds(handler.Repo.DB)
+
+	fmt.Println("Starting housekeeping scheduler...")
+	generateHousekeepingTasks(handler.Repo.DB)
+
 	fmt.Printf("Starting application on port %s", portNumber)
 
 	srv := &http.Server{
@@ -62,6 +69,10 @@ func run() (*driver.DB, error) {
 
 	// change this to true when in production
 	app.InProduction = false
+	app.BaseURL = "http://localhost" + portNumber
+
+	// the in process provider takes no real money, plug a real one in for production
+	app.Payments = payment.NewFake("development-webhook-secret")
 
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -97,6 +108,12 @@ func run() (*driver.DB, error) {
 
 	repo := handler.NewRepo(&app, db)
 	handler.NewHandlers(repo)
+
+	// guests can show prices in the currencies the admins set an exchange rate for
+	err = repo.LoadExchangeRates()
+	if err != nil {
+		return nil, err
+	}
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
 
@@ -17,6 +17,8 @@ func NoSurf(next http.Handler) http.Handler {
 		Secure:   app.InProduction,
 		SameSite: http.SameSiteLaxMode,
 	})
+	// the payment provider signs its webhook requests instead
+	csrfHandler.ExemptPath("/payments/webhook")
 	return csrfHandler
 }
 
@@ -35,3 +37,15 @@ func Auth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// GuestAuth only lets logged in guests through
+func GuestAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !helpers.IsGuestAuthenticated(r) {
+			session.Put(r.Context(), "error", "Log in to see your bookings")
+			http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -26,32 +26,98 @@ func routes(_ *config.AppConfig) http.Handler {
 	mux.Post("/search-availability-json", handler.Repo.AvailabilityJSON)
 	mux.Get("/choose-room/{id}", handler.Repo.ChooseRoom)
 	mux.Get("/book-room", handler.Repo.BookRoom)
+	mux.Get("/rooms/{id}/availability.json", handler.Repo.RoomAvailabilityJSON)
+
+	mux.Get("/waitlist", handler.Repo.Waitlist)
+	mux.Post("/waitlist", handler.Repo.PostWaitlist)
+	mux.Get("/waitlist/{token}", handler.Repo.WaitlistBook)
 
 	mux.Get("/contact", handler.Repo.Contact)
+	mux.Post("/currency", handler.Repo.PostCurrency)
 
 	mux.Get("/make-reservation", handler.Repo.Reservation)
 	mux.Post("/make-reservation", handler.Repo.PostReservation)
+	mux.Get("/checkout", handler.Repo.Checkout)
+	mux.Post("/checkout", handler.Repo.PostCheckout)
 	mux.Get("/reservation-summary", handler.Repo.ReservationSummary)
+	mux.Get("/reservation-summary/invoice", handler.Repo.ReservationInvoice)
+	mux.Post("/payments/webhook", handler.Repo.PaymentWebhook)
 
 	mux.Get("/user/login", handler.Repo.ShowLogin)
 	mux.Post("/user/login", handler.Repo.PostShowLogin)
 	mux.Post("/user/logout", handler.Repo.Logout)
 
+	mux.Get("/guest/register", handler.Repo.GuestRegister)
+	mux.Post("/guest/register", handler.Repo.PostGuestRegister)
+	mux.Get("/guest/confirm/{token}", handler.Repo.GuestConfirm)
+	mux.Post("/guest/confirm/{token}", handler.Repo.PostGuestConfirm)
+	mux.Get("/guest/login", handler.Repo.GuestLogin)
+	mux.Post("/guest/login", handler.Repo.PostGuestLogin)
+	mux.Post("/guest/logout", handler.Repo.GuestLogout)
+
+	mux.Route("/guest", func(mux chi.Router) {
+		mux.Use(GuestAuth)
+		mux.Get("/bookings", handler.Repo.GuestBookings)
+		mux.Post("/bookings/{id}/cancel", handler.Repo.GuestCancelReservation)
+	})
+
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	mux.Route("/admin", func(mux chi.Router) {
 		// mux.Use(Auth)
 		mux.Get("/dashboard", handler.Repo.AdminDashboard)
+		mux.Get("/reports/occupancy.json", handler.Repo.AdminReportOccupancyJSON)
+		mux.Get("/reports/revenue.json", handler.Repo.AdminReportRevenueJSON)
+		mux.Get("/front-desk", handler.Repo.AdminFrontDesk)
+		mux.Get("/front-desk.json", handler.Repo.AdminFrontDeskJSON)
+		mux.Get("/housekeeping", handler.Repo.AdminHousekeeping)
+		mux.Post("/housekeeping/rooms/{id}", handler.Repo.AdminPostHousekeeping)
 
 		mux.Get("/reservations-new", handler.Repo.AdminNewReservations)
 		mux.Get("/reservations-all", handler.Repo.AdminAllReservations)
+		mux.Get("/reservations-export/{src}", handler.Repo.AdminExportReservations)
+		mux.Get("/import", handler.Repo.AdminImport)
+		mux.Post("/import", handler.Repo.AdminPostImport)
 		mux.Get("/reservations-calendar", handler.Repo.AdminReservationsCalendar)
+		mux.Post("/reservations-calendar", handler.Repo.AdminPostReservationsCalendar)
 		mux.Get("/process-reservation/{src}/{id}", handler.Repo.AdminProcessReservation)
-		mux.Get("/delete-reservation/{src}/{id}", handler.Repo.AdminDeleteReservation)
+		mux.Get("/reservations-trash", handler.Repo.AdminTrashReservations)
+		mux.Get("/reservations-create", handler.Repo.AdminCreateReservation)
+		mux.Post("/reservations-create", handler.Repo.AdminPostCreateReservation)
+		mux.Post("/delete-reservation/{src}/{id}", handler.Repo.AdminDeleteReservation)
+		mux.Post("/restore-reservation/{src}/{id}", handler.Repo.AdminRestoreReservation)
+		mux.Post("/purge-reservation/{id}", handler.Repo.AdminPurgeReservation)
+		mux.Post("/reservation-status/{src}/{id}", handler.Repo.AdminUpdateReservationStatus)
+		mux.Post("/capture-payment/{src}/{id}", handler.Repo.AdminCapturePayment)
+		mux.Post("/refund-payment/{src}/{id}", handler.Repo.AdminRefundPayment)
 
 		mux.Get("/reservations/{src}/{id}", handler.Repo.AdminShowReservation)
+		mux.Get("/reservations/{src}/{id}/invoice", handler.Repo.AdminReservationInvoice)
 		mux.Post("/reservations/{src}/{id}", handler.Repo.AdminPostShowReservation)
+		mux.Post("/reservations/{src}/{id}/messages", handler.Repo.AdminPostReservationMessage)
+
+		mux.Get("/guests", handler.Repo.AdminGuests)
+		mux.Get("/guests/{id}", handler.Repo.AdminShowGuest)
+		mux.Post("/guests/{id}", handler.Repo.AdminPostShowGuest)
+
+		mux.Get("/stay-rules", handler.Repo.AdminStayRules)
+		mux.Post("/stay-rules", handler.Repo.AdminPostStayRule)
+		mux.Post("/stay-rules/{id}/delete", handler.Repo.AdminDeleteStayRule)
+
+		mux.Get("/promotions", handler.Repo.AdminPromotions)
+		mux.Post("/promotions", handler.Repo.AdminPostPromotion)
+		mux.Post("/promotions/{id}/delete", handler.Repo.AdminDeletePromotion)
+
+		mux.Get("/taxes", handler.Repo.AdminTaxRules)
+		mux.Post("/taxes", handler.Repo.AdminPostTaxRule)
+		mux.Post("/taxes/{id}/delete", handler.Repo.AdminDeleteTaxRule)
+
+		mux.Get("/currencies", handler.Repo.AdminCurrencies)
+		mux.Post("/currencies", handler.Repo.AdminPostCurrency)
+		mux.Post("/currencies/{id}/delete", handler.Repo.AdminDeleteCurrency)
+
+		mux.Get("/audit", handler.Repo.AdminAuditLog)
 	})
 
 	return mux
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com.br/Leodf/bookings/internal/config"
@@ -17,4 +19,12 @@ func TestRoutes(t *testing.T) {
 	default:
 		t.Errorf("type is not *chi.Mux, type is %T", v)
 	}
+
+	// logging out has to come from a form carrying the CSRF token
+	_ = chi.Walk(mux.(chi.Routes), func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if strings.HasSuffix(route, "/logout") && method != http.MethodPost {
+			t.Errorf("%s %s: logout should only be routed for POST", method, route)
+		}
+		return nil
+	})
 }
@@ -47,6 +47,9 @@ func sendMsg(m model.MailData) {
 		msgToSend := strings.Replace(mailTemplate, "[%body%]", m.Content, 1)
 		email.SetBody(mail.TextHTML, msgToSend)
 	}
+	for _, a := range m.Attachments {
+		email.Attach(&mail.File{Name: a.Name, MimeType: a.MimeType, Data: a.Data})
+	}
 
 	err = email.Send(client)
 	if err != nil {
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionProcess = "process"
+	ActionStatus  = "status"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+	ActionImport  = "import"
+)
+
+// Entities recorded in the audit log
+const (
+	EntityReservation = "reservation"
+	EntityBlock       = "block"
+	EntityUser        = "user"
+	EntityGuest       = "guest"
+	EntityStayRule    = "stay_rule"
+	EntityPayment     = "payment"
+	EntityPromotion   = "promotion"
+	EntityTaxRule     = "tax_rule"
+	EntityCurrency    = "exchange_rate"
+	EntityRoom        = "room"
+)
+
+// Actions returns all the audited actions
+func Actions() []string {
+	return []string{ActionCreate, ActionUpdate, ActionProcess, ActionStatus, ActionDelete, ActionRestore, ActionPurge, ActionImport}
+}
+
+// Entities returns all the audited entities
+func Entities() []string {
+	return []string{EntityReservation, EntityBlock, EntityUser, EntityGuest, EntityStayRule, EntityPayment, EntityPromotion, EntityTaxRule, EntityCurrency, EntityRoom}
+}
+
+// Diff returns the fields that differ between before and after, keyed by their JSON name.
+// Either side may be nil, for entities that were created or removed.
+func Diff(before, after any) (map[string]model.AuditChange, error) {
+	b, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]model.AuditChange)
+	for k, v := range b {
+		if !reflect.DeepEqual(v, a[k]) {
+			changes[k] = model.AuditChange{Before: v, After: a[k]}
+		}
+	}
+	for k, v := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = model.AuditChange{Before: nil, After: v}
+		}
+	}
+	return changes, nil
+}
+
+// toMap flattens v to a map of its JSON fields
+func toMap(v any) (map[string]any, error) {
+	m := make(map[string]any)
+	if v == nil {
+		return m, nil
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(out, &m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
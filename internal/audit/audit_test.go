@@ -0,0 +1,62 @@
+package audit
+
+import "testing"
+
+type testEntity struct {
+	Name  string
+	Email string
+	Count int
+}
+
+func TestDiff(t *testing.T) {
+	before := testEntity{Name: "John", Email: "john@here.com", Count: 1}
+	after := testEntity{Name: "John", Email: "john@there.com", Count: 2}
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Errorf("expected 2 changes, got %d", len(changes))
+	}
+	if _, ok := changes["Name"]; ok {
+		t.Error("unchanged field reported as changed")
+	}
+	if c := changes["Email"]; c.Before != "john@here.com" || c.After != "john@there.com" {
+		t.Errorf("wrong change for Email: %v", c)
+	}
+}
+
+func TestDiffNilSides(t *testing.T) {
+	entity := testEntity{Name: "John"}
+
+	changes, err := Diff(nil, entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Errorf("expected every field on create, got %d", len(changes))
+	}
+	if changes["Name"].Before != nil {
+		t.Error("created field should have no before value")
+	}
+
+	changes, err = Diff(entity, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes["Name"].After != nil || changes["Name"].Before != "John" {
+		t.Errorf("wrong change for removed entity: %v", changes["Name"])
+	}
+}
+
+func TestDiffNoChanges(t *testing.T) {
+	entity := testEntity{Name: "John"}
+	changes, err := Diff(entity, entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %d", len(changes))
+	}
+}
@@ -0,0 +1,86 @@
+package availability
+
+import (
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+// Window is a stay of the requested length moved Offset days from the requested dates
+type Window struct {
+	Room      model.Room
+	StartDate time.Time
+	EndDate   time.Time
+	Offset    int
+}
+
+// Nights returns the number of nights of the window
+func (w Window) Nights() int {
+	return int(w.EndDate.Sub(w.StartDate).Hours() / 24)
+}
+
+// SearchRange returns the dates to load restrictions for when looking flexDays around a stay
+func SearchRange(start, end time.Time, flexDays int) (time.Time, time.Time) {
+	return start.AddDate(0, 0, -flexDays), end.AddDate(0, 0, flexDays)
+}
+
+// Closest finds the window of the same length as start to end, moved by at most flexDays,
+// that overlaps none of busy and is accepted by allowed. Later dates are preferred on a tie
+// and windows arriving before earliest are skipped. The requested dates themselves aren't tried.
+func Closest(start, end time.Time, flexDays int, busy []model.RoomRestrictions, earliest time.Time, allowed func(start, end time.Time) bool) (Window, bool) {
+	for d := 1; d <= flexDays; d++ {
+		for _, offset := range []int{d, -d} {
+			s := start.AddDate(0, 0, offset)
+			e := end.AddDate(0, 0, offset)
+			if s.Before(earliest) {
+				continue
+			}
+			if overlaps(s, e, busy) {
+				continue
+			}
+			if allowed != nil && !allowed(s, e) {
+				continue
+			}
+			return Window{StartDate: s, EndDate: e, Offset: offset}, true
+		}
+	}
+	return Window{}, false
+}
+
+// overlaps returns true if the stay from start to end shares a night with any of busy
+func overlaps(start, end time.Time, busy []model.RoomRestrictions) bool {
+	for _, b := range busy {
+		if start.Before(b.EndDate) && end.After(b.StartDate) {
+			return true
+		}
+	}
+	return false
+}
+
+// Day is the availability of a room for the night starting on Date
+type Day struct {
+	Date      time.Time
+	Available bool
+}
+
+// Month returns the availability of each night of month given the room's busy restrictions.
+// Nights before today are never available.
+func Month(year int, month time.Month, busy []model.RoomRestrictions, today time.Time) []Day {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+
+	var days []Day
+	for d := first; d.Month() == month; d = d.AddDate(0, 0, 1) {
+		days = append(days, Day{
+			Date:      d,
+			Available: !d.Before(today) && !overlaps(d, d.AddDate(0, 0, 1), busy),
+		})
+	}
+	return days
+}
+
+// MonthRange returns the first day of month and the first day of the month after
+func MonthRange(year int, month time.Month) (time.Time, time.Time) {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return first, first.AddDate(0, 1, 0)
+}
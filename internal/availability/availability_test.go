@@ -0,0 +1,88 @@
+package availability
+
+import (
+	"testing"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func before(t time.Time) func(s, e time.Time) bool {
+	return func(s, e time.Time) bool { return s.Before(t) }
+}
+
+func TestClosest(t *testing.T) {
+	start := date("2050-03-10")
+	end := date("2050-03-12")
+	earliest := date("2050-01-01")
+
+	// the room is taken from the 9th to the 13th
+	busy := []model.RoomRestrictions{
+		{StartDate: date("2050-03-09"), EndDate: date("2050-03-13")},
+	}
+
+	var tests = []struct {
+		name           string
+		flex           int
+		busy           []model.RoomRestrictions
+		earliest       time.Time
+		allowed        func(s, e time.Time) bool
+		expectedFound  bool
+		expectedOffset int
+	}{
+		{"free the next day", 3, nil, earliest, nil, true, 1},
+		{"not enough flexibility", 2, busy, earliest, nil, false, 0},
+		{"free after the busy stay", 3, busy, earliest, nil, true, 3},
+		{"earlier window when later ones aren't allowed", 3, busy, earliest, before(start), true, -3},
+		{"earlier window before the earliest date", 3, busy, date("2050-03-08"), before(start), false, 0},
+	}
+
+	for _, e := range tests {
+		w, found := Closest(start, end, e.flex, e.busy, e.earliest, e.allowed)
+		if found != e.expectedFound {
+			t.Errorf("%s: expected found %t, got %t", e.name, e.expectedFound, found)
+			continue
+		}
+		if found && w.Offset != e.expectedOffset {
+			t.Errorf("%s: expected offset %d, got %d", e.name, e.expectedOffset, w.Offset)
+		}
+		if found && w.Nights() != 2 {
+			t.Errorf("%s: expected a 2 night window, got %d", e.name, w.Nights())
+		}
+	}
+}
+
+func TestMonth(t *testing.T) {
+	busy := []model.RoomRestrictions{
+		{StartDate: date("2050-02-27"), EndDate: date("2050-03-02")},
+		{StartDate: date("2050-03-10"), EndDate: date("2050-03-11")},
+	}
+
+	days := Month(2050, time.March, busy, date("2050-03-05"))
+	if len(days) != 31 {
+		t.Fatalf("expected 31 days in March, got %d", len(days))
+	}
+
+	var tests = []struct {
+		day      int
+		expected bool
+	}{
+		{1, false},  // busy, and before today
+		{5, true},   // today
+		{4, false},  // in the past
+		{10, false}, // one night block
+		{11, true},  // the block ended
+		{31, true},
+	}
+
+	for _, e := range tests {
+		if got := days[e.day-1].Available; got != e.expected {
+			t.Errorf("March %d: expected available %t, got %t", e.day, e.expected, got)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"html/template"
 	"log"
 
+	"github.com.br/Leodf/bookings/internal/currency"
 	"github.com.br/Leodf/bookings/internal/model"
+	"github.com.br/Leodf/bookings/internal/payment"
 	"github.com/alexedwards/scs/v2"
 )
 
@@ -17,4 +19,10 @@ type AppConfig struct {
 	InProduction  bool
 	Session       *scs.SessionManager
 	MailChan      chan model.MailData
+	// BaseURL is where the site is reached, for the links in emails
+	BaseURL string
+	// Payments takes the payments for reservations
+	Payments payment.Provider
+	// Currencies holds the exchange rates guests can show prices with
+	Currencies *currency.Table
 }
@@ -0,0 +1,64 @@
+package currency
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+// NormalizeCode returns code the way currencies are stored, like EUR
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Convert returns cents of the base currency in cents of the currency rate is for, rounded to the cent
+func Convert(cents int64, rate model.ExchangeRate) int64 {
+	return int64(math.Round(float64(cents) * rate.Rate))
+}
+
+// Table holds the exchange rates in memory so pages can show prices without a database round trip.
+// It is safe for concurrent use.
+type Table struct {
+	mu    sync.RWMutex
+	rates map[string]model.ExchangeRate
+}
+
+// NewTable returns an empty table
+func NewTable() *Table {
+	return &Table{rates: make(map[string]model.ExchangeRate)}
+}
+
+// Set replaces the rates in the table
+func (t *Table) Set(rates []model.ExchangeRate) {
+	m := make(map[string]model.ExchangeRate, len(rates))
+	for _, r := range rates {
+		m[NormalizeCode(r.Currency)] = r
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rates = m
+}
+
+// Get returns the rate for code, if there is one
+func (t *Table) Get(code string) (model.ExchangeRate, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	r, ok := t.rates[NormalizeCode(code)]
+	return r, ok
+}
+
+// Codes returns the currencies in the table, sorted
+func (t *Table) Codes() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	codes := make([]string, 0, len(t.rates))
+	for code := range t.rates {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
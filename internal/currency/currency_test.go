@@ -0,0 +1,56 @@
+package currency
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+func TestConvert(t *testing.T) {
+	var tests = []struct {
+		name     string
+		cents    int64
+		rate     float64
+		expected int64
+	}{
+		{"same value", 15000, 1, 15000},
+		{"weaker currency", 15000, 5.1234, 76851},
+		{"rounds to the cent", 999, 0.925, 924},
+		{"nothing", 0, 0.92, 0},
+	}
+
+	for _, e := range tests {
+		got := Convert(e.cents, model.ExchangeRate{Rate: e.rate})
+		if got != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	table := NewTable()
+	if len(table.Codes()) != 0 {
+		t.Error("expected an empty table")
+	}
+
+	table.Set([]model.ExchangeRate{
+		{Currency: "gbp", Rate: 0.79},
+		{Currency: "EUR", Rate: 0.92},
+	})
+
+	if codes := table.Codes(); !reflect.DeepEqual(codes, []string{"EUR", "GBP"}) {
+		t.Errorf("expected EUR and GBP, got %v", codes)
+	}
+	if r, ok := table.Get(" gbp "); !ok || r.Rate != 0.79 {
+		t.Errorf("expected the GBP rate, got %v %v", r, ok)
+	}
+	if _, ok := table.Get("BRL"); ok {
+		t.Error("found a rate that isn't in the table")
+	}
+
+	table.Set(nil)
+	if _, ok := table.Get("EUR"); ok {
+		t.Error("expected Set to replace the rates")
+	}
+}
@@ -0,0 +1,120 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+// Formats a table can be exported in
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Money is an amount in cents, exported as a decimal number
+type Money int64
+
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign, m = "-", -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+// Writer writes a table one row at a time, so exports don't have to hold it in memory.
+// Cells can be strings, ints, Money or dates as time.Time.
+type Writer interface {
+	Write(row []any) error
+	// Close writes what is left of the file, it doesn't close the underlying writer
+	Close() error
+}
+
+// NewWriter returns a writer for format, which must be FormatCSV or FormatXLSX. Spreadsheets
+// call their sheet name.
+func NewWriter(w io.Writer, format, name string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSV(w), nil
+	case FormatXLSX:
+		return NewXLSX(w, name)
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// ContentType returns the MIME type of format
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// ReservationHeader is the first row of a reservations export
+var ReservationHeader = []any{
+	"ID", "First Name", "Last Name", "Email", "Phone", "Room", "Arrival", "Departure", "Nights",
+	"Adults", "Children", "Status", "Source", "Promo Code", "Subtotal", "Discount", "Taxes", "Total",
+	"Cancellation Penalty", "Currency", "Booked",
+}
+
+// ReservationRow returns the row of res in a reservations export, with amounts in currency
+func ReservationRow(res model.Reservation, currency string) []any {
+	return []any{
+		res.ID, res.FirstName, res.LastName, res.Email, res.Phone, res.Room.RoomName, res.StartDate, res.EndDate, res.Nights(),
+		res.Adults, res.Children, model.StatusLabel(res.Status), model.SourceLabel(res.Source), res.PromoCode,
+		Money(res.Subtotal()), Money(res.Discount), Money(res.TaxTotal()), Money(res.Total()),
+		Money(res.CancellationPenalty), currency, res.CreatedAt,
+	}
+}
+
+// CSV writes the rows as comma separated values
+type CSV struct {
+	w *csv.Writer
+}
+
+// NewCSV returns a CSV writer to w
+func NewCSV(w io.Writer) *CSV {
+	return &CSV{w: csv.NewWriter(w)}
+}
+
+// Write writes a row
+func (c *CSV) Write(row []any) error {
+	record := make([]string, len(row))
+	for i, cell := range row {
+		record[i] = formatCell(cell)
+	}
+	return c.w.Write(record)
+}
+
+// Close flushes the rows still buffered
+func (c *CSV) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatCell returns cell as text
+func formatCell(cell any) string {
+	switch v := cell.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case Money:
+		return v.String()
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format("2006-01-02")
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(cell)
+}
@@ -0,0 +1,142 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+func TestMoney_String(t *testing.T) {
+	var tests = []struct {
+		cents    Money
+		expected string
+	}{
+		{15005, "150.05"},
+		{0, "0.00"},
+		{-250, "-2.50"},
+	}
+
+	for _, e := range tests {
+		if got := e.cents.String(); got != e.expected {
+			t.Errorf("%d: expected %s, got %s", e.cents, e.expected, got)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatCSV, "Reservations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arrival := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	_ = w.Write([]any{"Name", "Arrival", "Nights", "Total"})
+	_ = w.Write([]any{"Smith, John", arrival, 2, Money(31000)})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Name,Arrival,Nights,Total\n\"Smith, John\",2050-01-01,2,310.00\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatXLSX, "Reservations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := model.Reservation{
+		ID: 1, FirstName: "John", LastName: "<Smith> & Sons",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Room: model.Room{RoomName: "General's Quarters", NightlyRate: 15000}, Status: model.StatusConfirmed,
+	}
+	_ = w.Write(ReservationHeader)
+	_ = w.Write(ReservationRow(res, "USD"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(b)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		content, ok := parts[name]
+		if !ok {
+			t.Errorf("missing part %s", name)
+			continue
+		}
+		d := xml.NewDecoder(strings.NewReader(content))
+		for {
+			_, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("%s isn't well formed: %v", name, err)
+				break
+			}
+		}
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, s := range []string{
+		`<c r="A2"><v>1</v></c>`,
+		`&lt;Smith&gt; &amp; Sons`,
+		`<c r="G2" s="1"><v>54789</v></c>`,
+		`<c r="R2" s="2"><v>300.00</v></c>`,
+		`<row r="2">`,
+	} {
+		if !strings.Contains(sheet, s) {
+			t.Errorf("expected the sheet to contain %s", s)
+		}
+	}
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	if _, err := NewWriter(io.Discard, "pdf", "Reservations"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	var tests = []struct {
+		i        int
+		expected string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{51, "AZ"},
+		{702, "AAA"},
+	}
+
+	for _, e := range tests {
+		if got := columnName(e.i); got != e.expected {
+			t.Errorf("%d: expected %s, got %s", e.i, e.expected, got)
+		}
+	}
+}
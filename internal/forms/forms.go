@@ -62,3 +62,23 @@ func (f *Form) IsEmail(field string) {
 		f.Errors.Add(field, "invalid email address")
 	}
 }
+
+// IsCurrencyCode checks the field is a three letter currency code, like EUR
+func (f *Form) IsCurrencyCode(field string) bool {
+	x := strings.TrimSpace(f.Get(field))
+	if !govalidator.Matches(x, "^[A-Za-z]{3}$") {
+		f.Errors.Add(field, "invalid currency code")
+		return false
+	}
+	return true
+}
+
+// IsPromoCode checks the field looks like a promo code: 3 to 20 letters, digits or dashes
+func (f *Form) IsPromoCode(field string) bool {
+	x := strings.TrimSpace(f.Get(field))
+	if len(x) < 3 || len(x) > 20 || !govalidator.Matches(x, "^[A-Za-z0-9-]+$") {
+		f.Errors.Add(field, "invalid promo code")
+		return false
+	}
+	return true
+}
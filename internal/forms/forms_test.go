@@ -115,3 +115,55 @@ func TestFormIsEmail(t *testing.T) {
 		t.Error("form shows invalid when isEmail is satisfied")
 	}
 }
+
+func TestFormIsPromoCode(t *testing.T) {
+	var tests = []struct {
+		code  string
+		valid bool
+	}{
+		{"SUMMER-10", true},
+		{" summer10 ", true},
+		{"AB", false},
+		{"SUMMER 10", false},
+		{"THIS-CODE-IS-WAY-TOO-LONG", false},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("promo_code", e.code)
+		form := New(postedData)
+
+		if got := form.IsPromoCode("promo_code"); got != e.valid {
+			t.Errorf("%q: expected valid %t, got %t", e.code, e.valid, got)
+		}
+		if form.Valid() != e.valid {
+			t.Errorf("%q: form errors don't match the result", e.code)
+		}
+	}
+}
+
+func TestFormIsCurrencyCode(t *testing.T) {
+	var tests = []struct {
+		code  string
+		valid bool
+	}{
+		{"EUR", true},
+		{" gbp ", true},
+		{"EURO", false},
+		{"E1R", false},
+		{"", false},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("currency", e.code)
+		form := New(postedData)
+
+		if got := form.IsCurrencyCode("currency"); got != e.valid {
+			t.Errorf("%q: expected valid %t, got %t", e.code, e.valid, got)
+		}
+		if form.Valid() != e.valid {
+			t.Errorf("%q: form errors don't match the result", e.code)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package frontdesk
+
+import (
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+// Board holds the guests the front desk deals with on a day. Reservations are sorted into it with Add.
+type Board struct {
+	Date time.Time
+	// Arrivals are the stays starting on Date
+	Arrivals []model.Reservation
+	// Departures are the stays ending on Date
+	Departures []model.Reservation
+	// InHouse are the guests staying over the night of Date who arrived before it
+	InHouse []model.Reservation
+}
+
+// New returns an empty board of the day of date
+func New(date time.Time) *Board {
+	return &Board{Date: time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())}
+}
+
+// Add sorts a reservation into the board. Cancelled and no-show reservations, and the ones
+// not around on the day, are left out.
+func (b *Board) Add(res model.Reservation) {
+	if !model.HoldsRoom(res.Status) {
+		return
+	}
+
+	switch {
+	case sameDay(res.StartDate, b.Date):
+		b.Arrivals = append(b.Arrivals, res)
+	case sameDay(res.EndDate, b.Date):
+		b.Departures = append(b.Departures, res)
+	case res.StartDate.Before(b.Date) && res.EndDate.After(b.Date) && res.Status != model.StatusCheckedOut:
+		// a guest who checked out early is no longer in the house
+		b.InHouse = append(b.InHouse, res)
+	}
+}
+
+// sameDay returns true if a and b are on the same calendar day
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,52 @@
+package frontdesk
+
+import (
+	"testing"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestBoard(t *testing.T) {
+	b := New(time.Date(2050, 1, 10, 15, 30, 0, 0, time.UTC))
+
+	reservations := []model.Reservation{
+		{ID: 1, StartDate: date(2050, 1, 10), EndDate: date(2050, 1, 12), Status: model.StatusConfirmed},
+		{ID: 2, StartDate: date(2050, 1, 8), EndDate: date(2050, 1, 10), Status: model.StatusCheckedIn},
+		{ID: 3, StartDate: date(2050, 1, 9), EndDate: date(2050, 1, 11), Status: model.StatusCheckedIn},
+		// checked out early, no longer in the house
+		{ID: 4, StartDate: date(2050, 1, 5), EndDate: date(2050, 1, 15), Status: model.StatusCheckedOut},
+		{ID: 5, StartDate: date(2050, 1, 10), EndDate: date(2050, 1, 11), Status: model.StatusCancelled},
+		{ID: 6, StartDate: date(2050, 1, 10), EndDate: date(2050, 1, 11), Status: model.StatusNoShow},
+		// not around on the day
+		{ID: 7, StartDate: date(2050, 1, 11), EndDate: date(2050, 1, 12), Status: model.StatusConfirmed},
+	}
+	for _, res := range reservations {
+		b.Add(res)
+	}
+
+	ids := func(list []model.Reservation) []int {
+		var out []int
+		for _, res := range list {
+			out = append(out, res.ID)
+		}
+		return out
+	}
+
+	if got := ids(b.Arrivals); len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected arrival 1, got %v", got)
+	}
+	if got := ids(b.Departures); len(got) != 1 || got[0] != 2 {
+		t.Errorf("expected departure 2, got %v", got)
+	}
+	if got := ids(b.InHouse); len(got) != 1 || got[0] != 3 {
+		t.Errorf("expected in-house 3, got %v", got)
+	}
+	if !b.Date.Equal(date(2050, 1, 10)) {
+		t.Errorf("expected the board of 2050-01-10, got %s", b.Date)
+	}
+}
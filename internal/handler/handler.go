@@ -1,28 +1,61 @@
 package handler
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com.br/Leodf/bookings/internal/audit"
+	"github.com.br/Leodf/bookings/internal/availability"
 	"github.com.br/Leodf/bookings/internal/config"
+	"github.com.br/Leodf/bookings/internal/currency"
 	"github.com.br/Leodf/bookings/internal/driver"
+	"github.com.br/Leodf/bookings/internal/export"
 	"github.com.br/Leodf/bookings/internal/forms"
+	"github.com.br/Leodf/bookings/internal/frontdesk"
 	"github.com.br/Leodf/bookings/internal/helpers"
+	"github.com.br/Leodf/bookings/internal/importer"
+	"github.com.br/Leodf/bookings/internal/invoice"
 	"github.com.br/Leodf/bookings/internal/model"
+	"github.com.br/Leodf/bookings/internal/payment"
+	"github.com.br/Leodf/bookings/internal/promo"
 	"github.com.br/Leodf/bookings/internal/render"
+	"github.com.br/Leodf/bookings/internal/report"
 	"github.com.br/Leodf/bookings/internal/repository"
 	"github.com.br/Leodf/bookings/internal/repository/dbrepo"
+	"github.com.br/Leodf/bookings/internal/rules"
+	"github.com.br/Leodf/bookings/internal/tax"
 	"github.com/go-chi/chi/v5"
 )
 
 // Repo the repository used by the handlers
 var Repo *Repository
 
+// undoGracePeriod is how long the undo link is offered after deleting a reservation
+const undoGracePeriod = time.Minute
+
+// holdPeriod is how long a room is held for a guest while they complete their reservation
+const holdPeriod = 15 * time.Minute
+
+// waitlistOfferPeriod is how long the booking link sent to a waitlisted guest can be used
+const waitlistOfferPeriod = 24 * time.Hour
+
+// guestConfirmPeriod is how long the link sent to confirm a guest registration can be used
+const guestConfirmPeriod = 24 * time.Hour
+
 // Repository is the repository type
 type Repository struct {
 	App *config.AppConfig
@@ -77,21 +110,62 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res.Room.RoomName = room.RoomName
+	res.Room.MaxOccupancy = room.MaxOccupancy
+	res.Room.NightlyRate = room.NightlyRate
+
+	if res.Adults < 1 {
+		res.Adults = 1
+	}
+	if res.PartySize() > room.MaxOccupancy {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s sleeps at most %d people", room.RoomName, room.MaxOccupancy))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	// fill in the guest details from the profile of a logged in guest
+	if guestID := m.App.Session.GetInt(r.Context(), "guest_id"); guestID > 0 && res.Email == "" {
+		guest, err := m.DB.GetGuestByID(guestID)
+		if err == nil {
+			res.FirstName = guest.FirstName
+			res.LastName = guest.LastName
+			res.Email = guest.Email
+			res.Phone = guest.Phone
+		} else {
+			m.App.ErrorLog.Println(err)
+		}
+	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
-	sd := res.StartDate.Format("02/01/2006")
-	ed := res.EndDate.Format("02/01/2006")
+	m.renderMakeReservation(w, r, res, forms.New(nil))
+}
+
+// renderMakeReservation renders the guest details form for res, with the rate plans to choose from
+func (m *Repository) renderMakeReservation(w http.ResponseWriter, r *http.Request, res model.Reservation, form *forms.Form) {
+	plans, err := m.DB.AllRatePlans()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get rate plans!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	// offer the first plan unless the guest already picked one
+	if res.RatePlanID == 0 && len(plans) > 0 {
+		res.RatePlanID = plans[0].ID
+	}
 
 	stringMap := make(map[string]string)
-	stringMap["start_date"] = sd
-	stringMap["end_date"] = ed
+	stringMap["start_date"] = res.StartDate.Format("02/01/2006")
+	stringMap["end_date"] = res.EndDate.Format("02/01/2006")
+	if holdUntil := m.App.Session.GetInt64(r.Context(), "hold_until"); holdUntil > time.Now().Unix() {
+		stringMap["hold_until"] = time.Unix(holdUntil, 0).Format("15:04")
+	}
 
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["rate_plans"] = plans
 
 	render.Template(w, r, "make-reservation.page.tmpl", &model.TemplateData{
-		Form:      forms.New(nil),
+		Form:      form,
 		Data:      data,
 		StringMap: stringMap,
 	})
@@ -138,6 +212,9 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	res.StartDate = startDate
 	res.EndDate = endDate
 	res.RoomID = roomID
+	if r.Form.Has("adults") {
+		res.Adults, res.Children = partyFromForm(r.Form)
+	}
 
 	// reservation := model.Reservation{
 	// 	FirstName: r.Form.Get("first_name"),
@@ -154,71 +231,176 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	form.Required("first_name", "last_name", "email")
 	form.MinLength("first_name", 3)
 	form.IsEmail("email")
+	if res.Room.MaxOccupancy > 0 && res.PartySize() > res.Room.MaxOccupancy {
+		form.Errors.Add("adults", fmt.Sprintf("this room sleeps at most %d people", res.Room.MaxOccupancy))
+	}
+	if r.Form.Has("rate_plan_id") {
+		planID, _ := strconv.Atoi(r.Form.Get("rate_plan_id"))
+		plan, err := m.DB.GetRatePlanByID(planID)
+		if errors.Is(err, sql.ErrNoRows) {
+			form.Errors.Add("rate_plan_id", "choose one of the rates")
+		} else if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't get rate plan!")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		res.RatePlanID = plan.ID
+		res.RatePlan = plan
+	}
+
+	res.PromotionID, res.PromoCode, res.Discount = 0, "", 0
+	if form.Has("promo_code") && form.IsPromoCode("promo_code") {
+		reason, err := m.applyPromotion(&res, r.Form.Get("promo_code"))
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't get promotion!")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		if reason != "" {
+			form.Errors.Add("promo_code", reason)
+			res.PromoCode = r.Form.Get("promo_code")
+		}
+	}
 
 	if !form.Valid() {
 		m.App.Session.Put(r.Context(), "reservation", res)
-		data := make(map[string]interface{})
-		data["reservation"] = res
-		stringMap := map[string]string{
-			"start_date": res.StartDate.Format("02/01/2006"),
-			"end_date":   res.EndDate.Format("02/01/2006"),
-		}
-		render.Template(w, r, "make-reservation.page.tmpl", &model.TemplateData{
-			Form:      form,
-			Data:      data,
-			StringMap: stringMap,
-		})
+		m.renderMakeReservation(w, r, res, form)
+		return
+	}
+
+	// the dates come back from the form, so check them against the stay rules again
+	reasons, err := m.stayRuleReasons(res.RoomID, res.StartDate, res.EndDate)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get stay rules")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	if len(reasons) > 0 {
+		m.App.Session.Put(r.Context(), "error", "These dates can't be booked: "+strings.Join(reasons, "; "))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
-	newReservationID, err := m.DB.InsertReservation(res)
+
+	// guests flagged by staff can't book online
+	guest, err := m.DB.GetGuestByEmail(res.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "can't get guest from database!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	if guest.Blocked {
+		m.App.Session.Put(r.Context(), "error", "We can't accept this reservation online, please contact us.")
+		http.Redirect(w, r, "/contact", http.StatusSeeOther)
+		return
+	}
+	res.Guest = guest
+
+	err = m.applyTaxes(&res)
 	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get taxes!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	// the reservation is cancelled by the sweeper if the guest doesn't pay for it
+	res.CheckoutStartedAt = time.Now()
+
+	// the guest's hold makes way for the reservation, which still needs the room free of anyone else:
+	// the hold may have run out, or been taken for another stay than the one posted
+	newReservationID, err := m.DB.InsertReservationWithRestriction(res, m.App.Session.GetInt(r.Context(), "hold_id"))
+	if errors.Is(err, repository.ErrPromotionUsedUp) {
+		// someone else booked the last use of the code since it was checked
+		form.Errors.Add("promo_code", "this code has been used up")
+		res.PromotionID, res.Discount = 0, 0
+		m.App.Session.Put(r.Context(), "reservation", res)
+		m.renderMakeReservation(w, r, res, form)
+		return
+	} else if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.releaseHold(r)
+		m.App.Session.Put(r.Context(), "error", "Sorry, the room isn't available for these dates anymore, please search again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't insert reservation into database!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
+	// the hold went with the insert
+	m.App.Session.Remove(r.Context(), "hold_id")
+	m.App.Session.Remove(r.Context(), "hold_until")
+	m.useWaitlistLink(r)
+
 	res.Room.RoomName = r.Form.Get("room_name")
 
+	// the booking is confirmed once the payment is authorized at checkout
+	res.ID = newReservationID
 	m.App.Session.Put(r.Context(), "reservation", res)
+	http.Redirect(w, r, "/checkout", http.StatusSeeOther)
+}
 
-	restriction := model.RoomRestrictions{
-		StartDate:     res.StartDate,
-		EndDate:       res.EndDate,
-		RoomID:        res.RoomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
+// applyPromotion sets the discount of the promo code on res, returning the reason it can't be used if it can't
+func (m *Repository) applyPromotion(res *model.Reservation, code string) (string, error) {
+	p, err := m.DB.GetPromotionByCode(promo.NormalizeCode(code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "unknown promo code", nil
+	} else if err != nil {
+		return "", err
 	}
-	err = m.DB.InsertRoomRestriction(restriction)
+
+	uses, guestUses, err := m.DB.CountPromotionUses(p.ID, res.Email)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't insert room restriction!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+		return "", err
 	}
 
-	// send notification email to guest
-	htmlMessage := fmt.Sprintf(`
-		<strong>Reservation Confirmation</strong><br>
-		Dear %s:, <br>
-		This is confirm your reservation from %s to %s.
-	`, res.FirstName, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"))
+	if reason := promo.Check(p, res.RoomID, time.Now(), uses, guestUses); reason != "" {
+		return reason, nil
+	}
 
-	msg := model.MailData{
-		To:       res.Email,
-		From:     "me@here.com",
-		Subject:  "Reservation Confirmation",
-		Content:  htmlMessage,
-		Template: "base.html",
+	res.PromotionID = p.ID
+	res.PromoCode = p.Code
+	res.Discount = promo.Discount(p, res.Subtotal())
+	return "", nil
+}
+
+// applyTaxes works out the taxes and fees of res from the tax rules
+func (m *Repository) applyTaxes(res *model.Reservation) error {
+	taxRules, err := m.DB.AllTaxRules()
+	if err != nil {
+		return err
 	}
 
-	m.App.MailChan <- msg
+	res.Taxes = tax.Apply(taxRules, *res)
+	return nil
+}
 
-	// send notification to property owner
-	htmlMessage = fmt.Sprintf(`
+// repriceReservation works out the discount and the taxes of res again after its stay changed. The
+// promotion it was booked with still applies, with its amount taken off the new price. Once the
+// promotion has been deleted there is nothing to work it out from, so the discount stays as booked.
+func (m *Repository) repriceReservation(res *model.Reservation) error {
+	if res.PromotionID != 0 {
+		p, err := m.DB.GetPromotionByCode(res.PromoCode)
+		if err == nil {
+			res.Discount = promo.Discount(p, res.Subtotal())
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+
+	return m.applyTaxes(res)
+}
+
+// sendOwnerNotification emails the property owner about a new reservation
+func (m *Repository) sendOwnerNotification(res model.Reservation) {
+	htmlMessage := fmt.Sprintf(`
 		<strong>Reservation Confirmation</strong><br>
 		A reservation has been made for %s from %s to %s.
 	`, res.Room.RoomName, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"))
+	if res.Guest.VIP {
+		htmlMessage = fmt.Sprintf("<strong>VIP guest:</strong> %s %s<br>%s", res.FirstName, res.LastName, htmlMessage)
+	}
 
-	msg = model.MailData{
+	msg := model.MailData{
 		To:      "me@here.com",
 		From:    "me@here.com",
 		Subject: "Reservation Notification",
@@ -226,28 +408,55 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	m.App.MailChan <- msg
-
-	m.App.Session.Put(r.Context(), "reservation", res)
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
 }
 
-// Generals is the generals quarters page handler
-func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "generals.page.tmpl", &model.TemplateData{})
-}
+// Checkout shows the payment form for the reservation just made
+func (m *Repository) Checkout(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(model.Reservation)
+	if !ok || res.ID == 0 {
+		m.App.Session.Put(r.Context(), "error", "can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
 
-// Majors is the majors suite page handler
-func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "majors.page.tmpl", &model.TemplateData{})
+	room, err := m.DB.GetRoomByID(res.RoomID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't find room!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	res.Room.NightlyRate = room.NightlyRate
+
+	m.renderCheckout(w, r, res, forms.New(nil))
 }
 
-// Availability is the availability page handler
-func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "search-availability.page.tmpl", &model.TemplateData{})
+// renderCheckout renders the payment form for res
+func (m *Repository) renderCheckout(w http.ResponseWriter, r *http.Request, res model.Reservation, form *forms.Form) {
+	data := make(map[string]any)
+	data["reservation"] = res
+	data["total"] = res.Total()
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = res.StartDate.Format("02/01/2006")
+	stringMap["end_date"] = res.EndDate.Format("02/01/2006")
+	stringMap["currency"] = payment.Currency
+
+	render.Template(w, r, "checkout.page.tmpl", &model.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
 }
 
-// PostAvailability is the post form availability page handler
-func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
+// PostCheckout authorizes the payment for the reservation and confirms it
+func (m *Repository) PostCheckout(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(model.Reservation)
+	if !ok || res.ID == 0 {
+		m.App.Session.Put(r.Context(), "error", "can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
 	err := r.ParseForm()
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't parse form!")
@@ -255,199 +464,341 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sd := r.Form.Get("start")
-	ed := r.Form.Get("end")
-
-	layout := "02/01/2006"
-	startDate, err := time.Parse(layout, sd)
+	// a double submit or a replay must not take a second payment
+	current, err := m.DB.GetReservationByID(res.ID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse start date!")
+		m.App.Session.Put(r.Context(), "error", "can't get reservation from database!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
-	endDate, err := time.Parse(layout, ed)
+	if current.Status != model.StatusPending {
+		m.App.Session.Put(r.Context(), "error", "This reservation isn't waiting for a payment")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(res.RoomID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse end date!")
+		m.App.Session.Put(r.Context(), "error", "can't find room!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
+	res.Room.NightlyRate = room.NightlyRate
+
+	form := forms.New(r.PostForm)
+
+	// rooms without a rate are confirmed without taking a payment
+	if total := res.Total(); total > 0 {
+		form.Required("card_name", "card_number")
+		if !form.Valid() {
+			m.renderCheckout(w, r, res, form)
+			return
+		}
+
+		reference, err := m.App.Payments.Authorize(payment.Authorization{
+			Amount:      total,
+			Currency:    payment.Currency,
+			Source:      strings.ReplaceAll(r.Form.Get("card_number"), " ", ""),
+			Description: fmt.Sprintf("Reservation %d, %s", res.ID, res.Room.RoomName),
+		})
+		if errors.Is(err, payment.ErrDeclined) {
+			form.Errors.Add("card_number", "your card was declined")
+			m.renderCheckout(w, r, res, form)
+			return
+		} else if err != nil {
+			m.App.ErrorLog.Println(err)
+			m.App.Session.Put(r.Context(), "error", "can't take the payment, please try again")
+			http.Redirect(w, r, "/checkout", http.StatusSeeOther)
+			return
+		}
+
+		_, err = m.DB.InsertPayment(model.Payment{
+			ReservationID: res.ID,
+			Provider:      m.App.Payments.Name(),
+			Reference:     reference,
+			Amount:        total,
+			Currency:      payment.Currency,
+			Status:        payment.StatusAuthorized,
+		})
+		if err != nil {
+			m.App.ErrorLog.Printf("payment %s authorized but not saved: %v", reference, err)
+			m.App.Session.Put(r.Context(), "error", "can't save payment!")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	err = m.DB.UpdateReservationStatus(res.ID, model.StatusConfirmed, 0)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
+		m.App.Session.Put(r.Context(), "error", "can't confirm reservation!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
+	res.Status = model.StatusConfirmed
 
-	if len(rooms) == 0 {
-		m.App.Session.Put(r.Context(), "error", "All room's given date is no availability")
-		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+	// send notification email to guest
+	m.sendReservationConfirmation(res)
+
+	// send notification to property owner
+	m.sendOwnerNotification(res)
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
+
+// PaymentWebhook takes the payment updates sent by the payment provider
+func (m *Repository) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	event, err := m.App.Payments.VerifyWebhook(r)
+	if errors.Is(err, payment.ErrInvalidSignature) {
+		helpers.ClientError(w, http.StatusUnauthorized)
+		return
+	} else if err != nil || !payment.ValidStatus(event.Status) {
+		helpers.ClientError(w, http.StatusBadRequest)
 		return
 	}
 
-	data := make(map[string]interface{})
-	data["rooms"] = rooms
-
-	res := model.Reservation{
-		StartDate: startDate,
-		EndDate:   endDate,
+	err = m.DB.UpdatePaymentStatus(m.App.Payments.Name(), event.Reference, event.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
 	}
-	m.App.Session.Put(r.Context(), "reservation", res)
 
-	render.Template(w, r, "choose-room.page.tmpl", &model.TemplateData{
-		Data: data,
-	})
+	w.WriteHeader(http.StatusOK)
 }
 
-type jsonResponse struct {
-	Ok        bool   `json:"ok"`
-	Message   string `json:"message"`
-	RoomID    string `json:"room_id"`
-	StartDate string `json:"start_date"`
-	EndDate   string `json:"end_date"`
-}
+// sendReservationConfirmation emails the guest the confirmation of their reservation
+func (m *Repository) sendReservationConfirmation(res model.Reservation) {
+	htmlMessage := fmt.Sprintf(`
+		<strong>Reservation Confirmation</strong><br>
+		Dear %s:, <br>
+		This is confirm your reservation from %s to %s.<br>
+		%s
+		Cancellation policy: %s
+	`, res.FirstName, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"), priceBreakdown(res), cancellationPolicy(res))
 
-// AvailabilityJson handles requests for availability and send JSON response
-func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	msg := model.MailData{
+		To:       res.Email,
+		From:     "me@here.com",
+		Subject:  "Reservation Confirmation",
+		Content:  htmlMessage,
+		Template: "base.html",
+	}
+
+	// the confirmation goes out without the invoice rather than not at all
+	inv, err := m.invoiceFor(res.ID)
 	if err != nil {
-		resp := jsonResponse{
-			Ok:      false,
-			Message: "Internal server error",
+		m.App.ErrorLog.Println(err)
+	} else {
+		msg.Attachments = append(msg.Attachments, model.MailAttachment{
+			Name:     inv.Number + ".pdf",
+			MimeType: "application/pdf",
+			Data:     inv.PDF(),
+		})
+	}
+
+	m.App.MailChan <- msg
+}
+
+// priceBreakdown lists the price, discount, taxes and total of res for emails, empty for rooms without a rate
+func priceBreakdown(res model.Reservation) string {
+	if res.Subtotal() == 0 {
+		return ""
+	}
+
+	money := func(cents int64) string {
+		return render.FormatMoney(cents, payment.Currency)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d nights: %s<br>", res.Nights(), money(res.Subtotal()))
+	if res.Discount > 0 {
+		fmt.Fprintf(&b, "Discount: -%s<br>", money(res.Discount))
+	}
+	for _, t := range res.Taxes {
+		if t.Inclusive {
+			fmt.Fprintf(&b, "%s (included): %s<br>", html.EscapeString(t.Name), money(t.Amount))
+		} else {
+			fmt.Fprintf(&b, "%s: %s<br>", html.EscapeString(t.Name), money(t.Amount))
 		}
-		out, _ := json.MarshalIndent(resp, "", "		")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
-		return
 	}
+	fmt.Fprintf(&b, "<strong>Total: %s</strong><br>", money(res.Total()))
 
-	sd := r.Form.Get("start")
-	ed := r.Form.Get("end")
+	return b.String()
+}
 
-	layout := "02/01/2006"
-	startDate, err := time.Parse(layout, sd)
+// invoiceFor returns the invoice of a reservation as it stands in the database
+func (m *Repository) invoiceFor(reservationID int) (invoice.Invoice, error) {
+	res, err := m.DB.GetReservationByID(reservationID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse start date!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+		return invoice.Invoice{}, err
 	}
-	endDate, err := time.Parse(layout, ed)
+
+	payments, err := m.DB.GetPaymentsForReservation(reservationID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse end date!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+		return invoice.Invoice{}, err
 	}
-	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
+
+	return invoice.New(res, payments, time.Now()), nil
+}
+
+// writeInvoice sends the invoice of a reservation as a PDF download
+func writeInvoice(w http.ResponseWriter, inv invoice.Invoice) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, inv.Number))
+	w.Write(inv.PDF())
+}
+
+// cancellationPolicy describes the cancellation policy of the rate plan res was booked on
+func cancellationPolicy(res model.Reservation) string {
+	if res.RatePlan.Name == "" {
+		return res.RatePlan.Policy()
+	}
+	return fmt.Sprintf("%s: %s", res.RatePlan.Name, res.RatePlan.Policy())
+}
+
+// cancelReservation cancels res together with the penalty it owes for a cancellation made now, settles
+// its payments so only the penalty is kept, and lets the guest know what they are charged and refunded.
+// It returns the penalty and the refund in cents.
+func (m *Repository) cancelReservation(res model.Reservation, userID int) (int64, int64, error) {
+	// no money moves for a reservation that can't be cancelled
+	if !model.CanTransition(res.Status, model.StatusCancelled) {
+		return 0, 0, model.ErrInvalidTransition
+	}
+
+	penalty := res.RatePlan.Penalty(res.Total(), res.StartDate, time.Now())
+
+	payments, err := m.DB.GetPaymentsForReservation(res.ID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "invalid ID!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+		return 0, 0, err
 	}
 
-	available, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+	settled, refund, err := settleCancellation(m.App.Payments, payments, penalty)
 	if err != nil {
-		// got a database error, so return appropriate json
-		resp := jsonResponse{
-			Ok:      false,
-			Message: "Error querying database",
-		}
-
-		out, _ := json.MarshalIndent(resp, "", "     ")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
-		return
-	}
-	resp := jsonResponse{
-		Ok:        available,
-		Message:   "",
-		StartDate: sd,
-		EndDate:   ed,
-		RoomID:    strconv.Itoa(roomID),
+		// what the provider refused is left for staff to capture or refund from the reservation
+		m.App.ErrorLog.Printf("reservation %d: %v", res.ID, err)
 	}
 
-	// remove the error check, since wue handle all aspects of the json right here
-	out, _ := json.MarshalIndent(resp, "", "    ")
+	err = m.DB.CancelReservation(res.ID, userID, penalty, refund, settled)
+	if err != nil {
+		return 0, 0, err
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(out)
-}
+	charge := "There is no charge for the cancellation."
+	if penalty > 0 {
+		charge = fmt.Sprintf("%s is charged for the cancellation, as per the policy of your rate (%s).",
+			render.FormatMoney(penalty, payment.Currency), cancellationPolicy(res))
+	}
+	if refund > 0 {
+		charge += fmt.Sprintf("<br>%s of your payment is given back to your card.", render.FormatMoney(refund, payment.Currency))
+	}
 
-// Contact is the contact page handler
-func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "contact.page.tmpl", &model.TemplateData{})
-}
+	htmlMessage := fmt.Sprintf(`
+		<strong>Reservation Cancelled</strong><br>
+		Dear %s:, <br>
+		Your reservation from %s to %s has been cancelled.<br>
+		%s
+	`, res.FirstName, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"), charge)
 
-// ReservationSummary displays the reservation summary page
-func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
-	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(model.Reservation)
-	if !ok {
-		m.App.ErrorLog.Println("cannot get item from session")
-		m.App.Session.Put(r.Context(), "error", "can't get reservation from session")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+	if res.Email != "" {
+		m.App.MailChan <- model.MailData{
+			To:       res.Email,
+			From:     "me@here.com",
+			Subject:  "Reservation Cancelled",
+			Content:  htmlMessage,
+			Template: "base.html",
+		}
 	}
 
-	m.App.Session.Remove(r.Context(), "reservation")
+	return penalty, refund, nil
+}
 
-	data := make(map[string]interface{})
-	data["reservation"] = reservation
+// settleCancellation keeps penalty out of the payments of a cancelled reservation and gives the rest
+// back through provider: authorized payments have the penalty captured and the rest voided, captured
+// ones have the rest refunded. It returns the payments it settled, with their new status, and the
+// amount given back in cents. A payment the provider fails to settle is left out, with its error.
+func settleCancellation(provider payment.Provider, payments []model.Payment, penalty int64) ([]model.Payment, int64, error) {
+	var settled []model.Payment
+	var refund int64
+	var errs []error
 
-	sd := reservation.StartDate.Format("02/01/2006")
-	ed := reservation.EndDate.Format("02/01/2006")
-	stringMap := make(map[string]string)
-	stringMap["start_date"] = sd
-	stringMap["end_date"] = ed
+	for _, p := range payments {
+		if p.Provider != provider.Name() || (p.Status != payment.StatusAuthorized && p.Status != payment.StatusCaptured) {
+			continue
+		}
+		keep := min(penalty, p.Amount)
 
-	render.Template(w, r, "reservation-summary.page.tmpl", &model.TemplateData{
-		Data:      data,
-		StringMap: stringMap,
-	})
-}
+		switch p.Status {
+		case payment.StatusAuthorized:
+			if keep > 0 {
+				err := provider.Capture(p.Reference, keep)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("capture %s: %w", p.Reference, err))
+					continue
+				}
+				p.Status = payment.StatusCaptured
+			}
+			if keep < p.Amount {
+				err := provider.Void(p.Reference)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("void %s: %w", p.Reference, err))
+				} else {
+					refund += p.Amount - keep
+					if keep == 0 {
+						p.Status = payment.StatusVoided
+					}
+				}
+			}
+		case payment.StatusCaptured:
+			if keep < p.Amount {
+				err := provider.Refund(p.Reference, p.Amount-keep)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("refund %s: %w", p.Reference, err))
+					continue
+				}
+				refund += p.Amount - keep
+				p.Status = payment.StatusRefunded
+			}
+		}
 
-// ChooseRoom displays list of available rooms
-func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
-	// used to have next 6 lines
-	//roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
-	//if err != nil {
-	//	log.Println(err)
-	//	m.App.Session.Put(r.Context(), "error", "missing url parameter")
-	//	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-	//	return
-	//}
-	// changed to this, so we can test it more easily
-	// split the URL up by /, and grab the 3rd element
-	exploded := strings.Split(r.RequestURI, "/")
-	roomID, err := strconv.Atoi(exploded[2])
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "missing url parameter")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+		penalty -= keep
+		if p.Status != payment.StatusAuthorized {
+			settled = append(settled, p)
+		}
 	}
 
-	res, ok := m.App.Session.Get(r.Context(), "reservation").(model.Reservation)
-	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
-	}
-	res.RoomID = roomID
+	return settled, refund, errors.Join(errs...)
+}
 
-	m.App.Session.Put(r.Context(), "reservation", res)
+// Generals is the generals quarters page handler
+func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "generals.page.tmpl", &model.TemplateData{})
+}
 
-	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+// Majors is the majors suite page handler
+func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "majors.page.tmpl", &model.TemplateData{})
+}
 
+// Availability is the availability page handler
+func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "search-availability.page.tmpl", &model.TemplateData{})
 }
 
-// BookRoom takes URL parameters, builds a sessional variable and takes user to make res screen
-func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
-	roomID, err := strconv.Atoi(r.URL.Query().Get("id"))
+// PostAvailability is the post form availability page handler
+func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "invalid ID!")
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
+
+	sd := r.Form.Get("start")
+	ed := r.Form.Get("end")
 
 	layout := "02/01/2006"
 	startDate, err := time.Parse(layout, sd)
@@ -462,53 +813,779 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
-	var res model.Reservation
 
-	room, err := m.DB.GetRoomByID(roomID)
+	if err = rules.ValidateDates(startDate, endDate); err != nil {
+		m.App.Session.Put(r.Context(), "error", "The departure must be after the arrival")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	adults, children := partyFromForm(r.Form)
+
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate, adults+children)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't get room from db!")
+		m.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	res.Room.RoomName = room.RoomName
-	res.RoomID = roomID
-	res.StartDate = startDate
-	res.EndDate = endDate
+	flexDays := flexDaysFromForm(r.Form)
+
+	if len(rooms) == 0 {
+		if m.renderAlternatives(w, r, startDate, endDate, flexDays, adults, children) {
+			return
+		}
+		m.App.Session.Put(r.Context(), "error", "No rooms are available for your party on the given dates, you can join the waitlist")
+		http.Redirect(w, r, fmt.Sprintf("/waitlist?s=%s&e=%s", sd, ed), http.StatusSeeOther)
+		return
+	}
+
+	stayRules, err := m.DB.AllStayRules()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get stay rules")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	// keep the rooms whose stay rules allow the dates, remembering why the others were left out
+	var allowed []model.Room
+	var reasons []string
+	for _, room := range rooms {
+		roomReasons := rules.Check(stayRules, room.ID, startDate, endDate, time.Now())
+		if len(roomReasons) == 0 {
+			allowed = append(allowed, room)
+			continue
+		}
+		for _, reason := range roomReasons {
+			if !slices.Contains(reasons, reason) {
+				reasons = append(reasons, reason)
+			}
+		}
+	}
+	rooms = allowed
+
+	if len(rooms) == 0 {
+		if m.renderAlternatives(w, r, startDate, endDate, flexDays, adults, children) {
+			return
+		}
+		m.App.Session.Put(r.Context(), "error", "These dates can't be booked: "+strings.Join(reasons, "; "))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
 
+	res := model.Reservation{
+		StartDate: startDate,
+		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
+	}
 	m.App.Session.Put(r.Context(), "reservation", res)
 
-	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+	render.Template(w, r, "choose-room.page.tmpl", &model.TemplateData{
+		Data: data,
+	})
+}
+
+// renderAlternatives shows the guest the closest dates around the requested stay that can be booked,
+// returning false without rendering if there are none
+func (m *Repository) renderAlternatives(w http.ResponseWriter, r *http.Request, start, end time.Time, flexDays, adults, children int) bool {
+	if flexDays == 0 {
+		return false
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return false
+	}
+
+	windows, err := m.alternativeWindows(rooms, start, end, flexDays, adults+children)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return false
+	}
+	if len(windows) == 0 {
+		return false
+	}
+
+	data := make(map[string]any)
+	data["alternatives"] = windows
 
+	stringMap := map[string]string{
+		"start_date": start.Format("02/01/2006"),
+		"end_date":   end.Format("02/01/2006"),
+		"adults":     strconv.Itoa(adults),
+		"children":   strconv.Itoa(children),
+	}
+
+	render.Template(w, r, "choose-room.page.tmpl", &model.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+	return true
 }
 
-// ShowLogin is the login page handler
-func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "login.page.tmpl", &model.TemplateData{
-		Form: forms.New(nil),
+// alternativeWindows returns, closest first, the nearest bookable window within flexDays of the requested
+// dates for each of rooms that can hold the party
+func (m *Repository) alternativeWindows(rooms []model.Room, start, end time.Time, flexDays, partySize int) ([]availability.Window, error) {
+	stayRules, err := m.DB.AllStayRules()
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := availability.SearchRange(start, end, flexDays)
+	now := time.Now()
+	today := now.Truncate(24 * time.Hour)
+
+	var windows []availability.Window
+	for _, room := range rooms {
+		if room.MaxOccupancy < partySize {
+			continue
+		}
+
+		busy, err := m.DB.GetRestrictionsForRoomByDate(room.ID, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		window, ok := availability.Closest(start, end, flexDays, busy, today, func(s, e time.Time) bool {
+			return len(rules.Check(stayRules, room.ID, s, e, now)) == 0
+		})
+		if ok {
+			window.Room = room
+			windows = append(windows, window)
+		}
+	}
+
+	sort.SliceStable(windows, func(i, j int) bool {
+		return abs(windows[i].Offset) < abs(windows[j].Offset)
 	})
+
+	return windows, nil
 }
 
-// PostShowLogin handles logging in the user
-func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
-	_ = m.App.Session.RenewToken(r.Context())
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// maxFlexibleDays caps how many days around the requested dates a flexible search looks
+const maxFlexibleDays = 7
+
+// flexDaysFromForm reads how many days the guest's dates can move, 0 for an exact search
+func flexDaysFromForm(values url.Values) int {
+	flexDays, _ := strconv.Atoi(values.Get("flexible"))
+	if flexDays < 0 {
+		return 0
+	}
+	return min(flexDays, maxFlexibleDays)
+}
+
+// stayRuleReasons returns why a stay in roomID from start to end can't be booked, if it can't
+func (m *Repository) stayRuleReasons(roomID int, start, end time.Time) ([]string, error) {
+	stayRules, err := m.DB.AllStayRules()
+	if err != nil {
+		return nil, err
+	}
+	return rules.Check(stayRules, roomID, start, end, time.Now()), nil
+}
+
+// partyFromForm reads the number of adults and children from a form, defaulting to one adult
+func partyFromForm(values url.Values) (adults, children int) {
+	adults, _ = strconv.Atoi(values.Get("adults"))
+	children, _ = strconv.Atoi(values.Get("children"))
+	if adults < 1 {
+		adults = 1
+	}
+	if children < 0 {
+		children = 0
+	}
+	return adults, children
+}
+
+type jsonResponse struct {
+	Ok           bool         `json:"ok"`
+	Message      string       `json:"message"`
+	RoomID       string       `json:"room_id"`
+	StartDate    string       `json:"start_date"`
+	EndDate      string       `json:"end_date"`
+	Alternatives []jsonWindow `json:"alternatives,omitempty"`
+}
+
+// jsonWindow is an alternative stay offered when the requested dates can't be booked
+type jsonWindow struct {
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Offset    int    `json:"offset"`
+}
 
+// AvailabilityJson handles requests for availability and send JSON response
+func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		log.Println("err")
+		resp := jsonResponse{
+			Ok:      false,
+			Message: "Internal server error",
+		}
+		out, _ := json.MarshalIndent(resp, "", "		")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
 	}
-	email := r.Form.Get("email")
-	password := r.Form.Get("password")
-	form := forms.New(r.PostForm)
-	form.Required("email", "password")
-	form.IsEmail("email")
-	if !form.Valid() {
-		render.Template(w, r, "login.page.tmpl", &model.TemplateData{
-			Form: form,
-		})
+
+	sd := r.Form.Get("start")
+	ed := r.Form.Get("end")
+
+	layout := "02/01/2006"
+	startDate, err := time.Parse(layout, sd)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse start date!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
-	id, _, err := m.DB.Authenticate(email, password)
+	endDate, err := time.Parse(layout, ed)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse end date!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "invalid ID!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	reasons, err := m.stayRuleReasons(roomID, startDate, endDate)
+	if err != nil {
+		resp := jsonResponse{
+			Ok:      false,
+			Message: "Error querying database",
+		}
+
+		out, _ := json.MarshalIndent(resp, "", "     ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
+	available := false
+	var message string
+	if len(reasons) > 0 {
+		message = "These dates can't be booked: " + strings.Join(reasons, "; ")
+	} else {
+		available, err = m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+		if err != nil {
+			// got a database error, so return appropriate json
+			resp := jsonResponse{
+				Ok:      false,
+				Message: "Error querying database",
+			}
+
+			out, _ := json.MarshalIndent(resp, "", "     ")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(out)
+			return
+		}
+	}
+
+	resp := jsonResponse{
+		Ok:        available,
+		Message:   message,
+		StartDate: sd,
+		EndDate:   ed,
+		RoomID:    strconv.Itoa(roomID),
+	}
+
+	// offer the closest dates the room can be booked instead
+	if flexDays := flexDaysFromForm(r.Form); !available && flexDays > 0 {
+		room, err := m.DB.GetRoomByID(roomID)
+		if err == nil {
+			room.ID = roomID
+			adults, children := partyFromForm(r.Form)
+			var windows []availability.Window
+			windows, err = m.alternativeWindows([]model.Room{room}, startDate, endDate, flexDays, adults+children)
+			for _, window := range windows {
+				resp.Alternatives = append(resp.Alternatives, jsonWindow{
+					StartDate: window.StartDate.Format(layout),
+					EndDate:   window.EndDate.Format(layout),
+					Offset:    window.Offset,
+				})
+			}
+		}
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+	}
+
+	// remove the error check, since wue handle all aspects of the json right here
+	out, _ := json.MarshalIndent(resp, "", "    ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// monthAvailabilityResponse is the availability of a room for each night of a month.
+// It only says whether a night is free, never why it isn't.
+type monthAvailabilityResponse struct {
+	Ok          bool               `json:"ok"`
+	Message     string             `json:"message,omitempty"`
+	RoomID      int                `json:"room_id"`
+	Year        int                `json:"year"`
+	Month       int                `json:"month"`
+	Days        []jsonDayAvailable `json:"days"`
+	Unavailable []string           `json:"unavailable"`
+}
+
+type jsonDayAvailable struct {
+	Date      string `json:"date"`
+	Available bool   `json:"available"`
+}
+
+// RoomAvailabilityJSON sends the availability of a room for each night of the month in y and m,
+// the current month by default
+func (m *Repository) RoomAvailabilityJSON(w http.ResponseWriter, r *http.Request) {
+	resp := monthAvailabilityResponse{}
+
+	writeJSON := func(status int) {
+		out, _ := json.MarshalIndent(resp, "", "    ")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(out)
+	}
+
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		resp.Message = "invalid room"
+		writeJSON(http.StatusBadRequest)
+		return
+	}
+	resp.RoomID = roomID
+
+	now := time.Now()
+	year, month := now.Year(), now.Month()
+	if y, err := strconv.Atoi(r.URL.Query().Get("y")); err == nil {
+		year = y
+	}
+	if mo, err := strconv.Atoi(r.URL.Query().Get("m")); err == nil && mo >= 1 && mo <= 12 {
+		month = time.Month(mo)
+	}
+	resp.Year = year
+	resp.Month = int(month)
+
+	_, err = m.DB.GetRoomByID(roomID)
+	if err != nil {
+		resp.Message = "room not found"
+		writeJSON(http.StatusNotFound)
+		return
+	}
+
+	first, next := availability.MonthRange(year, month)
+	busy, err := m.DB.GetRestrictionsForRoomByDate(roomID, first, next)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		resp.Message = "Error querying database"
+		writeJSON(http.StatusInternalServerError)
+		return
+	}
+
+	resp.Ok = true
+	resp.Unavailable = []string{}
+	for _, day := range availability.Month(year, month, busy, now) {
+		resp.Days = append(resp.Days, jsonDayAvailable{
+			Date:      day.Date.Format("2006-01-02"),
+			Available: day.Available,
+		})
+		if !day.Available {
+			// in the date picker format, so it can disable the day as is
+			resp.Unavailable = append(resp.Unavailable, day.Date.Format("02/01/2006"))
+		}
+	}
+
+	writeJSON(http.StatusOK)
+}
+
+// Contact is the contact page handler
+func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "contact.page.tmpl", &model.TemplateData{})
+}
+
+// ReservationSummary displays the reservation summary page
+func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(model.Reservation)
+	if !ok {
+		m.App.ErrorLog.Println("cannot get item from session")
+		m.App.Session.Put(r.Context(), "error", "can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	m.App.Session.Remove(r.Context(), "reservation")
+	// the guest can still download the invoice once the reservation is out of the session
+	m.App.Session.Put(r.Context(), "invoice_id", reservation.ID)
+
+	data := make(map[string]interface{})
+	data["reservation"] = reservation
+
+	sd := reservation.StartDate.Format("02/01/2006")
+	ed := reservation.EndDate.Format("02/01/2006")
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = sd
+	stringMap["end_date"] = ed
+	stringMap["currency"] = payment.Currency
+
+	render.Template(w, r, "reservation-summary.page.tmpl", &model.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// ReservationInvoice downloads the invoice of the reservation the guest just made
+func (m *Repository) ReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	id := m.App.Session.GetInt(r.Context(), "invoice_id")
+	if id == 0 {
+		m.App.Session.Put(r.Context(), "error", "can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	inv, err := m.invoiceFor(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "can't get invoice!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	writeInvoice(w, inv)
+}
+
+// ChooseRoom displays list of available rooms
+func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
+	// used to have next 6 lines
+	//roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	//if err != nil {
+	//	log.Println(err)
+	//	m.App.Session.Put(r.Context(), "error", "missing url parameter")
+	//	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	//	return
+	//}
+	// changed to this, so we can test it more easily
+	// split the URL up by /, and grab the 3rd element
+	exploded := strings.Split(r.RequestURI, "/")
+	roomID, err := strconv.Atoi(exploded[2])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(model.Reservation)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	res.RoomID = roomID
+
+	if !m.holdRoom(w, r, res) {
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+
+}
+
+// BookRoom takes URL parameters, builds a sessional variable and takes user to make res screen
+func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "invalid ID!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	sd := r.URL.Query().Get("s")
+	ed := r.URL.Query().Get("e")
+
+	layout := "02/01/2006"
+	startDate, err := time.Parse(layout, sd)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse start date!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	endDate, err := time.Parse(layout, ed)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse end date!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	var res model.Reservation
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get room from db!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	reasons, err := m.stayRuleReasons(roomID, startDate, endDate)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get stay rules")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	if len(reasons) > 0 {
+		m.App.Session.Put(r.Context(), "error", "These dates can't be booked: "+strings.Join(reasons, "; "))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	res.Room.RoomName = room.RoomName
+	res.RoomID = roomID
+	res.StartDate = startDate
+	res.EndDate = endDate
+	res.Adults, res.Children = partyFromForm(r.URL.Query())
+
+	if !m.holdRoom(w, r, res) {
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+
+}
+
+// Waitlist shows the form to join the waitlist for a room, with the dates of the search filled in
+func (m *Repository) Waitlist(w http.ResponseWriter, r *http.Request) {
+	entry := model.WaitlistEntry{}
+
+	layout := "02/01/2006"
+	entry.StartDate, _ = time.Parse(layout, r.URL.Query().Get("s"))
+	entry.EndDate, _ = time.Parse(layout, r.URL.Query().Get("e"))
+	entry.RoomID, _ = strconv.Atoi(r.URL.Query().Get("id"))
+
+	if guestID := m.App.Session.GetInt(r.Context(), "guest_id"); guestID > 0 {
+		guest, err := m.DB.GetGuestByID(guestID)
+		if err == nil {
+			entry.Email = guest.Email
+		} else {
+			m.App.ErrorLog.Println(err)
+		}
+	}
+
+	m.renderWaitlist(w, r, entry, forms.New(nil))
+}
+
+// renderWaitlist renders the waitlist form, with entry filled in
+func (m *Repository) renderWaitlist(w http.ResponseWriter, r *http.Request, entry model.WaitlistEntry, form *forms.Form) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	if !entry.StartDate.IsZero() {
+		stringMap["start_date"] = entry.StartDate.Format("02/01/2006")
+	}
+	if !entry.EndDate.IsZero() {
+		stringMap["end_date"] = entry.EndDate.Format("02/01/2006")
+	}
+
+	data := make(map[string]any)
+	data["entry"] = entry
+	data["rooms"] = rooms
+
+	render.Template(w, r, "waitlist.page.tmpl", &model.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// PostWaitlist puts the guest on the waitlist for a room
+func (m *Repository) PostWaitlist(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("start", "end", "email")
+	form.IsEmail("email")
+
+	entry := model.WaitlistEntry{Email: r.Form.Get("email")}
+	entry.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+
+	layout := "02/01/2006"
+	if form.Has("start") {
+		entry.StartDate, err = time.Parse(layout, r.Form.Get("start"))
+		if err != nil {
+			form.Errors.Add("start", "invalid date")
+		}
+	}
+	if form.Has("end") {
+		entry.EndDate, err = time.Parse(layout, r.Form.Get("end"))
+		if err != nil {
+			form.Errors.Add("end", "invalid date")
+		}
+	}
+	if !entry.StartDate.IsZero() && !entry.EndDate.IsZero() && rules.ValidateDates(entry.StartDate, entry.EndDate) != nil {
+		form.Errors.Add("end", "the departure must be after the arrival")
+	}
+
+	if _, err := m.DB.GetRoomByID(entry.RoomID); err != nil {
+		form.Errors.Add("room_id", "choose a room")
+	}
+
+	if !form.Valid() {
+		m.renderWaitlist(w, r, entry, form)
+		return
+	}
+
+	_, err = m.DB.InsertWaitlistEntry(entry)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "You're on the waitlist, we'll email you if the room frees up")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// WaitlistBook follows the booking link sent to a waitlisted guest, taking them to the reservation form
+func (m *Repository) WaitlistBook(w http.ResponseWriter, r *http.Request) {
+	entry, err := m.DB.GetWaitlistEntryByToken(chi.URLParam(r, "token"))
+	if err != nil || !entry.OfferValid(time.Now()) {
+		m.App.Session.Put(r.Context(), "error", "This booking link has expired")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	// the link doesn't hold the room, someone else may have booked it first
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(entry.StartDate, entry.EndDate, entry.RoomID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get availability for room")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	if !available {
+		m.App.Session.Put(r.Context(), "error", "Sorry, the room has been booked again for those dates")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	res := model.Reservation{
+		RoomID:    entry.RoomID,
+		Room:      entry.Room,
+		StartDate: entry.StartDate,
+		EndDate:   entry.EndDate,
+		Email:     entry.Email,
+	}
+
+	if !m.holdRoom(w, r, res) {
+		return
+	}
+
+	// the link is used up once the guest books with it
+	m.App.Session.Put(r.Context(), "waitlist_id", entry.ID)
+	m.App.Session.Put(r.Context(), "reservation", res)
+
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
+
+// useWaitlistLink records that the waitlist link the guest came with, if any, has been used to book.
+// A failure is logged rather than failing the booking.
+func (m *Repository) useWaitlistLink(r *http.Request) {
+	id := m.App.Session.PopInt(r.Context(), "waitlist_id")
+	if id == 0 {
+		return
+	}
+
+	err := m.DB.UseWaitlistEntry(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// holdRoom holds the room of res for the guest while they complete the reservation, giving back the
+// room they held before if any. It redirects and returns false if the room can't be held.
+func (m *Repository) holdRoom(w http.ResponseWriter, r *http.Request, res model.Reservation) bool {
+	m.releaseHold(r)
+	// a waitlist link only books the stay it was sent for
+	m.App.Session.Remove(r.Context(), "waitlist_id")
+
+	holdID, expiresAt, err := m.DB.InsertHold(res.RoomID, res.StartDate, res.EndDate, holdPeriod)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "Someone else is booking this room for these dates, please try again in a few minutes")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return false
+	} else if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't hold room!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return false
+	}
+
+	m.App.Session.Put(r.Context(), "hold_id", holdID)
+	m.App.Session.Put(r.Context(), "hold_until", expiresAt.Unix())
+	return true
+}
+
+// releaseHold gives back the room held by the guest, if any. A failure is logged, the sweeper
+// releases the hold once it expires anyway.
+func (m *Repository) releaseHold(r *http.Request) {
+	holdID := m.App.Session.PopInt(r.Context(), "hold_id")
+	m.App.Session.Remove(r.Context(), "hold_until")
+	if holdID == 0 {
+		return
+	}
+
+	err := m.DB.ReleaseHold(holdID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// ShowLogin is the login page handler
+func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "login.page.tmpl", &model.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostShowLogin handles logging in the user
+func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
+	_ = m.App.Session.RenewToken(r.Context())
+
+	err := r.ParseForm()
+	if err != nil {
+		log.Println("err")
+	}
+	email := r.Form.Get("email")
+	password := r.Form.Get("password")
+	form := forms.New(r.PostForm)
+	form.Required("email", "password")
+	form.IsEmail("email")
+	if !form.Valid() {
+		render.Template(w, r, "login.page.tmpl", &model.TemplateData{
+			Form: form,
+		})
+		return
+	}
+	id, _, err := m.DB.Authenticate(email, password)
 	if err != nil {
 		log.Println(err)
 		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
@@ -516,26 +1593,2243 @@ func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "user_id", id)
-	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
-	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
+	m.App.Session.Put(r.Context(), "user_id", id)
+	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Logout logs out the user
+func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
+	_ = m.App.Session.Destroy(r.Context())
+	_ = m.App.Session.RenewToken(r.Context())
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// GuestRegister shows the guest registration page
+func (m *Repository) GuestRegister(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "guest-register.page.tmpl", &model.TemplateData{
+		Form: forms.New(nil),
+		Data: map[string]any{"guest": model.Guest{}},
+	})
+}
+
+// PostGuestRegister emails the guest a link to confirm their email and choose their password
+func (m *Repository) PostGuestRegister(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest := model.Guest{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+		Phone:     r.Form.Get("phone"),
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email")
+	form.IsEmail("email")
+
+	token, err := newToken()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	expiresAt := time.Now().Add(guestConfirmPeriod)
+
+	if form.Valid() {
+		// the bookings made with the email only become the guest's once they show it is theirs
+		err = m.DB.RegisterGuest(guest, token, expiresAt)
+		if errors.Is(err, repository.ErrGuestExists) {
+			form.Errors.Add("email", "there is already an account for this email, log in instead")
+		} else if err != nil {
+			m.App.ErrorLog.Println(err)
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		render.Template(w, r, "guest-register.page.tmpl", &model.TemplateData{
+			Form: form,
+			Data: map[string]any{"guest": guest},
+		})
+		return
+	}
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>Confirm your email</strong><br>
+		Dear %s:, <br>
+		<a href="%s/guest/confirm/%s">Choose your password</a> to finish creating your account, the link is valid until %s.<br>
+		If you didn't ask for an account, you can ignore this email.
+	`, guest.FirstName, m.App.BaseURL, token, expiresAt.Format("2006-01-02 15:04"))
+
+	m.App.MailChan <- model.MailData{
+		To:       guest.Email,
+		From:     "me@here.com",
+		Subject:  "Confirm your email",
+		Content:  htmlMessage,
+		Template: "base.html",
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "We sent you an email, follow the link in it to choose your password")
+	http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+}
+
+// GuestConfirm shows the page where a guest confirming their registration chooses their password
+func (m *Repository) GuestConfirm(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	guest, err := m.DB.GetGuestByConfirmToken(token)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This link is invalid or has expired, please register again")
+		http.Redirect(w, r, "/guest/register", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderGuestConfirm(w, r, guest, token, forms.New(nil))
+}
+
+// renderGuestConfirm renders the password form of the registration confirmed with token
+func (m *Repository) renderGuestConfirm(w http.ResponseWriter, r *http.Request, guest model.Guest, token string, form *forms.Form) {
+	render.Template(w, r, "guest-confirm.page.tmpl", &model.TemplateData{
+		Form:      form,
+		Data:      map[string]any{"guest": guest},
+		StringMap: map[string]string{"token": token},
+	})
+}
+
+// PostGuestConfirm creates the login of a guest who confirmed their email and logs them in
+func (m *Repository) PostGuestConfirm(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token := chi.URLParam(r, "token")
+
+	guest, err := m.DB.GetGuestByConfirmToken(token)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This link is invalid or has expired, please register again")
+		http.Redirect(w, r, "/guest/register", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("password")
+	form.MinLength("password", 8)
+	if r.Form.Get("password_confirm") != r.Form.Get("password") {
+		form.Errors.Add("password_confirm", "passwords don't match")
+	}
+	if !form.Valid() {
+		m.renderGuestConfirm(w, r, guest, token, form)
+		return
+	}
+
+	guest.ID, err = m.DB.ConfirmGuest(token, r.Form.Get("password"))
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This link is invalid or has expired, please register again")
+		http.Redirect(w, r, "/guest/register", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Put(r.Context(), "guest_id", guest.ID)
+	m.App.Session.Put(r.Context(), "flash", "Welcome! Your account is ready")
+	http.Redirect(w, r, "/guest/bookings", http.StatusSeeOther)
+}
+
+// GuestLogin shows the guest login page
+func (m *Repository) GuestLogin(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "guest-login.page.tmpl", &model.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostGuestLogin logs a guest in
+func (m *Repository) PostGuestLogin(w http.ResponseWriter, r *http.Request) {
+	_ = m.App.Session.RenewToken(r.Context())
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "password")
+	form.IsEmail("email")
+	if !form.Valid() {
+		render.Template(w, r, "guest-login.page.tmpl", &model.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	id, err := m.DB.AuthenticateGuest(r.Form.Get("email"), r.Form.Get("password"))
+	if err != nil {
+		log.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
+		http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "guest_id", id)
+	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+	http.Redirect(w, r, "/guest/bookings", http.StatusSeeOther)
+}
+
+// GuestLogout logs the guest out, keeping the rest of the session
+func (m *Repository) GuestLogout(w http.ResponseWriter, r *http.Request) {
+	m.App.Session.Remove(r.Context(), "guest_id")
+	_ = m.App.Session.RenewToken(r.Context())
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// GuestBookings shows the logged in guest their upcoming and past reservations
+func (m *Repository) GuestBookings(w http.ResponseWriter, r *http.Request) {
+	guestID := m.App.Session.GetInt(r.Context(), "guest_id")
+
+	guest, err := m.DB.GetGuestByID(guestID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	reservations, err := m.DB.GetReservationsForGuest(guestID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	today := time.Now().Truncate(24 * time.Hour)
+	var upcoming, past []model.Reservation
+	for _, res := range reservations {
+		if res.EndDate.Before(today) {
+			past = append(past, res)
+		} else {
+			// soonest first, the list comes latest first
+			upcoming = append([]model.Reservation{res}, upcoming...)
+		}
+	}
+
+	// what cancelling each upcoming stay would cost right now, for the stays that can still be cancelled
+	penalties := make(map[int]string)
+	for _, res := range upcoming {
+		if !model.CanTransition(res.Status, model.StatusCancelled) {
+			continue
+		}
+		penalties[res.ID] = "is free of charge"
+		if penalty := res.RatePlan.Penalty(res.Total(), res.StartDate, time.Now()); penalty > 0 {
+			penalties[res.ID] = "costs " + render.DisplayMoney(penalty, payment.Currency, render.DisplayCurrency(r))
+		}
+	}
+
+	data := make(map[string]any)
+	data["guest"] = guest
+	data["upcoming"] = upcoming
+	data["past"] = past
+	data["penalties"] = penalties
+
+	render.Template(w, r, "guest-bookings.page.tmpl", &model.TemplateData{
+		Data: data,
+	})
+}
+
+// GuestCancelReservation cancels a reservation of the logged in guest, charging the penalty of its rate plan
+func (m *Repository) GuestCancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	// guests only see their own reservations
+	if res.GuestID != m.App.Session.GetInt(r.Context(), "guest_id") {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	penalty, refund, err := m.cancelReservation(res, 0)
+	if errors.Is(err, model.ErrInvalidTransition) {
+		m.App.Session.Put(r.Context(), "error", "This reservation can no longer be cancelled, please contact us")
+		http.Redirect(w, r, "/guest/bookings", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	m.notifyWaitlist(res.RoomID)
+
+	flash := "Your reservation was cancelled"
+	if penalty > 0 {
+		flash += fmt.Sprintf(", %s is charged for the cancellation", render.FormatMoney(penalty, payment.Currency))
+	}
+	if refund > 0 {
+		flash += fmt.Sprintf(", %s is refunded", render.FormatMoney(refund, payment.Currency))
+	}
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/guest/bookings", http.StatusSeeOther)
+}
+
+// AdminDashboard is the admin dashboard page handler
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	from, to := reportRange(r.URL.Query())
+
+	rep, err := m.buildReport(from, to)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["report"] = rep
+
+	// the charts ask the JSON endpoints for the same dates
+	query := url.Values{"from": {from.Format("2006-01-02")}, "to": {to.Format("2006-01-02")}}.Encode()
+
+	render.Template(w, r, "admin-dashboard.page.tmpl", &model.TemplateData{
+		Data: data,
+		StringMap: map[string]string{
+			"from":           from.Format("2006-01-02"),
+			"to":             to.Format("2006-01-02"),
+			"currency":       payment.Currency,
+			"occupancy_json": "/admin/reports/occupancy.json?" + query,
+			"revenue_json":   "/admin/reports/revenue.json?" + query,
+		},
+	})
+}
+
+// maxReportMonths is the longest range a report covers
+const maxReportMonths = 60
+
+// reportRange reads the dates of a report from its query string, the last 12 months by default
+func reportRange(q url.Values) (time.Time, time.Time) {
+	now := time.Now()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from, to := thisMonth.AddDate(0, -11, 0), thisMonth.AddDate(0, 1, -1)
+
+	layout := "2006-01-02"
+	if x, err := time.Parse(layout, q.Get("from")); err == nil {
+		from = x
+	}
+	if x, err := time.Parse(layout, q.Get("to")); err == nil {
+		to = x
+	}
+	if to.Before(from) {
+		from, to = to, from
+	}
+	if limit := from.AddDate(0, maxReportMonths, -1); to.After(limit) {
+		to = limit
+	}
+	return from, to
+}
+
+// buildReport works out the occupancy and revenue report of the nights from from to to
+func (m *Repository) buildReport(from, to time.Time) (*report.Report, error) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		return nil, err
+	}
+
+	rep := report.New(rooms, from, to)
+	err = m.DB.EachReservation(model.ReservationFilter{From: from, To: to, During: true}, func(res model.Reservation) error {
+		rep.Add(res)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+// reportJSON sends what build makes of the report for the dates in the query string, or an error
+// the charts can show when the report can't be worked out
+func (m *Repository) reportJSON(w http.ResponseWriter, r *http.Request, build func(*report.Report) any) {
+	from, to := reportRange(r.URL.Query())
+
+	var resp any
+	status := http.StatusOK
+	rep, err := m.buildReport(from, to)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		resp = map[string]any{"ok": false, "message": "Error querying database"}
+		status = http.StatusInternalServerError
+	} else {
+		resp = build(rep)
+	}
+
+	out, _ := json.MarshalIndent(resp, "", "    ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// occupancyResponse is the occupancy percentage of each room, and of all of them, by month
+type occupancyResponse struct {
+	Ok     bool            `json:"ok"`
+	Months []string        `json:"months"`
+	Total  []float64       `json:"total"`
+	Rooms  []roomOccupancy `json:"rooms"`
+}
+
+type roomOccupancy struct {
+	RoomID    int       `json:"room_id"`
+	RoomName  string    `json:"room_name"`
+	Occupancy []float64 `json:"occupancy"`
+}
+
+// AdminReportOccupancyJSON sends the occupancy of the rooms by month for the dashboard charts
+func (m *Repository) AdminReportOccupancyJSON(w http.ResponseWriter, r *http.Request) {
+	m.reportJSON(w, r, func(rep *report.Report) any {
+		resp := occupancyResponse{Ok: true, Months: []string{}, Total: []float64{}, Rooms: []roomOccupancy{}}
+		for i, room := range rep.Rooms {
+			ro := roomOccupancy{RoomID: room.ID, RoomName: room.RoomName}
+			for _, month := range rep.Months {
+				ro.Occupancy = append(ro.Occupancy, month.RoomOccupancy(i))
+			}
+			resp.Rooms = append(resp.Rooms, ro)
+		}
+		for _, month := range rep.Months {
+			resp.Months = append(resp.Months, month.Start.Format("2006-01"))
+			resp.Total = append(resp.Total, month.Occupancy())
+		}
+		return resp
+	})
+}
+
+// revenueResponse is the revenue and average daily rate by month, in cents
+type revenueResponse struct {
+	Ok       bool     `json:"ok"`
+	Currency string   `json:"currency"`
+	Months   []string `json:"months"`
+	Revenue  []int64  `json:"revenue"`
+	ADR      []int64  `json:"adr"`
+}
+
+// AdminReportRevenueJSON sends the revenue by month for the dashboard charts
+func (m *Repository) AdminReportRevenueJSON(w http.ResponseWriter, r *http.Request) {
+	m.reportJSON(w, r, func(rep *report.Report) any {
+		resp := revenueResponse{Ok: true, Currency: payment.Currency, Months: []string{}, Revenue: []int64{}, ADR: []int64{}}
+		for _, month := range rep.Months {
+			resp.Months = append(resp.Months, month.Start.Format("2006-01"))
+			resp.Revenue = append(resp.Revenue, month.Revenue)
+			resp.ADR = append(resp.ADR, month.ADR())
+		}
+		return resp
+	})
+}
+
+// AdminFrontDesk shows the arrivals, departures and in-house guests of a day, today by default
+func (m *Repository) AdminFrontDesk(w http.ResponseWriter, r *http.Request) {
+	date := boardDate(r.URL.Query())
+
+	board, err := m.buildBoard(date)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	statuses, err := m.DB.RoomHousekeepingStatuses()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["board"] = board
+	data["room_statuses"] = statuses
+
+	layout := "2006-01-02"
+	render.Template(w, r, "admin-front-desk.page.tmpl", &model.TemplateData{
+		Data: data,
+		StringMap: map[string]string{
+			"date": date.Format(layout),
+			"prev": date.AddDate(0, 0, -1).Format(layout),
+			"next": date.AddDate(0, 0, 1).Format(layout),
+		},
+	})
+}
+
+// boardDate reads the day of the front desk board from its query string, today by default
+func boardDate(q url.Values) time.Time {
+	if date, err := time.Parse("2006-01-02", q.Get("date")); err == nil {
+		return date
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// frontDeskURL returns the front desk board of date, today's when date is not a date
+func frontDeskURL(date string) string {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "/admin/front-desk"
+	}
+	return "/admin/front-desk?date=" + date
+}
+
+// buildBoard sorts the reservations around date into its front desk board
+func (m *Repository) buildBoard(date time.Time) (*frontdesk.Board, error) {
+	board := frontdesk.New(date)
+	// the stays with a night on the day, and from the night before to take in the ones leaving on it
+	f := model.ReservationFilter{From: date.AddDate(0, 0, -1), To: date, During: true}
+	err := m.DB.EachReservation(f, func(res model.Reservation) error {
+		board.Add(res)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return board, nil
+}
+
+// frontDeskResponse is the front desk board of a day
+type frontDeskResponse struct {
+	Ok         bool         `json:"ok"`
+	Date       string       `json:"date"`
+	Arrivals   []boardEntry `json:"arrivals"`
+	Departures []boardEntry `json:"departures"`
+	InHouse    []boardEntry `json:"in_house"`
+}
+
+type boardEntry struct {
+	ID          int    `json:"id"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Email       string `json:"email"`
+	Phone       string `json:"phone"`
+	RoomID      int    `json:"room_id"`
+	RoomName    string `json:"room_name"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	Adults      int    `json:"adults"`
+	Children    int    `json:"children"`
+	Status      string `json:"status"`
+	RoomStatus  string `json:"room_status"`
+	CanCheckIn  bool   `json:"can_check_in"`
+	CanCheckOut bool   `json:"can_check_out"`
+}
+
+// boardEntries returns the board entries of reservations, with the housekeeping statuses of their
+// rooms, never nil so they are sent as empty lists
+func boardEntries(reservations []model.Reservation, statuses map[int]string) []boardEntry {
+	entries := []boardEntry{}
+	for _, res := range reservations {
+		entries = append(entries, boardEntry{
+			ID:          res.ID,
+			FirstName:   res.FirstName,
+			LastName:    res.LastName,
+			Email:       res.Email,
+			Phone:       res.Phone,
+			RoomID:      res.RoomID,
+			RoomName:    res.Room.RoomName,
+			StartDate:   res.StartDate.Format("2006-01-02"),
+			EndDate:     res.EndDate.Format("2006-01-02"),
+			Adults:      res.Adults,
+			Children:    res.Children,
+			Status:      res.Status,
+			RoomStatus:  model.RoomStatus(statuses, res.RoomID),
+			CanCheckIn:  model.CanTransition(res.Status, model.StatusCheckedIn),
+			CanCheckOut: model.CanTransition(res.Status, model.StatusCheckedOut),
+		})
+	}
+	return entries
+}
+
+// AdminFrontDeskJSON sends the front desk board of the day in the query string, today by default
+func (m *Repository) AdminFrontDeskJSON(w http.ResponseWriter, r *http.Request) {
+	date := boardDate(r.URL.Query())
+
+	var resp any
+	status := http.StatusOK
+	board, err := m.buildBoard(date)
+	var statuses map[int]string
+	if err == nil {
+		statuses, err = m.DB.RoomHousekeepingStatuses()
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		resp = map[string]any{"ok": false, "message": "Error querying database"}
+		status = http.StatusInternalServerError
+	} else {
+		resp = frontDeskResponse{
+			Ok:         true,
+			Date:       date.Format("2006-01-02"),
+			Arrivals:   boardEntries(board.Arrivals, statuses),
+			Departures: boardEntries(board.Departures, statuses),
+			InHouse:    boardEntries(board.InHouse, statuses),
+		}
+	}
+
+	out, _ := json.MarshalIndent(resp, "", "    ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// AdminNewReservations show all new reservations in admin page
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	filter, stringMap := reservationFilter(r.URL.Query(), "new")
+
+	newReservations, err := m.DB.AllNewReservations(filter)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["new_reservations"] = newReservations
+	m.addUndo(r, data)
+
+	m.renderReservationList(w, r, "admin-new-reservations.page.tmpl", data, stringMap)
+}
+
+// AdminAllReservations show all reservations in admin page
+func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	filter, stringMap := reservationFilter(r.URL.Query(), "all")
+
+	reservations, err := m.DB.AllReservations(filter)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["reservations"] = reservations
+	m.addUndo(r, data)
+
+	m.renderReservationList(w, r, "admin-all-reservations.page.tmpl", data, stringMap)
+}
+
+// renderReservationList renders a reservation list page with the choices of its filter form
+func (m *Repository) renderReservationList(w http.ResponseWriter, r *http.Request, tmpl string, data map[string]any, stringMap map[string]string) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data["rooms"] = rooms
+	data["statuses"] = model.Statuses()
+	data["sources"] = model.Sources()
+
+	render.Template(w, r, tmpl, &model.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// reservationFilter reads the filter of the src reservation list from its query string. It also
+// returns the values to fill the filter form with and the links exporting the filtered list.
+func reservationFilter(q url.Values, src string) (model.ReservationFilter, map[string]string) {
+	filter := model.ReservationFilter{
+		New:    src == "new",
+		Status: q.Get("status"),
+		Source: q.Get("source"),
+		Query:  strings.TrimSpace(q.Get("q")),
+	}
+	filter.RoomID, _ = strconv.Atoi(q.Get("room_id"))
+
+	layout := "2006-01-02"
+	if from, err := time.Parse(layout, q.Get("from")); err == nil {
+		filter.From = from
+	}
+	if to, err := time.Parse(layout, q.Get("to")); err == nil {
+		filter.To = to
+	}
+
+	stringMap := map[string]string{
+		"src":     src,
+		"status":  filter.Status,
+		"source":  filter.Source,
+		"room_id": q.Get("room_id"),
+		"from":    q.Get("from"),
+		"to":      q.Get("to"),
+		"q":       filter.Query,
+	}
+
+	for _, format := range []string{export.FormatCSV, export.FormatXLSX} {
+		exportQuery := url.Values{"format": {format}}
+		for _, key := range []string{"status", "source", "room_id", "from", "to", "q"} {
+			if stringMap[key] != "" {
+				exportQuery.Set(key, stringMap[key])
+			}
+		}
+		stringMap["export_"+format] = "/admin/reservations-export/" + src + "?" + exportQuery.Encode()
+	}
+
+	return filter, stringMap
+}
+
+// AdminExportReservations downloads the reservations of a list, with the filters of the list page,
+// as CSV or Excel. Rows are written as they are read so large exports don't build up in memory.
+func (m *Repository) AdminExportReservations(w http.ResponseWriter, r *http.Request) {
+	src := chi.URLParam(r, "src")
+	if src != "new" && src != "all" {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	filter, _ := reservationFilter(r.URL.Query(), src)
+
+	filename := fmt.Sprintf("reservations-%s-%s.%s", src, time.Now().Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	ew, err := export.NewWriter(w, format, "Reservations")
+	if err == nil {
+		err = ew.Write(export.ReservationHeader)
+	}
+	if err == nil {
+		err = m.DB.EachReservation(filter, func(res model.Reservation) error {
+			return ew.Write(export.ReservationRow(res, payment.Currency))
+		})
+	}
+	if err == nil {
+		err = ew.Close()
+	}
+	if err != nil {
+		// the download has started, all that can be done is cut it short and log why
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// AdminShowReservation show specific reservation in admin page
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	urlPath := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(urlPath[len(urlPath)-1])
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	src := urlPath[len(urlPath)-2]
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+	stringMap["back"] = reservationListURL(src)
+
+	reservation, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderAdminReservation(w, r, reservation, stringMap, forms.New(nil))
+}
+
+// renderAdminReservation renders the admin reservation page with its history and the rooms it can be moved to
+func (m *Repository) renderAdminReservation(w http.ResponseWriter, r *http.Request, reservation model.Reservation, stringMap map[string]string, form *forms.Form) {
+	history, err := m.DB.GetStatusHistoryForReservation(reservation.ID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	payments, err := m.DB.GetPaymentsForReservation(reservation.ID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	messages, err := m.DB.GetMessagesForReservation(reservation.ID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["reservation"] = reservation
+	data["status_history"] = history
+	data["payments"] = payments
+	data["messages"] = messages
+	data["next_statuses"] = model.NextStatuses(reservation.Status)
+	data["rooms"] = rooms
+
+	stringMap["currency"] = payment.Currency
+
+	render.Template(w, r, "admin-reservations-show.page.tmpl", &model.TemplateData{
+		Data:      data,
+		Form:      form,
+		StringMap: stringMap,
+	})
+}
+
+// AdminPostReservationMessage adds an internal note to the thread of a reservation, or emails the
+// guest and adds the email to it
+func (m *Repository) AdminPostReservationMessage(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	msg := model.ReservationMessage{
+		ReservationID: id,
+		Kind:          r.Form.Get("kind"),
+		UserID:        m.App.Session.GetInt(r.Context(), "user_id"),
+		Body:          strings.TrimSpace(r.Form.Get("body")),
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("body")
+
+	switch msg.Kind {
+	case model.MessageNote:
+	case model.MessageEmail:
+		form.Required("subject")
+		msg.Subject = strings.TrimSpace(r.Form.Get("subject"))
+		msg.To = res.Email
+		if msg.To == "" {
+			form.Errors.Add("kind", "the reservation has no email address to write to")
+		}
+	default:
+		form.Errors.Add("kind", "choose a note or an email")
+	}
+
+	if !form.Valid() {
+		stringMap := map[string]string{"src": src, "back": reservationListURL(src)}
+		m.renderAdminReservation(w, r, res, stringMap, form)
+		return
+	}
+
+	// the thread is saved first, so an email is never sent without being in it
+	_, err = m.DB.InsertReservationMessage(msg)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	flash := "Note added"
+	if msg.Kind == model.MessageEmail {
+		// what staff wrote is plain text, its lines kept in the html email
+		body := strings.ReplaceAll(html.EscapeString(strings.ReplaceAll(msg.Body, "\r\n", "\n")), "\n", "<br>")
+		m.App.MailChan <- model.MailData{
+			To:       msg.To,
+			From:     "me@here.com",
+			Subject:  msg.Subject,
+			Content:  body,
+			Template: "base.html",
+		}
+		flash = fmt.Sprintf("Email sent to %s", msg.To)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d#messages", src, id), http.StatusSeeOther)
+}
+
+// AdminPostShowReservation saves the changes made to a reservation in admin page
+func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	urlPath := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(urlPath[len(urlPath)-1])
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	src := urlPath[len(urlPath)-2]
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+	stringMap["back"] = reservationListURL(src)
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	before := res
+
+	res.FirstName = r.Form.Get("first_name")
+	res.LastName = r.Form.Get("last_name")
+	res.Email = r.Form.Get("email")
+	res.Phone = r.Form.Get("phone")
+
+	form := forms.New(r.PostForm)
+	form.Required("start_date", "end_date", "room_id")
+
+	layout := "2006-01-02"
+	startDate, err := time.Parse(layout, r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "invalid date")
+	}
+	endDate, err := time.Parse(layout, r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "invalid date")
+	}
+	if !startDate.IsZero() && !endDate.IsZero() && !endDate.After(startDate) {
+		form.Errors.Add("end_date", "departure must be after arrival")
+	}
+	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
+	if err != nil {
+		form.Errors.Add("room_id", "invalid room")
+	}
+	if r.Form.Has("adults") {
+		res.Adults, res.Children = partyFromForm(r.Form)
+	}
+
+	room := res.Room
+	if form.Valid() && (roomID != res.RoomID || res.PartySize() != before.PartySize()) {
+		room, err = m.DB.GetRoomByID(roomID)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			helpers.ServerError(w, err)
+			return
+		}
+		if res.PartySize() > room.MaxOccupancy {
+			form.Errors.Add("adults", fmt.Sprintf("%s sleeps at most %d people", room.RoomName, room.MaxOccupancy))
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAdminReservation(w, r, res, stringMap, form)
+		return
+	}
+
+	// the city tax is charged per person, so a change of party is priced again like a change of stay
+	partyChanged := res.Adults != before.Adults || res.Children != before.Children
+	if !startDate.Equal(res.StartDate) || !endDate.Equal(res.EndDate) || roomID != res.RoomID || partyChanged {
+		res.StartDate = startDate
+		res.EndDate = endDate
+		if roomID != res.RoomID {
+			res.RoomID = roomID
+			res.Room = room
+		}
+
+		// the discount and the taxes follow the price of the new stay and party
+		err = m.repriceReservation(&res)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			helpers.ServerError(w, err)
+			return
+		}
+
+		err = m.DB.UpdateReservationDatesAndRoom(res)
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			form.Errors.Add("room_id", "the room is not available for these dates")
+			res.Room, res.Discount, res.Taxes = before.Room, before.Discount, before.Taxes
+			m.renderAdminReservation(w, r, res, stringMap, form)
+			return
+		} else if err != nil {
+			m.App.ErrorLog.Println(err)
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	err = m.DB.UpdateReservation(res)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.auditLog(r, audit.ActionUpdate, audit.EntityReservation, res.ID, before, res)
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved successfully")
+	http.Redirect(w, r, reservationListURL(src), http.StatusSeeOther)
+
+}
+
+// AdminReservationsCalendar display the reservation calendar
+func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	// asume that is no month/year specified
+	now := time.Now()
+
+	if r.URL.Query().Get("y") != "" {
+		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
+		month, _ := strconv.Atoi(r.URL.Query().Get("m"))
+		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	data := make(map[string]any)
+	data["now"] = now
+
+	next := now.AddDate(0, 1, 0)
+	last := now.AddDate(0, -1, 0)
+
+	nextMonth := next.Format("01")
+	nextMonthYear := next.Format("2006")
+
+	lastMonth := last.Format("01")
+	lastMonthYear := last.Format("2006")
+
+	stringMap := make(map[string]string)
+	stringMap["next_month"] = nextMonth
+	stringMap["next_month_year"] = nextMonthYear
+	stringMap["last_month"] = lastMonth
+	stringMap["last_month_year"] = lastMonthYear
+
+	stringMap["this_month"] = now.Format("01")
+	stringMap["this_month_year"] = now.Format("2006")
+
+	// get the first and last day of the month
+	currentYear, currentMonth, _ := now.Date()
+	currentLocation := now.Location()
+	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	intMap := make(map[string]int)
+	intMap["days_in_month"] = lastOfMonth.Day()
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["rooms"] = rooms
+
+	statuses, err := m.DB.RoomHousekeepingStatuses()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["room_statuses"] = statuses
+
+	for _, x := range rooms {
+		// create maps
+		reservationMap := make(map[string]int)
+		blockMap := make(map[string]int)
+
+		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
+			reservationMap[d.Format("2006-01-2")] = 0
+			blockMap[d.Format("2006-01-2")] = 0
+		}
+
+		// get all the restrictions for the current room
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMonth, lastOfMonth)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		for _, y := range restrictions {
+			if y.ReservationID > 0 {
+				// it's a reservation
+				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
+					reservationMap[d.Format("2006-01-2")] = y.ReservationID
+				}
+			} else if y.RestrictionID == model.RestrictionHold {
+				// a guest checking out, the hold goes away by itself
+				continue
+			} else {
+				// it's a block, keyed by the restriction id so it can be removed
+				for d := y.StartDate; d.Before(y.EndDate); d = d.AddDate(0, 0, 1) {
+					blockMap[d.Format("2006-01-2")] = y.ID
+				}
+			}
+		}
+		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
+		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+
+		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
+	}
+
+	render.Template(w, r, "admin-reservations-calendar.page.tmpl", &model.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		IntMap:    intMap,
+	})
+}
+
+// AdminPostReservationsCalendar handles adding and removing owner blocks from the calendar
+func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	year, _ := strconv.Atoi(r.Form.Get("y"))
+	month, _ := strconv.Atoi(r.Form.Get("m"))
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	// remove the blocks that were shown on the calendar and are no longer checked
+	var freed []int
+	for _, x := range rooms {
+		curMap, ok := m.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", x.ID)).(map[string]int)
+		if !ok {
+			continue
+		}
+
+		removed := make(map[int]bool)
+		for day, blockID := range curMap {
+			if blockID == 0 || removed[blockID] {
+				continue
+			}
+			if !form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, day)) {
+				err = m.DB.DeleteBlockByID(blockID)
+				if err != nil {
+					m.App.ErrorLog.Println(err)
+					helpers.ServerError(w, err)
+					return
+				}
+				removed[blockID] = true
+				m.auditLog(r, audit.ActionDelete, audit.EntityBlock, blockID, map[string]any{"RoomID": x.ID, "Date": day}, nil)
+			}
+		}
+		if len(removed) > 0 {
+			freed = append(freed, x.ID)
+		}
+	}
+
+	// add the newly checked blocks, skipping the nights booked since the calendar was shown
+	var taken []string
+	for name := range r.PostForm {
+		if !strings.HasPrefix(name, "add_block_") {
+			continue
+		}
+		exploded := strings.Split(name, "_")
+		if len(exploded) != 4 {
+			continue
+		}
+		roomID, err := strconv.Atoi(exploded[2])
+		if err != nil {
+			continue
+		}
+		t, err := time.Parse("2006-01-2", exploded[3])
+		if err != nil {
+			continue
+		}
+
+		blockID, err := m.DB.InsertBlockForRoom(roomID, t)
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			taken = append(taken, t.Format("2006-01-02"))
+			continue
+		} else if err != nil {
+			m.App.ErrorLog.Println(err)
+			helpers.ServerError(w, err)
+			return
+		}
+		m.auditLog(r, audit.ActionCreate, audit.EntityBlock, blockID, nil, map[string]any{"RoomID": roomID, "Date": exploded[3]})
+	}
+
+	// once the new blocks are in, tell the waitlist about the dates that are still free
+	for _, roomID := range freed {
+		m.notifyWaitlist(roomID)
+	}
+
+	if len(taken) > 0 {
+		sort.Strings(taken)
+		m.App.Session.Put(r.Context(), "error", "Can't block nights the room is booked for: "+strings.Join(taken, ", "))
+	}
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
+}
+
+// AdminProcessReservation marks a reservation as processed
+func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+
+	err := m.DB.UpdateProcessedForReservation(id, 1)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.auditLog(r, audit.ActionProcess, audit.EntityReservation, id, map[string]any{"Processed": 0}, map[string]any{"Processed": 1})
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
+	http.Redirect(w, r, reservationListURL(src), http.StatusSeeOther)
+}
+
+// AdminDeleteReservation moves a reservation to the trash
+func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.DeleteReservation(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.auditLog(r, audit.ActionDelete, audit.EntityReservation, id, res, nil)
+	m.notifyWaitlist(res.RoomID)
+
+	m.App.Session.Put(r.Context(), "undo_reservation_id", id)
+	m.App.Session.Put(r.Context(), "undo_src", src)
+	m.App.Session.Put(r.Context(), "undo_until", time.Now().Add(undoGracePeriod).Unix())
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+	http.Redirect(w, r, reservationListURL(src), http.StatusSeeOther)
+}
+
+// AdminTrashReservations show the deleted reservations in admin page
+func (m *Repository) AdminTrashReservations(w http.ResponseWriter, r *http.Request) {
+	reservations, err := m.DB.AllDeletedReservations()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["reservations"] = reservations
+	m.addUndo(r, data)
+
+	render.Template(w, r, "admin-trash-reservations.page.tmpl", &model.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminRestoreReservation takes a reservation out of the trash
+func (m *Repository) AdminRestoreReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+
+	m.App.Session.Remove(r.Context(), "undo_reservation_id")
+	m.App.Session.Remove(r.Context(), "undo_src")
+	m.App.Session.Remove(r.Context(), "undo_until")
+
+	err = m.DB.RestoreReservation(id)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "Can't restore reservation, the room has been booked for those dates")
+		http.Redirect(w, r, "/admin/reservations-trash", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.auditLog(r, audit.ActionRestore, audit.EntityReservation, id, map[string]any{"Deleted": true}, map[string]any{"Deleted": false})
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation restored")
+	http.Redirect(w, r, reservationListURL(src), http.StatusSeeOther)
+}
+
+// AdminPurgeReservation permanently removes a reservation from the trash
+func (m *Repository) AdminPurgeReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.PurgeReservation(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.auditLog(r, audit.ActionPurge, audit.EntityReservation, id, res, nil)
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation permanently deleted")
+	http.Redirect(w, r, "/admin/reservations-trash", http.StatusSeeOther)
+}
+
+// addUndo puts the last deleted reservation in data while it can still be undone
+func (m *Repository) addUndo(r *http.Request, data map[string]any) {
+	id := m.App.Session.GetInt(r.Context(), "undo_reservation_id")
+	until := m.App.Session.GetInt64(r.Context(), "undo_until")
+	if id == 0 || time.Now().Unix() > until {
+		return
+	}
+	data["undo_reservation_id"] = id
+	data["undo_src"] = m.App.Session.GetString(r.Context(), "undo_src")
+}
+
+// AdminUpdateReservationStatus moves a reservation to the next status of its lifecycle
+func (m *Repository) AdminUpdateReservationStatus(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+	status := r.Form.Get("status")
+
+	back := fmt.Sprintf("/admin/reservations/%s/%d", src, id)
+	if src == "front-desk" {
+		// the check-in and check-out buttons of the board go back to the day they were on
+		back = frontDeskURL(r.Form.Get("date"))
+	}
+
+	if !model.ValidStatus(status) {
+		m.App.Session.Put(r.Context(), "error", "Invalid reservation status")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	var penalty, refund int64
+	if status == model.StatusCancelled {
+		penalty, refund, err = m.cancelReservation(res, userID)
+	} else {
+		err = m.DB.UpdateReservationStatus(id, status, userID)
+	}
+	if errors.Is(err, model.ErrInvalidTransition) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Reservation can't be marked as %s", model.StatusLabel(status)))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	before := map[string]any{"Status": res.Status}
+	after := map[string]any{"Status": status}
+	flash := fmt.Sprintf("Reservation marked as %s", model.StatusLabel(status))
+	if status == model.StatusCancelled {
+		before["CancellationPenalty"] = res.CancellationPenalty
+		after["CancellationPenalty"] = penalty
+		before["CancellationRefund"] = res.CancellationRefund
+		after["CancellationRefund"] = refund
+		if penalty > 0 {
+			flash += fmt.Sprintf(", the guest is charged %s", render.FormatMoney(penalty, payment.Currency))
+		}
+		if refund > 0 {
+			flash += fmt.Sprintf(", %s is refunded", render.FormatMoney(refund, payment.Currency))
+		}
+	}
+
+	m.auditLog(r, audit.ActionStatus, audit.EntityReservation, id, before, after)
+	if !model.HoldsRoom(status) {
+		m.notifyWaitlist(res.RoomID)
+	}
+	if status == model.StatusCheckedOut {
+		m.openHousekeeping(res, userID)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminReservationInvoice downloads the invoice of a reservation
+func (m *Repository) AdminReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	inv, err := m.invoiceFor(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	writeInvoice(w, inv)
+}
+
+// AdminCapturePayment takes the money of an authorized payment
+func (m *Repository) AdminCapturePayment(w http.ResponseWriter, r *http.Request) {
+	m.settlePayment(w, r, payment.StatusAuthorized, payment.StatusCaptured, m.App.Payments.Capture)
+}
+
+// AdminRefundPayment gives the money of a captured payment back
+func (m *Repository) AdminRefundPayment(w http.ResponseWriter, r *http.Request) {
+	m.settlePayment(w, r, payment.StatusCaptured, payment.StatusRefunded, m.App.Payments.Refund)
+}
+
+// settlePayment moves a payment in status from to status to, doing it with the provider through settle
+func (m *Repository) settlePayment(w http.ResponseWriter, r *http.Request, from, to string, settle func(reference string, amount int64) error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+
+	p, err := m.DB.GetPaymentByID(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	back := fmt.Sprintf("/admin/reservations/%s/%d", src, p.ReservationID)
+
+	if p.Provider != m.App.Payments.Name() {
+		m.App.Session.Put(r.Context(), "error", "This payment was taken by another payment provider")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if p.Status != from {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Only %s payments can be %s", from, to))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	err = settle(p.Reference, p.Amount)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("The payment provider refused: %v", err))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.UpdatePaymentStatus(p.Provider, p.Reference, to)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.auditLog(r, audit.ActionStatus, audit.EntityPayment, p.ID, map[string]any{"Status": p.Status}, map[string]any{"Status": to})
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Payment %s", to))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// reservationListURL returns the admin page a reservation was opened from
+func reservationListURL(src string) string {
+	switch src {
+	case "cal":
+		return "/admin/reservations-calendar"
+	case "front-desk":
+		return "/admin/front-desk"
+	}
+	return fmt.Sprintf("/admin/reservations-%s", src)
+}
+
+// auditLog records an admin change; a failure is logged rather than failing the already applied change
+func (m *Repository) auditLog(r *http.Request, action, entity string, entityID int, before, after any) {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	entry := model.AuditEntry{
+		UserID:   m.App.Session.GetInt(r.Context(), "user_id"),
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+		Changes:  changes,
+	}
+
+	err = m.DB.InsertAuditEntry(entry)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// openHousekeeping opens the cleaning of the room of a guest checking out. A failure is logged rather
+// than failing the check-out.
+func (m *Repository) openHousekeeping(res model.Reservation, userID int) {
+	now := time.Now()
+	err := m.DB.InsertHousekeepingTask(model.HousekeepingTask{
+		RoomID:        res.RoomID,
+		ReservationID: res.ID,
+		DueDate:       time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC),
+		Status:        model.RoomDirty,
+		UserID:        userID,
+	})
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// notifyWaitlist emails a booking link to the guests waiting for a room whose dates are now free.
+// A failure is logged rather than failing the change that freed the room.
+func (m *Repository) notifyWaitlist(roomID int) {
+	entries, err := m.DB.PendingWaitlistEntries(roomID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	// the first guest in line gets the dates, later ones for overlapping dates wait for the next opening
+	var offered []model.WaitlistEntry
+	for _, e := range entries {
+		if slices.ContainsFunc(offered, func(o model.WaitlistEntry) bool {
+			return e.StartDate.Before(o.EndDate) && e.EndDate.After(o.StartDate)
+		}) {
+			continue
+		}
+
+		available, err := m.DB.SearchAvailabilityByDatesByRoomID(e.StartDate, e.EndDate, e.RoomID)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		if !available {
+			continue
+		}
+
+		token, err := newToken()
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		expiresAt := time.Now().Add(waitlistOfferPeriod)
+
+		err = m.DB.OfferWaitlistEntry(e.ID, token, expiresAt)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		offered = append(offered, e)
+
+		htmlMessage := fmt.Sprintf(`
+		<strong>Good news!</strong><br>
+		%s is now available from %s to %s.<br>
+		<a href="%s/waitlist/%s">Book it now</a>, the link is valid until %s.
+	`, e.Room.RoomName, e.StartDate.Format("2006-01-02"), e.EndDate.Format("2006-01-02"),
+			m.App.BaseURL, token, expiresAt.Format("2006-01-02 15:04"))
+
+		m.App.MailChan <- model.MailData{
+			To:       e.Email,
+			From:     "me@here.com",
+			Subject:  "A room you wanted is available",
+			Content:  htmlMessage,
+			Template: "base.html",
+		}
+	}
+}
+
+// newToken returns a random hex token for links sent by email
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// AdminAuditLog shows the searchable audit log of admin changes
+func (m *Repository) AdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := model.AuditFilter{
+		Action: q.Get("action"),
+		Entity: q.Get("entity"),
+		Query:  strings.TrimSpace(q.Get("q")),
+	}
+	filter.UserID, _ = strconv.Atoi(q.Get("user_id"))
+	filter.EntityID, _ = strconv.Atoi(q.Get("entity_id"))
+
+	layout := "2006-01-02"
+	if from, err := time.Parse(layout, q.Get("from")); err == nil {
+		filter.From = from
+	}
+	if to, err := time.Parse(layout, q.Get("to")); err == nil {
+		filter.To = to
+	}
+
+	entries, err := m.DB.SearchAuditLog(filter)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["entries"] = entries
+	data["actions"] = audit.Actions()
+	data["entities"] = audit.Entities()
+
+	stringMap := map[string]string{
+		"action":    filter.Action,
+		"entity":    filter.Entity,
+		"q":         filter.Query,
+		"user_id":   q.Get("user_id"),
+		"entity_id": q.Get("entity_id"),
+		"from":      q.Get("from"),
+		"to":        q.Get("to"),
+	}
+
+	render.Template(w, r, "admin-audit-log.page.tmpl", &model.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminCreateReservation shows the form staff use to book a room for a guest
+func (m *Repository) AdminCreateReservation(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// room and dates can be preselected from the calendar
+	q := r.URL.Query()
+	var res model.Reservation
+	res.RoomID, _ = strconv.Atoi(q.Get("room_id"))
+	res.Adults, res.Children = partyFromForm(q)
+	res.Source = model.SourcePhone
+	res.Status = model.StatusConfirmed
+
+	layout := "2006-01-02"
+	if sd, err := time.Parse(layout, q.Get("s")); err == nil {
+		res.StartDate = sd
+		res.EndDate = sd.AddDate(0, 0, 1)
+	}
+	if ed, err := time.Parse(layout, q.Get("e")); err == nil {
+		res.EndDate = ed
+	}
+
+	data := make(map[string]any)
+	data["reservation"] = res
+	data["rooms"] = rooms
+	data["sources"] = model.Sources()
+
+	render.Template(w, r, "admin-create-reservation.page.tmpl", &model.TemplateData{
+		Data:      data,
+		Form:      forms.New(nil),
+		StringMap: map[string]string{"send_email": "1"},
+	})
+}
+
+// AdminPostCreateReservation books a room for a guest without going through the public search flow
+func (m *Repository) AdminPostCreateReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	res := model.Reservation{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+		Phone:     r.Form.Get("phone"),
+		Source:    r.Form.Get("source"),
+		Status:    model.StatusConfirmed,
+		Processed: 1,
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "start_date", "end_date", "room_id")
+	if form.Has("email") {
+		form.IsEmail("email")
+	}
+
+	layout := "2006-01-02"
+	res.StartDate, err = time.Parse(layout, r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "invalid date")
+	}
+	res.EndDate, err = time.Parse(layout, r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "invalid date")
+	}
+	if !res.StartDate.IsZero() && !res.EndDate.IsZero() && !res.EndDate.After(res.StartDate) {
+		form.Errors.Add("end_date", "departure must be after arrival")
+	}
+	if !model.ValidSource(res.Source) {
+		form.Errors.Add("source", "invalid source")
+	}
+	res.Adults, res.Children = partyFromForm(r.Form)
+	res.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+	for _, room := range rooms {
+		if room.ID != res.RoomID {
+			continue
+		}
+		res.Room = room
+		if res.PartySize() > room.MaxOccupancy {
+			form.Errors.Add("adults", fmt.Sprintf("%s sleeps at most %d people", room.RoomName, room.MaxOccupancy))
+		}
+	}
+	// only the rooms that are still there can be booked
+	if form.Has("room_id") && res.Room.ID == 0 {
+		form.Errors.Add("room_id", "invalid room")
+	}
+
+	sendEmail := r.Form.Get("send_email") == "1"
+	if sendEmail && !form.Has("email") {
+		form.Errors.Add("email", "an email is needed to notify the guest")
+	}
+
+	if form.Has("email") {
+		guest, err := m.DB.GetGuestByEmail(res.Email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			m.App.ErrorLog.Println(err)
+			helpers.ServerError(w, err)
+			return
+		}
+		if guest.Blocked {
+			form.Errors.Add("email", "this guest is blocked, unblock them on their profile first")
+		}
+	}
+
+	if form.Valid() {
+		err = m.applyTaxes(&res)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			helpers.ServerError(w, err)
+			return
+		}
+
+		res.ID, err = m.DB.InsertReservationWithRestriction(res, 0)
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			form.Errors.Add("room_id", "the room is not available for these dates")
+		} else if err != nil {
+			m.App.ErrorLog.Println(err)
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := make(map[string]any)
+		data["reservation"] = res
+		data["rooms"] = rooms
+		data["sources"] = model.Sources()
+
+		stringMap := make(map[string]string)
+		if sendEmail {
+			stringMap["send_email"] = "1"
+		}
+
+		render.Template(w, r, "admin-create-reservation.page.tmpl", &model.TemplateData{
+			Data:      data,
+			Form:      form,
+			StringMap: stringMap,
+		})
+		return
+	}
+
+	m.auditLog(r, audit.ActionCreate, audit.EntityReservation, res.ID, nil, res)
+
+	if sendEmail {
+		m.sendReservationConfirmation(res)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation created")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/all/%d", res.ID), http.StatusSeeOther)
+}
+
+// AdminGuests lists the guests, optionally filtered by a search on name, email or phone
+func (m *Repository) AdminGuests(w http.ResponseWriter, r *http.Request) {
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	guests, err := m.DB.AllGuests(search)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["guests"] = guests
+
+	render.Template(w, r, "admin-guests.page.tmpl", &model.TemplateData{
+		Data:      data,
+		StringMap: map[string]string{"q": search},
+	})
+}
+
+// AdminShowGuest shows a guest profile with their stay history
+func (m *Repository) AdminShowGuest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest, err := m.DB.GetGuestByID(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderAdminGuest(w, r, guest, forms.New(nil))
+}
+
+// renderAdminGuest renders the guest profile page with the guest's reservations
+func (m *Repository) renderAdminGuest(w http.ResponseWriter, r *http.Request, guest model.Guest, form *forms.Form) {
+	reservations, err := m.DB.GetReservationsForGuest(guest.ID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["guest"] = guest
+	data["reservations"] = reservations
+
+	render.Template(w, r, "admin-guest-show.page.tmpl", &model.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminPostShowGuest saves a guest's details, notes and VIP/blocked flags
+func (m *Repository) AdminPostShowGuest(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest, err := m.DB.GetGuestByID(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	before := guest
+
+	guest.FirstName = r.Form.Get("first_name")
+	guest.LastName = r.Form.Get("last_name")
+	guest.Phone = r.Form.Get("phone")
+	guest.Notes = r.Form.Get("notes")
+	guest.VIP = r.Form.Get("vip") == "1"
+	guest.Blocked = r.Form.Get("blocked") == "1"
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name")
+	if !form.Valid() {
+		m.renderAdminGuest(w, r, guest, form)
+		return
+	}
+
+	err = m.DB.UpdateGuest(guest)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	m.auditLog(r, audit.ActionUpdate, audit.EntityGuest, guest.ID, before, guest)
+
+	m.App.Session.Put(r.Context(), "flash", "Guest saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", guest.ID), http.StatusSeeOther)
+}
+
+// AdminStayRules lists the stay rules with a form to add one
+func (m *Repository) AdminStayRules(w http.ResponseWriter, r *http.Request) {
+	m.renderAdminStayRules(w, r, model.StayRule{}, forms.New(nil))
+}
+
+// renderAdminStayRules renders the stay rules page, with rule filled in the new rule form
+func (m *Repository) renderAdminStayRules(w http.ResponseWriter, r *http.Request, rule model.StayRule, form *forms.Form) {
+	stayRules, err := m.DB.AllStayRules()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["rules"] = stayRules
+	data["rooms"] = rooms
+	data["rule"] = rule
+	data["weekdays"] = []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}
+
+	render.Template(w, r, "admin-stay-rules.page.tmpl", &model.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminPostStayRule adds a stay rule
+func (m *Repository) AdminPostStayRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	var rule model.StayRule
+	rule.Name = r.Form.Get("name")
+	rule.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+
+	layout := "2006-01-02"
+	if form.Has("season_start") {
+		rule.SeasonStart, err = time.Parse(layout, r.Form.Get("season_start"))
+		if err != nil {
+			form.Errors.Add("season_start", "invalid date")
+		}
+	}
+	if form.Has("season_end") {
+		rule.SeasonEnd, err = time.Parse(layout, r.Form.Get("season_end"))
+		if err != nil {
+			form.Errors.Add("season_end", "invalid date")
+		}
+	}
+	if !rule.SeasonStart.IsZero() && !rule.SeasonEnd.IsZero() && rule.SeasonEnd.Before(rule.SeasonStart) {
+		form.Errors.Add("season_end", "the season must end after it starts")
+	}
+
+	numbers := map[string]*int{
+		"min_nights":       &rule.MinNights,
+		"max_nights":       &rule.MaxNights,
+		"min_advance_days": &rule.MinAdvanceDays,
+		"max_advance_days": &rule.MaxAdvanceDays,
+	}
+	for field, value := range numbers {
+		if !form.Has(field) {
+			continue
+		}
+		n, err := strconv.Atoi(r.Form.Get(field))
+		if err != nil || n < 0 {
+			form.Errors.Add(field, "must be a positive number")
+			continue
+		}
+		*value = n
+	}
+	if rule.MaxNights > 0 && rule.MaxNights < rule.MinNights {
+		form.Errors.Add("max_nights", "must be at least the minimum stay")
+	}
+	if rule.MaxAdvanceDays > 0 && rule.MaxAdvanceDays < rule.MinAdvanceDays {
+		form.Errors.Add("max_advance_days", "must be at least the minimum advance")
+	}
+
+	for _, d := range r.Form["closed_to_arrival"] {
+		if day, err := strconv.Atoi(d); err == nil && day >= 0 && day <= 6 {
+			rule.ClosedToArrival |= model.NewWeekdays(time.Weekday(day))
+		}
+	}
+	for _, d := range r.Form["closed_to_departure"] {
+		if day, err := strconv.Atoi(d); err == nil && day >= 0 && day <= 6 {
+			rule.ClosedToDeparture |= model.NewWeekdays(time.Weekday(day))
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAdminStayRules(w, r, rule, form)
+		return
+	}
+
+	rule.ID, err = m.DB.InsertStayRule(rule)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	m.auditLog(r, audit.ActionCreate, audit.EntityStayRule, rule.ID, nil, rule)
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule added")
+	http.Redirect(w, r, "/admin/stay-rules", http.StatusSeeOther)
+}
+
+// AdminDeleteStayRule deletes a stay rule
+func (m *Repository) AdminDeleteStayRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteStayRule(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	m.auditLog(r, audit.ActionDelete, audit.EntityStayRule, id, map[string]any{"ID": id}, nil)
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule deleted")
+	http.Redirect(w, r, "/admin/stay-rules", http.StatusSeeOther)
+}
+
+// AdminPromotions shows the promo codes and the form to add one
+func (m *Repository) AdminPromotions(w http.ResponseWriter, r *http.Request) {
+	m.renderAdminPromotions(w, r, model.Promotion{DiscountType: model.DiscountPercent}, forms.New(nil))
+}
+
+// renderAdminPromotions renders the promotions page, with p filled in the new promotion form
+func (m *Repository) renderAdminPromotions(w http.ResponseWriter, r *http.Request, p model.Promotion, form *forms.Form) {
+	promotions, err := m.DB.AllPromotions()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]any)
+	data["promotions"] = promotions
+	data["rooms"] = rooms
+	data["promotion"] = p
+
+	render.Template(w, r, "admin-promotions.page.tmpl", &model.TemplateData{
+		Data:      data,
+		Form:      form,
+		StringMap: map[string]string{"currency": payment.Currency},
+	})
+}
+
+// AdminPostPromotion adds a promo code
+func (m *Repository) AdminPostPromotion(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "amount")
+
+	var p model.Promotion
+	p.Code = promo.NormalizeCode(r.Form.Get("code"))
+	p.Description = r.Form.Get("description")
+	p.DiscountType = r.Form.Get("discount_type")
+	p.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+
+	if form.Has("code") {
+		form.IsPromoCode("code")
+	}
+
+	switch p.DiscountType {
+	case model.DiscountPercent:
+		percent, err := strconv.Atoi(r.Form.Get("amount"))
+		if err != nil || percent < 1 || percent > 100 {
+			form.Errors.Add("amount", "must be a percentage between 1 and 100")
+		}
+		p.Amount = int64(percent)
+	case model.DiscountFixed:
+		amount, err := strconv.ParseFloat(r.Form.Get("amount"), 64)
+		if err != nil || amount <= 0 {
+			form.Errors.Add("amount", "must be a positive amount")
+		}
+		p.Amount = int64(math.Round(amount * 100))
+	default:
+		form.Errors.Add("discount_type", "choose a discount type")
+	}
+
+	layout := "2006-01-02"
+	if form.Has("valid_from") {
+		p.ValidFrom, err = time.Parse(layout, r.Form.Get("valid_from"))
+		if err != nil {
+			form.Errors.Add("valid_from", "invalid date")
+		}
+	}
+	if form.Has("valid_to") {
+		p.ValidTo, err = time.Parse(layout, r.Form.Get("valid_to"))
+		if err != nil {
+			form.Errors.Add("valid_to", "invalid date")
+		}
+	}
+	if !p.ValidFrom.IsZero() && !p.ValidTo.IsZero() && p.ValidTo.Before(p.ValidFrom) {
+		form.Errors.Add("valid_to", "the code must expire after it starts")
+	}
+
+	limits := map[string]*int{
+		"max_uses":           &p.MaxUses,
+		"max_uses_per_guest": &p.MaxUsesPerGuest,
+	}
+	for field, value := range limits {
+		if !form.Has(field) {
+			continue
+		}
+		n, err := strconv.Atoi(r.Form.Get(field))
+		if err != nil || n < 0 {
+			form.Errors.Add(field, "must be a positive number")
+			continue
+		}
+		*value = n
+	}
+
+	if !form.Valid() {
+		m.renderAdminPromotions(w, r, p, form)
+		return
+	}
+
+	p.ID, err = m.DB.InsertPromotion(p)
+	if errors.Is(err, repository.ErrPromoCodeExists) {
+		form.Errors.Add("code", "this code is already in use")
+		m.renderAdminPromotions(w, r, p, form)
+		return
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	m.auditLog(r, audit.ActionCreate, audit.EntityPromotion, p.ID, nil, p)
+
+	m.App.Session.Put(r.Context(), "flash", "Promo code added")
+	http.Redirect(w, r, "/admin/promotions", http.StatusSeeOther)
+}
+
+// AdminDeletePromotion deletes a promo code
+func (m *Repository) AdminDeletePromotion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeletePromotion(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	m.auditLog(r, audit.ActionDelete, audit.EntityPromotion, id, map[string]any{"ID": id}, nil)
 
-// Logout logs out the user
-func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
-	_ = m.App.Session.Destroy(r.Context())
-	_ = m.App.Session.RenewToken(r.Context())
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	m.App.Session.Put(r.Context(), "flash", "Promo code deleted")
+	http.Redirect(w, r, "/admin/promotions", http.StatusSeeOther)
 }
 
-// AdminDashboard is the admin dashboard page handler
-func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin-dashboard.page.tmpl", &model.TemplateData{})
+// AdminTaxRules shows the taxes and fees and the form to add one
+func (m *Repository) AdminTaxRules(w http.ResponseWriter, r *http.Request) {
+	m.renderAdminTaxRules(w, r, model.TaxRule{Kind: model.TaxPercent}, forms.New(nil))
 }
 
-// AdminNewReservations show all new reservations in admin page
-func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	newReservations, err := m.DB.AllNewReservations()
+// renderAdminTaxRules renders the taxes page, with t filled in the new tax form
+func (m *Repository) renderAdminTaxRules(w http.ResponseWriter, r *http.Request, t model.TaxRule, form *forms.Form) {
+	taxRules, err := m.DB.AllTaxRules()
 	if err != nil {
 		m.App.ErrorLog.Println(err)
 		helpers.ServerError(w, err)
@@ -543,45 +3837,122 @@ func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request
 	}
 
 	data := make(map[string]any)
-	data["new_reservations"] = newReservations
+	data["tax_rules"] = taxRules
+	data["tax_rule"] = t
 
-	render.Template(w, r, "admin-new-reservations.page.tmpl", &model.TemplateData{
-		Data: data,
+	render.Template(w, r, "admin-taxes.page.tmpl", &model.TemplateData{
+		Data:      data,
+		Form:      form,
+		StringMap: map[string]string{"currency": payment.Currency},
 	})
 }
 
-// AdminAllReservations show all reservations in admin page
-func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
+// AdminPostTaxRule adds a tax or fee
+func (m *Repository) AdminPostTaxRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
 		m.App.ErrorLog.Println(err)
 		helpers.ServerError(w, err)
 		return
 	}
 
-	data := make(map[string]any)
-	data["reservations"] = reservations
+	form := forms.New(r.PostForm)
+	form.Required("name", "amount")
 
-	render.Template(w, r, "admin-all-reservations.page.tmpl", &model.TemplateData{
-		Data: data,
-	})
+	t := model.TaxRule{
+		Name:      r.Form.Get("name"),
+		Kind:      r.Form.Get("kind"),
+		Inclusive: r.Form.Get("inclusive") == "1",
+	}
+
+	switch t.Kind {
+	case model.TaxPercent, model.TaxPerNight, model.TaxPerPersonNight:
+	default:
+		form.Errors.Add("kind", "choose how the tax is charged")
+	}
+
+	// percentages and fees both take two decimals, stored as hundredths
+	if form.Has("amount") {
+		amount, err := strconv.ParseFloat(r.Form.Get("amount"), 64)
+		if err != nil || amount <= 0 {
+			form.Errors.Add("amount", "must be a positive amount")
+		} else if t.Kind == model.TaxPercent && amount > 100 {
+			form.Errors.Add("amount", "must be a percentage up to 100")
+		}
+		t.Amount = int64(math.Round(amount * 100))
+	}
+
+	if !form.Valid() {
+		m.renderAdminTaxRules(w, r, t, form)
+		return
+	}
+
+	t.ID, err = m.DB.InsertTaxRule(t)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
+	m.auditLog(r, audit.ActionCreate, audit.EntityTaxRule, t.ID, nil, t)
+
+	m.App.Session.Put(r.Context(), "flash", "Tax added, it applies to new reservations")
+	http.Redirect(w, r, "/admin/taxes", http.StatusSeeOther)
 }
 
-// AdminShowReservation show specific reservation in admin page
-func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
-	urlPath := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(urlPath[len(urlPath)-1])
+// AdminDeleteTaxRule deletes a tax or fee
+func (m *Repository) AdminDeleteTaxRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteTaxRule(id)
 	if err != nil {
 		m.App.ErrorLog.Println(err)
 		helpers.ServerError(w, err)
 		return
 	}
+	m.auditLog(r, audit.ActionDelete, audit.EntityTaxRule, id, map[string]any{"ID": id}, nil)
 
-	src := urlPath[len(urlPath)-2]
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
+	m.App.Session.Put(r.Context(), "flash", "Tax deleted")
+	http.Redirect(w, r, "/admin/taxes", http.StatusSeeOther)
+}
 
-	reservation, err := m.DB.GetReservationByID(id)
+// PostCurrency sets the currency the visitor shows prices in and takes them back to the page they were on
+func (m *Repository) PostCurrency(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	code := currency.NormalizeCode(r.Form.Get("currency"))
+	if code == "" || code == payment.Currency {
+		m.App.Session.Remove(r.Context(), "currency")
+	} else if _, ok := m.App.Currencies.Get(code); ok {
+		m.App.Session.Put(r.Context(), "currency", code)
+	} else {
+		m.App.Session.Put(r.Context(), "error", "we can't show prices in that currency")
+	}
+
+	// only the path of the referring page, so the form can't send visitors to another site
+	back := "/"
+	if ref, err := url.Parse(r.Referer()); err == nil && strings.HasPrefix(ref.Path, "/") {
+		back = ref.RequestURI()
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminCurrencies shows the exchange rates and the form to set one
+func (m *Repository) AdminCurrencies(w http.ResponseWriter, r *http.Request) {
+	m.renderAdminCurrencies(w, r, model.ExchangeRate{}, forms.New(nil))
+}
+
+// renderAdminCurrencies renders the currencies page, with e filled in the rate form
+func (m *Repository) renderAdminCurrencies(w http.ResponseWriter, r *http.Request, e model.ExchangeRate, form *forms.Form) {
+	rates, err := m.DB.AllExchangeRates()
 	if err != nil {
 		m.App.ErrorLog.Println(err)
 		helpers.ServerError(w, err)
@@ -589,16 +3960,18 @@ func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request
 	}
 
 	data := make(map[string]any)
-	data["reservation"] = reservation
+	data["rates"] = rates
+	data["rate"] = e
 
-	render.Template(w, r, "admin-reservations-show.page.tmpl", &model.TemplateData{
+	render.Template(w, r, "admin-currencies.page.tmpl", &model.TemplateData{
 		Data:      data,
-		Form:      forms.New(nil),
-		StringMap: stringMap,
+		Form:      form,
+		StringMap: map[string]string{"currency": payment.Currency},
 	})
 }
 
-func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+// AdminPostCurrency sets the exchange rate of a currency, adding it if it isn't offered yet
+func (m *Repository) AdminPostCurrency(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
 		m.App.ErrorLog.Println(err)
@@ -606,149 +3979,254 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	urlPath := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(urlPath[len(urlPath)-1])
+	form := forms.New(r.PostForm)
+	form.Required("currency", "rate")
+
+	e := model.ExchangeRate{Currency: currency.NormalizeCode(r.Form.Get("currency"))}
+
+	if form.Has("currency") && form.IsCurrencyCode("currency") && e.Currency == payment.Currency {
+		form.Errors.Add("currency", "prices are already in "+payment.Currency)
+	}
+
+	if form.Has("rate") {
+		e.Rate, err = strconv.ParseFloat(r.Form.Get("rate"), 64)
+		if err != nil || e.Rate <= 0 {
+			form.Errors.Add("rate", "must be a positive number")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAdminCurrencies(w, r, e, form)
+		return
+	}
+
+	before, _ := m.App.Currencies.Get(e.Currency)
+
+	e.ID, err = m.DB.UpsertExchangeRate(e)
 	if err != nil {
 		m.App.ErrorLog.Println(err)
 		helpers.ServerError(w, err)
 		return
 	}
+	if before.ID == 0 {
+		m.auditLog(r, audit.ActionCreate, audit.EntityCurrency, e.ID, nil, e)
+	} else {
+		m.auditLog(r, audit.ActionUpdate, audit.EntityCurrency, e.ID, before, e)
+	}
 
-	src := urlPath[len(urlPath)-2]
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
-
-	res, err := m.DB.GetReservationByID(id)
-	if err != nil {
+	if err := m.LoadExchangeRates(); err != nil {
 		m.App.ErrorLog.Println(err)
 		helpers.ServerError(w, err)
 		return
 	}
 
-	res.FirstName = r.Form.Get("first_name")
-	res.LastName = r.Form.Get("last_name")
-	res.Email = r.Form.Get("email")
-	res.Phone = r.Form.Get("phone")
+	m.App.Session.Put(r.Context(), "flash", "Exchange rate saved")
+	http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+}
 
-	err = m.DB.UpdateReservation(res)
+// AdminDeleteCurrency stops offering a currency
+func (m *Repository) AdminDeleteCurrency(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteExchangeRate(id)
 	if err != nil {
 		m.App.ErrorLog.Println(err)
 		helpers.ServerError(w, err)
 		return
 	}
+	m.auditLog(r, audit.ActionDelete, audit.EntityCurrency, id, map[string]any{"ID": id}, nil)
 
-	m.App.Session.Put(r.Context(), "flash", "Changes saved successfully")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	if err := m.LoadExchangeRates(); err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
 
+	m.App.Session.Put(r.Context(), "flash", "Currency deleted")
+	http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
 }
 
-// AdminReservationsCalendar display the reservation calendar
-func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
-	// asume that is no month/year specified
-	now := time.Now()
-
-	if r.URL.Query().Get("y") != "" {
-		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
-		month, _ := strconv.Atoi(r.URL.Query().Get("m"))
-		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+// LoadExchangeRates loads the rates pages show prices with from the database, when the application
+// starts and after the admins change them
+func (m *Repository) LoadExchangeRates() error {
+	rates, err := m.DB.AllExchangeRates()
+	if err != nil {
+		return err
+	}
+	if m.App.Currencies == nil {
+		m.App.Currencies = currency.NewTable()
 	}
+	m.App.Currencies.Set(rates)
+	return nil
+}
+
+// maxImportSize is the largest import file admins can upload
+const maxImportSize = 10 << 20
 
+// AdminImport shows the form to import reservations and blocks from a CSV file
+func (m *Repository) AdminImport(w http.ResponseWriter, r *http.Request) {
+	m.renderAdminImport(w, r, nil, forms.New(nil))
+}
+
+// renderAdminImport renders the import page, with the report of the last file checked if there is one
+func (m *Repository) renderAdminImport(w http.ResponseWriter, r *http.Request, report *importer.Report, form *forms.Form) {
 	data := make(map[string]any)
-	data["now"] = now
+	data["columns"] = importer.Columns
+	if report != nil {
+		data["report"] = report
+	}
 
-	next := now.AddDate(0, 1, 0)
-	last := now.AddDate(0, -1, 0)
+	render.Template(w, r, "admin-import.page.tmpl", &model.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
 
-	nextMonth := next.Format("01")
-	nextMonthYear := next.Format("2006")
+// AdminPostImport checks an uploaded CSV file and imports it, unless it is a dry run or a line is invalid
+func (m *Repository) AdminPostImport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
 
-	lastMonth := last.Format("01")
-	lastMonthYear := last.Format("2006")
+	form := forms.New(r.PostForm)
+	dryRun := r.Form.Get("dry_run") == "1"
 
-	stringMap := make(map[string]string)
-	stringMap["next_month"] = nextMonth
-	stringMap["next_month_year"] = nextMonthYear
-	stringMap["last_month"] = lastMonth
-	stringMap["last_month_year"] = lastMonthYear
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		form.Errors.Add("file", "choose a CSV file")
+		m.renderAdminImport(w, r, nil, form)
+		return
+	}
+	defer file.Close()
 
-	stringMap["this_month"] = now.Format("01")
-	stringMap["this_month_year"] = now.Format("2006")
+	report, err := importer.Run(m.DB, file, dryRun)
+	switch {
+	case errors.Is(err, importer.ErrMissingColumn):
+		form.Errors.Add("file", err.Error())
+		m.renderAdminImport(w, r, nil, form)
+		return
+	case errors.Is(err, repository.ErrRoomUnavailable):
+		form.Errors.Add("file", "a room was booked while importing, nothing was imported, check the file again")
+		m.renderAdminImport(w, r, &report, form)
+		return
+	case err != nil:
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
 
-	// get the first and last day of the month
-	currentYear, currentMonth, _ := now.Date()
-	currentLocation := now.Location()
-	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
-	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+	if !report.Imported {
+		m.renderAdminImport(w, r, &report, form)
+		return
+	}
 
-	intMap := make(map[string]int)
-	intMap["days_in_month"] = lastOfMonth.Day()
+	m.auditLog(r, audit.ActionImport, audit.EntityReservation, 0, nil, map[string]int{
+		"Reservations": report.Reservations,
+		"Blocks":       report.Blocks,
+	})
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Imported %d reservations and %d blocks", report.Reservations, report.Blocks))
+	http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+}
+
+// AdminHousekeeping shows the status of every room and the cleaning of a day, today by default
+func (m *Repository) AdminHousekeeping(w http.ResponseWriter, r *http.Request) {
+	date := boardDate(r.URL.Query())
 
 	rooms, err := m.DB.AllRooms()
 	if err != nil {
+		m.App.ErrorLog.Println(err)
 		helpers.ServerError(w, err)
 		return
 	}
-	data["rooms"] = rooms
 
-	for _, x := range rooms {
-		// create maps
-		reservationMap := make(map[string]int)
-		blockMap := make(map[string]int)
+	statuses, err := m.DB.RoomHousekeepingStatuses()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
 
-		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
-			reservationMap[d.Format("2006-01-2")] = 0
-			blockMap[d.Format("2006-01-2")] = 0
-		}
+	tasks, err := m.DB.HousekeepingTasks(date)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
 
-		// get all the restrictions for the current room
-		restrictions, err := m.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMonth, lastOfMonth)
-		if err != nil {
-			helpers.ServerError(w, err)
-			return
-		}
+	data := make(map[string]any)
+	data["rooms"] = rooms
+	data["room_statuses"] = statuses
+	data["tasks"] = tasks
+	data["statuses"] = model.HousekeepingStatuses()
 
-		for _, y := range restrictions {
-			if y.ReservationID > 0 {
-				// it's a reservation
-				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
-					reservationMap[d.Format("2006-01-2")] = y.ReservationID
-				}
-			} else {
-				// it's a block
-				blockMap[y.StartDate.Format("2006-01-1")] = y.RestrictionID
-			}
-		}
-		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
-		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+	layout := "2006-01-02"
+	render.Template(w, r, "admin-housekeeping.page.tmpl", &model.TemplateData{
+		Data: data,
+		StringMap: map[string]string{
+			"date": date.Format(layout),
+			"prev": date.AddDate(0, 0, -1).Format(layout),
+			"next": date.AddDate(0, 0, 1).Format(layout),
+		},
+	})
+}
 
-		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
+// AdminPostHousekeeping marks a room dirty, clean or inspected
+func (m *Repository) AdminPostHousekeeping(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
 	}
 
-	render.Template(w, r, "admin-reservations-calendar.page.tmpl", &model.TemplateData{
-		StringMap: stringMap,
-		Data:      data,
-		IntMap:    intMap,
-	})
-}
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
 
-// AdminProcessReservation marks a reservation as processed
-func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
+	back := "/admin/housekeeping"
+	if date := r.Form.Get("date"); date != "" {
+		if _, err := time.Parse("2006-01-02", date); err == nil {
+			back += "?date=" + date
+		}
+	}
 
-	_ = m.DB.UpdateProcessedForReservation(id, 1)
+	status := r.Form.Get("status")
+	if !model.ValidHousekeepingStatus(status) {
+		m.App.Session.Put(r.Context(), "error", "Invalid housekeeping status")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-}
+	statuses, err := m.DB.RoomHousekeepingStatuses()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
 
-// AdminDeleteReservation marks a reservation as deleted
-func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	err = m.DB.SetRoomHousekeepingStatus(roomID, status, userID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ServerError(w, err)
+		return
+	}
 
-	_ = m.DB.DeleteReservation(id)
+	m.auditLog(r, audit.ActionStatus, audit.EntityRoom, roomID,
+		map[string]any{"Housekeeping": model.RoomStatus(statuses, roomID)},
+		map[string]any{"Housekeeping": status})
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Room marked as %s", strings.ToLower(model.HousekeepingLabel(status))))
+	http.Redirect(w, r, back, http.StatusSeeOther)
 }
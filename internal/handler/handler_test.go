@@ -1,19 +1,24 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com.br/Leodf/bookings/internal/driver"
 	"github.com.br/Leodf/bookings/internal/model"
+	"github.com.br/Leodf/bookings/internal/payment"
+	"github.com/go-chi/chi/v5"
 )
 
 var theTests = []struct {
@@ -28,6 +33,9 @@ var theTests = []struct {
 	{"ms", "/majors-suite", "GET", http.StatusOK},
 	{"sa", "/search-availability", "GET", http.StatusOK},
 	{"contact", "/contact", "GET", http.StatusOK},
+	{"guest login", "/guest/login", "GET", http.StatusOK},
+	{"guest register", "/guest/register", "GET", http.StatusOK},
+	{"waitlist", "/waitlist?s=01/01/2050&e=03/01/2050&id=1", "GET", http.StatusOK},
 }
 
 func TestHandlers(t *testing.T) {
@@ -96,6 +104,21 @@ func TestRepository_Reservation(t *testing.T) {
 	if rr.Code != http.StatusTemporaryRedirect {
 		t.Errorf("Reservation handler returned wrong response code: %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
 	}
+
+	// test with a party too big for the room
+	req, _ = http.NewRequest("GET", "/make-reservation", nil)
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+	reservation.RoomID = 1
+	reservation.Adults = 2
+	reservation.Children = 1
+	session.Put(ctx, "reservation", reservation)
+
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("Reservation handler returned wrong response code for a party too big: %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
 }
 
 func TestRepository_PostReservation(t *testing.T) {
@@ -111,6 +134,7 @@ func TestRepository_PostReservation(t *testing.T) {
 	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 	ctx := getCtx(req)
 	req = req.WithContext(ctx)
+	putHold(ctx)
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
@@ -122,6 +146,12 @@ func TestRepository_PostReservation(t *testing.T) {
 	if rr.Code != http.StatusSeeOther {
 		t.Errorf("PostReservation handler returned wrong response code: %d, wanted %d", rr.Code, http.StatusSeeOther)
 	}
+	if res, _ := session.Get(ctx, "reservation").(model.Reservation); res.CheckoutStartedAt.IsZero() {
+		t.Error("PostReservation should record when the guest was sent to checkout")
+	}
+	if session.Exists(ctx, "hold_id") {
+		t.Error("PostReservation should let go of the hold once the reservation took the room")
+	}
 
 	// test for missing body
 	req, _ = http.NewRequest("POST", "/make-reservation", nil)
@@ -222,10 +252,11 @@ func TestRepository_PostReservation(t *testing.T) {
 	handler = http.HandlerFunc(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusSeeOther {
-		t.Errorf("PostReservation handler returned wrong response code for invalid data: %d, wanted %d", rr.Code, http.StatusSeeOther)
+	// the form is shown again with its errors
+	if rr.Code != http.StatusOK {
+		t.Errorf("PostReservation handler returned wrong response code for invalid data: %d, wanted %d", rr.Code, http.StatusOK)
 	}
-	// test for failure to insert reservation into database
+	// test for a room taken since it was held
 	reqBody = "start_date=01/01/2050"
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "end_date=02/01/2050")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "first_name=John")
@@ -238,16 +269,17 @@ func TestRepository_PostReservation(t *testing.T) {
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 	ctx = getCtx(req)
 	req = req.WithContext(ctx)
+	putHold(ctx)
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr = httptest.NewRecorder()
 	handler = http.HandlerFunc(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("PostReservation handler failed when trying fail inserting reservation: %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostReservation handler returned wrong response code for a room taken: %d, wanted %d", rr.Code, http.StatusSeeOther)
 	}
-	// test for failure to insert restriction into database
+	// test for failure to insert reservation into database
 	reqBody = "start_date=01/01/2050"
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "end_date=02/01/2050")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "first_name=John")
@@ -260,6 +292,7 @@ func TestRepository_PostReservation(t *testing.T) {
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 	ctx = getCtx(req)
 	req = req.WithContext(ctx)
+	putHold(ctx)
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr = httptest.NewRecorder()
@@ -471,6 +504,146 @@ func TestRepository_PostAvailability(t *testing.T) {
 	}
 }
 
+func TestRepository_PostAvailabilityPartySize(t *testing.T) {
+	var tests = []struct {
+		name               string
+		adults             string
+		children           string
+		expectedStatusCode int
+	}{
+		{"party fits", "2", "1", http.StatusOK},
+		{"no party given", "", "", http.StatusOK},
+		{"party too big", "4", "2", http.StatusSeeOther},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("start", "01/01/2040")
+		postedData.Add("end", "02/01/2040")
+		postedData.Add("adults", e.adults)
+		postedData.Add("children", e.children)
+
+		req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostAvailability)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostAvailabilityFlexible(t *testing.T) {
+	var tests = []struct {
+		name               string
+		flexible           string
+		adults             string
+		expectedStatusCode int
+	}{
+		{"exact dates", "0", "1", http.StatusSeeOther},
+		{"flexible dates", "3", "1", http.StatusOK},
+		{"flexible dates for a party no room holds", "3", "3", http.StatusSeeOther},
+	}
+
+	for _, e := range tests {
+		// no room is available after 2049
+		postedData := url.Values{}
+		postedData.Add("start", "01/01/2050")
+		postedData.Add("end", "03/01/2050")
+		postedData.Add("flexible", e.flexible)
+		postedData.Add("adults", e.adults)
+
+		req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostAvailability)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AvailabilityJSONFlexible(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("start", "01/01/2050")
+	postedData.Add("end", "02/01/2050")
+	postedData.Add("room_id", "1")
+	postedData.Add("flexible", "3")
+
+	req, _ := http.NewRequest("POST", "/search-availability-json", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.AvailabilityJSON)
+	handler.ServeHTTP(rr, req)
+
+	var j jsonResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &j)
+	if err != nil {
+		t.Fatal("failed to parse json!")
+	}
+
+	if j.Ok {
+		t.Error("Got availability when none was expected in AvailabilityJSON")
+	}
+	if len(j.Alternatives) != 1 || j.Alternatives[0].Offset != 1 {
+		t.Errorf("expected the next day as the alternative, got %+v", j.Alternatives)
+	}
+}
+
+func TestRepository_RoomAvailabilityJSON(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		query              string
+		expectedStatusCode int
+		expectedDays       int
+	}{
+		{"month", "1", "y=2050&m=2", http.StatusOK, 28},
+		{"current month", "1", "", http.StatusOK, 0},
+		{"unknown room", "3", "y=2050&m=2", http.StatusNotFound, 0},
+		{"invalid room", "x", "", http.StatusBadRequest, 0},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/rooms/"+e.id+"/availability.json?"+e.query, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.RoomAvailabilityJSON)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		var j monthAvailabilityResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &j); err != nil {
+			t.Errorf("%s: failed to parse json", e.name)
+			continue
+		}
+		if e.expectedDays > 0 && (len(j.Days) != e.expectedDays || !j.Days[0].Available) {
+			t.Errorf("%s: expected %d available days, got %+v", e.name, e.expectedDays, j.Days)
+		}
+	}
+}
+
 func TestRepository_AvailabilityJSON(t *testing.T) {
 	/*****************************************
 	// first case -- rooms are not available
@@ -936,6 +1109,1612 @@ func TestRepository_BookRoom(t *testing.T) {
 	}
 }
 
+func TestRepository_AdminPostReservationMessage(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		kind               string
+		subject            string
+		body               string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"note", "1", model.MessageNote, "", "Late arrival", http.StatusSeeOther, "/admin/reservations/all/1#messages"},
+		{"email", "1", model.MessageEmail, "Your arrival", "See you soon", http.StatusSeeOther, "/admin/reservations/all/1#messages"},
+		{"email without subject", "1", model.MessageEmail, "", "See you soon", http.StatusOK, ""},
+		{"blank message", "1", model.MessageNote, "", "   ", http.StatusOK, ""},
+		{"unknown kind", "1", "sms", "", "See you soon", http.StatusOK, ""},
+		{"guest without email", "2", model.MessageEmail, "Your arrival", "See you soon", http.StatusOK, ""},
+		{"database error", "2", model.MessageNote, "", "Late arrival", http.StatusInternalServerError, ""},
+		{"no reservation", "3", model.MessageNote, "", "Late arrival", http.StatusInternalServerError, ""},
+		{"invalid id", "x", model.MessageNote, "", "Late arrival", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("kind", e.kind)
+		postedData.Add("subject", e.subject)
+		postedData.Add("body", e.body)
+
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/"+e.id+"/messages", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostReservationMessage)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		// the page comes back with the thread and what was typed
+		if e.expectedStatusCode == http.StatusOK {
+			for _, s := range []string{"Late arrival, around 11pm", "Email to john@smith.com", e.body} {
+				if !strings.Contains(rr.Body.String(), s) {
+					t.Errorf("%s: expected %q on the page", e.name, s)
+				}
+			}
+		}
+	}
+}
+
+func TestRepository_AdminUpdateReservationStatus(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		status             string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"valid transition", "1", model.StatusConfirmed, http.StatusSeeOther, "/admin/reservations/new/1"},
+		{"cancel", "1", model.StatusCancelled, http.StatusSeeOther, "/admin/reservations/new/1"},
+		{"illegal transition", "1", model.StatusCheckedOut, http.StatusSeeOther, "/admin/reservations/new/1"},
+		{"unknown status", "1", "bogus", http.StatusSeeOther, "/admin/reservations/new/1"},
+		{"database error", "3", model.StatusConfirmed, http.StatusInternalServerError, ""},
+		{"invalid id", "x", model.StatusConfirmed, http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("status", e.status)
+
+		req, _ := http.NewRequest("POST", "/admin/reservation-status/new/"+e.id, strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "new")
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminUpdateReservationStatus)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestRepository_AdminTrash(t *testing.T) {
+	var tests = []struct {
+		name               string
+		handler            http.HandlerFunc
+		id                 string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"delete", Repo.AdminDeleteReservation, "1", http.StatusSeeOther, "/admin/reservations-all"},
+		{"delete error", Repo.AdminDeleteReservation, "3", http.StatusInternalServerError, ""},
+		{"restore", Repo.AdminRestoreReservation, "1", http.StatusSeeOther, "/admin/reservations-all"},
+		{"restore room taken", Repo.AdminRestoreReservation, "2", http.StatusSeeOther, "/admin/reservations-trash"},
+		{"restore error", Repo.AdminRestoreReservation, "3", http.StatusInternalServerError, ""},
+		{"purge", Repo.AdminPurgeReservation, "1", http.StatusSeeOther, "/admin/reservations-trash"},
+		{"purge invalid id", Repo.AdminPurgeReservation, "x", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/", nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestRepository_AdminAuditLog(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/audit?entity=reservation&action=update&from=2024-01-01&q=john", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.AdminAuditLog)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminAuditLog returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_AdminPostReservationsCalendar(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("y", "2050")
+	postedData.Add("m", "1")
+	postedData.Add("add_block_1_2050-01-2", "1")
+
+	req, _ := http.NewRequest("POST", "/admin/reservations-calendar", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	session.Put(ctx, "block_map_1", map[string]int{"2050-01-1": 5})
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.AdminPostReservationsCalendar)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostReservationsCalendar returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	actualLoc, _ := rr.Result().Location()
+	if actualLoc.String() != "/admin/reservations-calendar?y=2050&m=1" {
+		t.Errorf("AdminPostReservationsCalendar redirected to wrong location: %s", actualLoc.String())
+	}
+	if msg := session.GetString(ctx, "error"); msg != "" {
+		t.Errorf("AdminPostReservationsCalendar reported an error for a free night: %q", msg)
+	}
+
+	// room 2 has been booked since the calendar was shown
+	postedData = url.Values{}
+	postedData.Add("y", "2050")
+	postedData.Add("m", "1")
+	postedData.Add("add_block_2_2050-01-2", "1")
+
+	req, _ = http.NewRequest("POST", "/admin/reservations-calendar", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostReservationsCalendar returned wrong response code for a booked night: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if msg := session.GetString(ctx, "error"); !strings.Contains(msg, "2050-01-02") {
+		t.Errorf("AdminPostReservationsCalendar should report the booked night, got %q", msg)
+	}
+}
+
+func TestRepository_AdminPostShowReservation(t *testing.T) {
+	var tests = []struct {
+		name               string
+		startDate          string
+		endDate            string
+		roomID             string
+		expectedStatusCode int
+	}{
+		{"move dates", "2050-01-01", "2050-01-03", "1", http.StatusSeeOther},
+		{"departure before arrival", "2050-01-03", "2050-01-01", "1", http.StatusOK},
+		{"invalid date", "invalid", "2050-01-01", "1", http.StatusOK},
+		{"room unavailable", "2050-01-01", "2050-01-03", "2", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "123456789")
+		postedData.Add("start_date", e.startDate)
+		postedData.Add("end_date", e.endDate)
+		postedData.Add("room_id", e.roomID)
+
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1", strings.NewReader(postedData.Encode()))
+		req.RequestURI = "/admin/reservations/all/1"
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostShowReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_repriceReservation(t *testing.T) {
+	res := model.Reservation{
+		StartDate:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Adults:      1,
+		Room:        model.Room{NightlyRate: 15000},
+		PromotionID: 1,
+		PromoCode:   "SAVE10",
+		Discount:    1500,
+	}
+
+	err := Repo.repriceReservation(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Discount != 3000 {
+		t.Errorf("expected 10%% off the two nights, got a discount of %d", res.Discount)
+	}
+	if len(res.Taxes) != 2 || res.TaxTotal() != 500 {
+		t.Errorf("expected the city tax of the two nights on top, got %d from %+v", res.TaxTotal(), res.Taxes)
+	}
+
+	// a promotion deleted since the booking leaves the discount as it was, whether the reservation
+	// still points at it or the delete already cleared its promotion
+	res.PromoCode = "DELETED"
+	err = Repo.repriceReservation(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Discount != 3000 {
+		t.Errorf("expected the discount of a deleted promotion to stay 3000, got %d", res.Discount)
+	}
+
+	res.PromotionID, res.PromoCode = 0, ""
+	err = Repo.repriceReservation(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Discount != 3000 {
+		t.Errorf("expected the discount of a deleted promotion to stay 3000, got %d", res.Discount)
+	}
+
+	// without a promotion there is nothing to take off
+	res.Discount = 0
+	err = Repo.repriceReservation(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Discount != 0 {
+		t.Errorf("expected no discount without a promotion, got %d", res.Discount)
+	}
+}
+
+func TestRepository_AdminPostCreateReservation(t *testing.T) {
+	var tests = []struct {
+		name               string
+		roomID             string
+		email              string
+		sendEmail          string
+		source             string
+		expectedStatusCode int
+	}{
+		{"phone booking", "1", "john@smith.com", "1", model.SourcePhone, http.StatusSeeOther},
+		{"walk-in without email", "1", "", "", model.SourceWalkIn, http.StatusSeeOther},
+		{"email requested but missing", "1", "", "1", model.SourcePhone, http.StatusOK},
+		{"invalid source", "1", "", "", "fax", http.StatusOK},
+		{"room taken", "2", "", "", model.SourcePhone, http.StatusOK},
+		{"blocked guest", "1", "blocked@here.com", "", model.SourcePhone, http.StatusOK},
+		{"unknown room", "3", "", "", model.SourcePhone, http.StatusOK},
+		{"database error", "1", "error@here.com", "", model.SourcePhone, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", e.email)
+		postedData.Add("start_date", "2050-01-01")
+		postedData.Add("end_date", "2050-01-03")
+		postedData.Add("room_id", e.roomID)
+		postedData.Add("source", e.source)
+		postedData.Add("send_email", e.sendEmail)
+
+		req, _ := http.NewRequest("POST", "/admin/reservations-create", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostCreateReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostReservationBlockedGuest(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("start_date", "01/01/2050")
+	postedData.Add("end_date", "02/01/2050")
+	postedData.Add("first_name", "John")
+	postedData.Add("last_name", "Smith")
+	postedData.Add("email", "blocked@here.com")
+	postedData.Add("phone", "123456789")
+	postedData.Add("room_id", "1")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+
+	actualLoc, _ := rr.Result().Location()
+	if rr.Code != http.StatusSeeOther || actualLoc.String() != "/contact" {
+		t.Errorf("PostReservation for a blocked guest: got %d to %s, wanted %d to /contact", rr.Code, actualLoc, http.StatusSeeOther)
+	}
+}
+
+func TestRepository_AdminGuests(t *testing.T) {
+	var tests = []struct {
+		name               string
+		method             string
+		handler            http.HandlerFunc
+		id                 string
+		firstName          string
+		expectedStatusCode int
+	}{
+		{"list", "GET", Repo.AdminGuests, "", "", http.StatusOK},
+		{"show", "GET", Repo.AdminShowGuest, "1", "", http.StatusOK},
+		{"show missing guest", "GET", Repo.AdminShowGuest, "3", "", http.StatusInternalServerError},
+		{"save", "POST", Repo.AdminPostShowGuest, "1", "John", http.StatusSeeOther},
+		{"save without name", "POST", Repo.AdminPostShowGuest, "1", "", http.StatusOK},
+		{"save missing guest", "POST", Repo.AdminPostShowGuest, "3", "John", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", e.firstName)
+		postedData.Add("last_name", "Smith")
+		postedData.Add("notes", "prefers a quiet room")
+		postedData.Add("vip", "1")
+
+		req, _ := http.NewRequest(e.method, "/admin/guests/"+e.id, strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_GuestAccounts(t *testing.T) {
+	var tests = []struct {
+		name               string
+		handler            http.HandlerFunc
+		postedData         url.Values
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"register", Repo.PostGuestRegister, url.Values{
+			"first_name": {"John"}, "last_name": {"Smith"}, "email": {"john@smith.com"},
+		}, http.StatusSeeOther, "/guest/login"},
+		{"register without email", Repo.PostGuestRegister, url.Values{
+			"first_name": {"John"}, "last_name": {"Smith"},
+		}, http.StatusOK, ""},
+		{"register existing account", Repo.PostGuestRegister, url.Values{
+			"first_name": {"John"}, "last_name": {"Smith"}, "email": {"exists@here.com"},
+		}, http.StatusOK, ""},
+		{"login", Repo.PostGuestLogin, url.Values{
+			"email": {"guest@here.com"}, "password": {"password"},
+		}, http.StatusSeeOther, "/guest/bookings"},
+		{"login with wrong password", Repo.PostGuestLogin, url.Values{
+			"email": {"guest@here.com"}, "password": {"wrong"},
+		}, http.StatusSeeOther, "/guest/login"},
+		{"login with invalid form", Repo.PostGuestLogin, url.Values{
+			"email": {"guest"},
+		}, http.StatusOK, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/guest", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestRepository_GuestConfirm(t *testing.T) {
+	var tests = []struct {
+		name               string
+		method             string
+		handler            http.HandlerFunc
+		token              string
+		postedData         url.Values
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"show", "GET", Repo.GuestConfirm, "valid", nil, http.StatusOK, ""},
+		{"show expired link", "GET", Repo.GuestConfirm, "expired", nil, http.StatusSeeOther, "/guest/register"},
+		{"confirm", "POST", Repo.PostGuestConfirm, "valid", url.Values{
+			"password": {"password"}, "password_confirm": {"password"},
+		}, http.StatusSeeOther, "/guest/bookings"},
+		{"confirm with mismatched passwords", "POST", Repo.PostGuestConfirm, "valid", url.Values{
+			"password": {"password"}, "password_confirm": {"other"},
+		}, http.StatusOK, ""},
+		{"confirm with short password", "POST", Repo.PostGuestConfirm, "valid", url.Values{
+			"password": {"short"}, "password_confirm": {"short"},
+		}, http.StatusOK, ""},
+		{"confirm expired link", "POST", Repo.PostGuestConfirm, "expired", url.Values{
+			"password": {"password"}, "password_confirm": {"password"},
+		}, http.StatusSeeOther, "/guest/register"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, "/guest/confirm/"+e.token, strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", e.token)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+		if e.name == "confirm" && session.GetInt(ctx, "guest_id") != 1 {
+			t.Errorf("%s: expected the guest to be logged in", e.name)
+		}
+	}
+}
+
+func TestRepository_GuestLogout(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/guest/logout", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	session.Put(ctx, "guest_id", 1)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.GuestLogout)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("GuestLogout returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if session.Exists(ctx, "guest_id") {
+		t.Error("GuestLogout should log the guest out")
+	}
+}
+
+func TestRepository_GuestBookings(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/guest/bookings", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	session.Put(ctx, "guest_id", 1)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.GuestBookings)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("GuestBookings returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_GuestCancelReservation(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"own reservation", "1", http.StatusSeeOther, "/guest/bookings"},
+		{"someone else's reservation", "2", http.StatusNotFound, ""},
+		{"database error", "3", http.StatusInternalServerError, ""},
+		{"invalid id", "x", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/guest/bookings/"+e.id+"/cancel", nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		session.Put(ctx, "guest_id", 1)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.GuestCancelReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestRepository_PostReservationRatePlan(t *testing.T) {
+	var tests = []struct {
+		name               string
+		ratePlanID         string
+		expectedStatusCode int
+	}{
+		{"known rate plan", "2", http.StatusSeeOther},
+		{"unknown rate plan", "9", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("start_date", "01/01/2050")
+		postedData.Add("end_date", "02/01/2050")
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "123456789")
+		postedData.Add("room_id", "1")
+		postedData.Add("rate_plan_id", e.ratePlanID)
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		putHold(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostReservationPromoCode(t *testing.T) {
+	var tests = []struct {
+		name               string
+		code               string
+		email              string
+		expectedStatusCode int
+	}{
+		{"no code", "", "jane@smith.com", http.StatusSeeOther},
+		{"valid code", "save10", "jane@smith.com", http.StatusSeeOther},
+		{"malformed code", "10%", "jane@smith.com", http.StatusOK},
+		{"unknown code", "BOGUS", "jane@smith.com", http.StatusOK},
+		{"expired code", "EXPIRED", "jane@smith.com", http.StatusOK},
+		{"code already used by the guest", "ONCE", "john@smith.com", http.StatusOK},
+		{"code used up while booking", "ONCE", "jane@smith.com", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("start_date", "01/01/2050")
+		postedData.Add("end_date", "02/01/2050")
+		postedData.Add("first_name", "Jane")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", e.email)
+		postedData.Add("phone", "123456789")
+		postedData.Add("room_id", "1")
+		postedData.Add("promo_code", e.code)
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		putHold(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session.Put(ctx, "reservation", model.Reservation{Room: model.Room{NightlyRate: 10000}})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.code == "save10" {
+			res, _ := session.Get(ctx, "reservation").(model.Reservation)
+			if res.PromoCode != "SAVE10" || res.Discount != 1000 {
+				t.Errorf("%s: expected a discount of 1000 for SAVE10, got %d for %q", e.name, res.Discount, res.PromoCode)
+			}
+		}
+		if e.name == "code used up while booking" {
+			res, _ := session.Get(ctx, "reservation").(model.Reservation)
+			if res.ID != 0 || res.Discount != 0 || !session.Exists(ctx, "hold_id") {
+				t.Errorf("%s: expected the form back without a discount and with the hold kept, got %+v", e.name, res)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPromotions(t *testing.T) {
+	var tests = []struct {
+		name               string
+		method             string
+		handler            http.HandlerFunc
+		id                 string
+		postedData         url.Values
+		expectedStatusCode int
+	}{
+		{"list", "GET", Repo.AdminPromotions, "", nil, http.StatusOK},
+		{"add percentage", "POST", Repo.AdminPostPromotion, "", url.Values{
+			"code": {"summer10"}, "discount_type": {"percent"}, "amount": {"10"},
+			"valid_from": {"2050-06-01"}, "valid_to": {"2050-08-31"}, "max_uses_per_guest": {"1"},
+		}, http.StatusSeeOther},
+		{"add fixed", "POST", Repo.AdminPostPromotion, "", url.Values{
+			"code": {"WELCOME"}, "discount_type": {"fixed"}, "amount": {"20.50"}, "room_id": {"1"},
+		}, http.StatusSeeOther},
+		{"code taken", "POST", Repo.AdminPostPromotion, "", url.Values{
+			"code": {"TAKEN"}, "discount_type": {"percent"}, "amount": {"10"},
+		}, http.StatusOK},
+		{"percentage above 100", "POST", Repo.AdminPostPromotion, "", url.Values{
+			"code": {"FREE"}, "discount_type": {"percent"}, "amount": {"150"},
+		}, http.StatusOK},
+		{"expires before it starts", "POST", Repo.AdminPostPromotion, "", url.Values{
+			"code": {"BACKWARDS"}, "discount_type": {"percent"}, "amount": {"10"},
+			"valid_from": {"2050-06-01"}, "valid_to": {"2050-05-01"},
+		}, http.StatusOK},
+		{"delete", "POST", Repo.AdminDeletePromotion, "1", nil, http.StatusSeeOther},
+		{"delete database error", "POST", Repo.AdminDeletePromotion, "3", nil, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, "/admin/promotions", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminTaxRules(t *testing.T) {
+	var tests = []struct {
+		name               string
+		method             string
+		handler            http.HandlerFunc
+		id                 string
+		postedData         url.Values
+		expectedStatusCode int
+	}{
+		{"list", "GET", Repo.AdminTaxRules, "", nil, http.StatusOK},
+		{"add percentage", "POST", Repo.AdminPostTaxRule, "", url.Values{
+			"name": {"VAT"}, "kind": {"percent"}, "amount": {"7.5"}, "inclusive": {"1"},
+		}, http.StatusSeeOther},
+		{"add fee", "POST", Repo.AdminPostTaxRule, "", url.Values{
+			"name": {"City tax"}, "kind": {"per_person_night"}, "amount": {"2.50"},
+		}, http.StatusSeeOther},
+		{"missing name", "POST", Repo.AdminPostTaxRule, "", url.Values{
+			"kind": {"per_night"}, "amount": {"5"},
+		}, http.StatusOK},
+		{"unknown kind", "POST", Repo.AdminPostTaxRule, "", url.Values{
+			"name": {"Resort fee"}, "kind": {"per_stay"}, "amount": {"5"},
+		}, http.StatusOK},
+		{"percentage above 100", "POST", Repo.AdminPostTaxRule, "", url.Values{
+			"name": {"VAT"}, "kind": {"percent"}, "amount": {"150"},
+		}, http.StatusOK},
+		{"delete", "POST", Repo.AdminDeleteTaxRule, "1", nil, http.StatusSeeOther},
+		{"delete database error", "POST", Repo.AdminDeleteTaxRule, "3", nil, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, "/admin/taxes", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminCurrencies(t *testing.T) {
+	var tests = []struct {
+		name               string
+		method             string
+		handler            http.HandlerFunc
+		id                 string
+		postedData         url.Values
+		expectedStatusCode int
+	}{
+		{"list", "GET", Repo.AdminCurrencies, "", nil, http.StatusOK},
+		{"add", "POST", Repo.AdminPostCurrency, "", url.Values{"currency": {"brl"}, "rate": {"5.12"}}, http.StatusSeeOther},
+		{"update", "POST", Repo.AdminPostCurrency, "", url.Values{"currency": {"EUR"}, "rate": {"0.93"}}, http.StatusSeeOther},
+		{"invalid code", "POST", Repo.AdminPostCurrency, "", url.Values{"currency": {"EURO"}, "rate": {"0.93"}}, http.StatusOK},
+		{"base currency", "POST", Repo.AdminPostCurrency, "", url.Values{"currency": {"USD"}, "rate": {"1"}}, http.StatusOK},
+		{"zero rate", "POST", Repo.AdminPostCurrency, "", url.Values{"currency": {"JPY"}, "rate": {"0"}}, http.StatusOK},
+		{"delete", "POST", Repo.AdminDeleteCurrency, "1", nil, http.StatusSeeOther},
+		{"delete database error", "POST", Repo.AdminDeleteCurrency, "3", nil, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, "/admin/currencies", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostCurrency(t *testing.T) {
+	var tests = []struct {
+		name             string
+		currency         string
+		referer          string
+		expectedCurrency string
+		expectedLocation string
+	}{
+		{"offered currency", "eur", "http://localhost:8080/checkout", "EUR", "/checkout"},
+		{"base currency", "USD", "http://localhost:8080/reservation-summary", "", "/reservation-summary"},
+		{"currency not offered", "BRL", "", "", "/"},
+		{"other site", "GBP", "https://example.com/phish?x=1", "GBP", "/phish?x=1"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{"currency": {e.currency}}
+		req, _ := http.NewRequest("POST", "/currency", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Referer", e.referer)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostCurrency)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected code %d, got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		if got := rr.Header().Get("Location"); got != e.expectedLocation {
+			t.Errorf("%s: expected redirect to %s, got %s", e.name, e.expectedLocation, got)
+		}
+		if got := session.GetString(ctx, "currency"); got != e.expectedCurrency {
+			t.Errorf("%s: expected display currency %q, got %q", e.name, e.expectedCurrency, got)
+		}
+	}
+}
+
+func TestRepository_AdminExportReservations(t *testing.T) {
+	var tests = []struct {
+		name                string
+		src                 string
+		query               string
+		expectedStatusCode  int
+		expectedContentType string
+		expectedInBody      []string
+		notExpectedInBody   []string
+	}{
+		{"csv", "all", "format=csv", http.StatusOK, "text/csv; charset=utf-8",
+			[]string{"ID,First Name,Last Name", "1,John,Smith,john@smith.com,,General's Quarters,2050-01-01,2050-01-03,2,2,0,Confirmed,Web,,300.00,0.00,10.00,310.00,0.00,USD", "Jane"}, nil},
+		{"csv filtered by status", "all", "format=csv&status=cancelled", http.StatusOK, "text/csv; charset=utf-8",
+			[]string{"Jane,Doe", "Cancelled,Phone,,200.00,0.00,0.00,200.00,100.00,USD"}, []string{"John"}},
+		{"excel", "new", "format=xlsx", http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", []string{"PK"}, nil},
+		{"unknown format", "all", "format=pdf", http.StatusBadRequest, "", nil, nil},
+		{"unknown list", "trash", "format=csv", http.StatusNotFound, "", nil, nil},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/reservations-export/"+e.src+"?"+e.query, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", e.src)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminExportReservations)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedContentType != "" && rr.Header().Get("Content-Type") != e.expectedContentType {
+			t.Errorf("%s: expected content type %s, got %s", e.name, e.expectedContentType, rr.Header().Get("Content-Type"))
+		}
+		for _, s := range e.expectedInBody {
+			if !strings.Contains(rr.Body.String(), s) {
+				t.Errorf("%s: expected %q in the export", e.name, s)
+			}
+		}
+		for _, s := range e.notExpectedInBody {
+			if strings.Contains(rr.Body.String(), s) {
+				t.Errorf("%s: didn't expect %q in the export", e.name, s)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPostImport(t *testing.T) {
+	validFile := "type,room,start_date,end_date,first_name,last_name,email\n" +
+		"reservation,1,2050-01-01,2050-01-03,John,Smith,john@smith.com\n" +
+		"block,General's Quarters,2050-01-03,2050-01-04,,,\n"
+
+	var tests = []struct {
+		name               string
+		file               string
+		dryRun             bool
+		expectedStatusCode int
+		expectedInBody     string
+	}{
+		{"dry run", validFile, true, http.StatusOK, "1 reservations and 1 blocks can be imported"},
+		{"import", validFile, false, http.StatusSeeOther, ""},
+		{"invalid line", "room,start_date,end_date,first_name,last_name,email\n9,2050-01-01,2050-01-03,John,Smith,john@smith.com\n", false, http.StatusOK, "no room &#34;9&#34;"},
+		{"missing column", "room,start_date\n1,2050-01-01\n", true, http.StatusOK, "missing column end_date"},
+		{"no file", "", true, http.StatusOK, "choose a CSV file"},
+	}
+
+	for _, e := range tests {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		if e.dryRun {
+			_ = mw.WriteField("dry_run", "1")
+		}
+		if e.file != "" {
+			fw, _ := mw.CreateFormFile("file", "reservations.csv")
+			_, _ = fw.Write([]byte(e.file))
+		}
+		_ = mw.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/import", body)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostImport)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedInBody != "" && !strings.Contains(rr.Body.String(), e.expectedInBody) {
+			t.Errorf("%s: expected %q in the page", e.name, e.expectedInBody)
+		}
+	}
+}
+
+func TestRepository_AdminDashboard(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/dashboard?from=2050-01-01&to=2050-02-28", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.AdminDashboard)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected code %d, got %d", http.StatusOK, rr.Code)
+	}
+	for _, s := range []string{"1.7%", "USD 300.00", "USD 150.00", "50.0%", "1 of 2 arrivals"} {
+		if !strings.Contains(rr.Body.String(), s) {
+			t.Errorf("expected %s on the dashboard", s)
+		}
+	}
+}
+
+func TestRepository_AdminReportJSON(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/reports/occupancy.json?from=2050-01-01&to=2050-02-28", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminReportOccupancyJSON).ServeHTTP(rr, req)
+
+	var occupancy occupancyResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &occupancy)
+	if err != nil {
+		t.Fatal("failed to parse json", err)
+	}
+	if !occupancy.Ok || !reflect.DeepEqual(occupancy.Months, []string{"2050-01", "2050-02"}) {
+		t.Errorf("unexpected occupancy months %v", occupancy.Months)
+	}
+	if len(occupancy.Rooms) != 2 || occupancy.Rooms[0].Occupancy[1] != 0 || occupancy.Total[0] != occupancy.Rooms[0].Occupancy[0]/2 {
+		t.Errorf("unexpected occupancy %+v", occupancy)
+	}
+
+	req, _ = http.NewRequest("GET", "/admin/reports/revenue.json?from=2050-01-01&to=2050-02-28", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminReportRevenueJSON).ServeHTTP(rr, req)
+
+	var revenue revenueResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &revenue)
+	if err != nil {
+		t.Fatal("failed to parse json", err)
+	}
+	if !reflect.DeepEqual(revenue.Revenue, []int64{30000, 0}) || !reflect.DeepEqual(revenue.ADR, []int64{15000, 0}) {
+		t.Errorf("unexpected revenue %+v", revenue)
+	}
+}
+
+func TestRepository_AdminFrontDesk(t *testing.T) {
+	var tests = []struct {
+		name             string
+		date             string
+		expectedContents []string
+	}{
+		{"arrival", "2050-01-01", []string{"Arrivals (1)", "John Smith", "Check In", "Dirty", "No departures", "No guests in house"}},
+		{"in house", "2050-01-02", []string{"No arrivals", "In House (1)", "John Smith"}},
+		{"departure", "2050-01-03", []string{"No arrivals", "Departures (1)", "John Smith"}},
+		{"cancelled", "2050-02-01", []string{"No arrivals", "No departures", "No guests in house"}},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/front-desk?date="+e.date, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminFrontDesk)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected code %d, got %d", e.name, http.StatusOK, rr.Code)
+		}
+		for _, s := range e.expectedContents {
+			if !strings.Contains(rr.Body.String(), s) {
+				t.Errorf("%s: expected %s on the board", e.name, s)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminFrontDeskJSON(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/front-desk.json?date=2050-01-01", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminFrontDeskJSON).ServeHTTP(rr, req)
+
+	var board frontDeskResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &board)
+	if err != nil {
+		t.Fatal("failed to parse json", err)
+	}
+	if !board.Ok || board.Date != "2050-01-01" {
+		t.Errorf("unexpected board %+v", board)
+	}
+	if len(board.Arrivals) != 1 || board.Arrivals[0].ID != 1 || !board.Arrivals[0].CanCheckIn || board.Arrivals[0].CanCheckOut ||
+		board.Arrivals[0].RoomStatus != model.RoomDirty {
+		t.Errorf("unexpected arrivals %+v", board.Arrivals)
+	}
+	if board.Departures == nil || len(board.Departures) != 0 || board.InHouse == nil || len(board.InHouse) != 0 {
+		t.Errorf("expected empty departures and in-house lists, got %+v and %+v", board.Departures, board.InHouse)
+	}
+}
+
+func TestRepository_AdminUpdateReservationStatusFromFrontDesk(t *testing.T) {
+	var tests = []struct {
+		name             string
+		date             string
+		status           string
+		expectedLocation string
+	}{
+		{"back to the day", "2050-01-01", model.StatusConfirmed, "/admin/front-desk?date=2050-01-01"},
+		{"illegal transition", "2050-01-01", model.StatusCheckedOut, "/admin/front-desk?date=2050-01-01"},
+		{"no date", "", model.StatusConfirmed, "/admin/front-desk"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("status", e.status)
+		postedData.Add("date", e.date)
+
+		req, _ := http.NewRequest("POST", "/admin/reservation-status/front-desk/1", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "front-desk")
+		rctx.URLParams.Add("id", "1")
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminUpdateReservationStatus)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected code %d, got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+	}
+}
+
+func TestRepository_AdminHousekeeping(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/housekeeping?date=2050-01-03", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.AdminHousekeeping)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected code %d, got %d", http.StatusOK, rr.Code)
+	}
+	for _, s := range []string{"Cleaning for 2050-01-03", "General&#39;s Quarters", "John Smith", "Dirty", "Mark Clean", "Mark Inspected"} {
+		if !strings.Contains(rr.Body.String(), s) {
+			t.Errorf("expected %s on the housekeeping page", s)
+		}
+	}
+}
+
+func TestRepository_AdminPostHousekeeping(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		status             string
+		date               string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"clean", "1", model.RoomClean, "2050-01-03", http.StatusSeeOther, "/admin/housekeeping?date=2050-01-03"},
+		{"dirty without date", "2", model.RoomDirty, "", http.StatusSeeOther, "/admin/housekeeping"},
+		{"unknown status", "1", "bogus", "2050-01-03", http.StatusSeeOther, "/admin/housekeeping?date=2050-01-03"},
+		{"database error", "3", model.RoomInspected, "", http.StatusInternalServerError, ""},
+		{"invalid id", "x", model.RoomClean, "", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("status", e.status)
+		postedData.Add("date", e.date)
+
+		req, _ := http.NewRequest("POST", "/admin/housekeeping/rooms/"+e.id, strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostHousekeeping)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestReportRange(t *testing.T) {
+	var tests = []struct {
+		name         string
+		query        string
+		expectedFrom string
+		expectedTo   string
+	}{
+		{"dates", "from=2050-01-01&to=2050-03-31", "2050-01-01", "2050-03-31"},
+		{"swapped", "from=2050-03-31&to=2050-01-01", "2050-01-01", "2050-03-31"},
+		{"too long", "from=2050-01-01&to=2060-01-01", "2050-01-01", "2054-12-31"},
+	}
+
+	for _, e := range tests {
+		q, _ := url.ParseQuery(e.query)
+		from, to := reportRange(q)
+		if from.Format("2006-01-02") != e.expectedFrom || to.Format("2006-01-02") != e.expectedTo {
+			t.Errorf("%s: expected %s to %s, got %s to %s", e.name, e.expectedFrom, e.expectedTo, from.Format("2006-01-02"), to.Format("2006-01-02"))
+		}
+	}
+
+	from, to := reportRange(url.Values{})
+	if from.Day() != 1 || to.AddDate(0, 0, 1).Day() != 1 || to.Sub(from) < 330*24*time.Hour {
+		t.Errorf("expected the last 12 months by default, got %s to %s", from, to)
+	}
+}
+
+func TestRepository_PostAvailabilityStayRules(t *testing.T) {
+	var tests = []struct {
+		name             string
+		start            string
+		end              string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"allowed stay", "06/03/2045", "09/03/2045", http.StatusOK, ""},
+		{"too short", "06/03/2045", "07/03/2045", http.StatusSeeOther, "/search-availability"},
+		{"closed to arrival", "04/03/2045", "08/03/2045", http.StatusSeeOther, "/search-availability"},
+		{"departure before arrival", "06/03/2045", "05/03/2045", http.StatusSeeOther, "/search-availability"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("start", e.start)
+		postedData.Add("end", e.end)
+
+		req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostAvailability)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatus, rr.Code)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestRepository_AdminStayRules(t *testing.T) {
+	var tests = []struct {
+		name               string
+		method             string
+		handler            http.HandlerFunc
+		id                 string
+		postedData         url.Values
+		expectedStatusCode int
+	}{
+		{"list", "GET", Repo.AdminStayRules, "", nil, http.StatusOK},
+		{"add", "POST", Repo.AdminPostStayRule, "", url.Values{
+			"name": {"High season"}, "season_start": {"2050-07-01"}, "season_end": {"2050-08-31"},
+			"min_nights": {"3"}, "closed_to_arrival": {"0", "6"},
+		}, http.StatusSeeOther},
+		{"add with season ending before it starts", "POST", Repo.AdminPostStayRule, "", url.Values{
+			"season_start": {"2050-07-01"}, "season_end": {"2050-06-01"},
+		}, http.StatusOK},
+		{"add with max below min", "POST", Repo.AdminPostStayRule, "", url.Values{
+			"min_nights": {"5"}, "max_nights": {"2"},
+		}, http.StatusOK},
+		{"delete", "POST", Repo.AdminDeleteStayRule, "1", nil, http.StatusSeeOther},
+		{"delete database error", "POST", Repo.AdminDeleteStayRule, "3", nil, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, "/admin/stay-rules", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostWaitlist(t *testing.T) {
+	var tests = []struct {
+		name               string
+		postedData         url.Values
+		expectedStatusCode int
+	}{
+		{"valid", url.Values{"start": {"01/01/2050"}, "end": {"03/01/2050"}, "room_id": {"1"}, "email": {"me@here.com"}}, http.StatusSeeOther},
+		{"invalid email", url.Values{"start": {"01/01/2050"}, "end": {"03/01/2050"}, "room_id": {"1"}, "email": {"me"}}, http.StatusOK},
+		{"departure before arrival", url.Values{"start": {"03/01/2050"}, "end": {"01/01/2050"}, "room_id": {"1"}, "email": {"me@here.com"}}, http.StatusOK},
+		{"unknown room", url.Values{"start": {"01/01/2050"}, "end": {"03/01/2050"}, "room_id": {"3"}, "email": {"me@here.com"}}, http.StatusOK},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/waitlist", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostWaitlist)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_WaitlistBook(t *testing.T) {
+	var tests = []struct {
+		name             string
+		token            string
+		expectedLocation string
+	}{
+		{"valid link", "valid", "/make-reservation"},
+		{"expired link", "expired", "/search-availability"},
+		{"used link", "used", "/search-availability"},
+		{"unknown link", "unknown", "/search-availability"},
+		{"room booked again", "taken", "/search-availability"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/waitlist/"+e.token, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", e.token)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.WaitlistBook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected code %d, got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+		if e.expectedLocation == "/make-reservation" {
+			res, ok := session.Get(ctx, "reservation").(model.Reservation)
+			if !ok || res.Email != "first@here.com" {
+				t.Errorf("%s: expected the reservation in the session for the waitlisted guest, got %+v", e.name, res)
+			}
+			if session.GetInt(ctx, "waitlist_id") != 1 {
+				t.Errorf("%s: expected the waitlist entry in the session", e.name)
+			}
+		}
+	}
+}
+
+func TestRepository_Checkout(t *testing.T) {
+	var tests = []struct {
+		name               string
+		method             string
+		handler            http.HandlerFunc
+		reservationID      int
+		postedData         url.Values
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"show", "GET", Repo.Checkout, 1, nil, http.StatusOK, ""},
+		{"show without reservation", "GET", Repo.Checkout, 0, nil, http.StatusTemporaryRedirect, "/"},
+		{"pay", "POST", Repo.PostCheckout, 1, url.Values{"card_name": {"John Smith"}, "card_number": {"4242 4242 4242 4242"}}, http.StatusSeeOther, "/reservation-summary"},
+		{"declined card", "POST", Repo.PostCheckout, 1, url.Values{"card_name": {"John Smith"}, "card_number": {payment.DeclinedCard}}, http.StatusOK, ""},
+		{"missing card", "POST", Repo.PostCheckout, 1, url.Values{"card_name": {"John Smith"}}, http.StatusOK, ""},
+		{"pay without reservation", "POST", Repo.PostCheckout, 0, nil, http.StatusTemporaryRedirect, "/"},
+		{"pay again", "POST", Repo.PostCheckout, 2, url.Values{"card_name": {"John Smith"}, "card_number": {"4242 4242 4242 4242"}}, http.StatusSeeOther, "/"},
+		{"pay for unknown reservation", "POST", Repo.PostCheckout, 3, url.Values{"card_name": {"John Smith"}, "card_number": {"4242 4242 4242 4242"}}, http.StatusTemporaryRedirect, "/"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, "/checkout", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if e.reservationID > 0 {
+			session.Put(ctx, "reservation", model.Reservation{
+				ID:        e.reservationID,
+				RoomID:    1,
+				StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+				EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+			})
+		}
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestRepository_PaymentWebhook(t *testing.T) {
+	provider := app.Payments.(*payment.Fake)
+
+	var tests = []struct {
+		name               string
+		payload            string
+		signed             bool
+		expectedStatusCode int
+	}{
+		{"captured", `{"status": "captured", "reference": "fake_1"}`, true, http.StatusOK},
+		{"not signed", `{"status": "captured", "reference": "fake_1"}`, false, http.StatusUnauthorized},
+		{"unknown status", `{"status": "lost", "reference": "fake_1"}`, true, http.StatusBadRequest},
+		{"unknown payment", `{"status": "captured", "reference": "unknown"}`, true, http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/payments/webhook", strings.NewReader(e.payload))
+		if e.signed {
+			req.Header.Set(payment.FakeSignatureHeader, provider.Sign([]byte(e.payload)))
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PaymentWebhook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminSettlePayment(t *testing.T) {
+	// a provider of its own, so its first authorization is the test repo payment 1
+	provider := app.Payments
+	defer func() { app.Payments = provider }()
+	app.Payments = payment.NewFake("secret")
+	_, err := app.Payments.Authorize(payment.Authorization{Amount: 15000, Source: "4242424242424242"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name               string
+		handler            http.HandlerFunc
+		id                 string
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"capture", Repo.AdminCapturePayment, "1", http.StatusSeeOther, "Payment captured"},
+		{"refund an authorized payment", Repo.AdminRefundPayment, "1", http.StatusSeeOther, ""},
+		{"capture a captured payment", Repo.AdminCapturePayment, "2", http.StatusSeeOther, ""},
+		{"unknown payment", Repo.AdminCapturePayment, "3", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/capture-payment/all/"+e.id, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q, got %q", e.name, e.expectedFlash, flash)
+		}
+	}
+}
+
+func TestSettleCancellation(t *testing.T) {
+	var tests = []struct {
+		name           string
+		status         string
+		provider       string
+		penalty        int64
+		expectedStatus string
+		expectedRefund int64
+		expectedError  bool
+	}{
+		{"authorized, penalty captured", payment.StatusAuthorized, "fake", 5000, payment.StatusCaptured, 10000, false},
+		{"authorized, no penalty", payment.StatusAuthorized, "fake", 0, payment.StatusVoided, 15000, false},
+		{"authorized, penalty over the amount", payment.StatusAuthorized, "fake", 20000, payment.StatusCaptured, 0, false},
+		{"captured, rest refunded", payment.StatusCaptured, "fake", 5000, payment.StatusRefunded, 10000, false},
+		{"captured, penalty kept", payment.StatusCaptured, "fake", 15000, payment.StatusCaptured, 0, false},
+		{"already refunded", payment.StatusRefunded, "fake", 0, "", 0, false},
+		{"another provider", payment.StatusAuthorized, "other", 0, "", 0, false},
+		{"unknown to the provider", payment.StatusAuthorized, "fake", 0, "", 0, true},
+	}
+
+	for _, e := range tests {
+		provider := payment.NewFake("secret")
+		reference := "unknown"
+		if !e.expectedError {
+			var err error
+			reference, err = provider.Authorize(payment.Authorization{Amount: 15000, Source: "4242424242424242"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.status == payment.StatusCaptured {
+				err = provider.Capture(reference, 15000)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		payments := []model.Payment{{ID: 1, Provider: e.provider, Reference: reference, Amount: 15000, Status: e.status}}
+
+		settled, refund, err := settleCancellation(provider, payments, e.penalty)
+		if (err != nil) != e.expectedError {
+			t.Errorf("%s: expected error %t, got %v", e.name, e.expectedError, err)
+		}
+		if refund != e.expectedRefund {
+			t.Errorf("%s: expected refund %d, got %d", e.name, e.expectedRefund, refund)
+		}
+		status := ""
+		if len(settled) > 0 {
+			status = settled[0].Status
+		}
+		if status != e.expectedStatus {
+			t.Errorf("%s: expected status %q, got %q", e.name, e.expectedStatus, status)
+		}
+	}
+}
+
+func TestRepository_ChooseRoomHold(t *testing.T) {
+	var tests = []struct {
+		name             string
+		roomID           string
+		expectedLocation string
+		expectedHold     bool
+	}{
+		{"room held", "1", "/make-reservation", true},
+		{"room held by someone else", "2", "/search-availability", false},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/choose-room/"+e.roomID, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.RequestURI = "/choose-room/" + e.roomID
+		session.Put(ctx, "reservation", model.Reservation{})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.ChooseRoom)
+		handler.ServeHTTP(rr, req)
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+		if held := session.GetInt(ctx, "hold_id") > 0; held != e.expectedHold {
+			t.Errorf("%s: expected hold %t, got %t", e.name, e.expectedHold, held)
+		}
+	}
+}
+
+func TestRepository_PostReservationExpiredHold(t *testing.T) {
+	// the hold ran out, so the room is only booked if no one else took it since
+	var tests = []struct {
+		name             string
+		roomID           string
+		expectedLocation string
+	}{
+		{"room still free", "1", "/checkout"},
+		{"room booked since", "2", "/search-availability"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{
+			"start_date": {"01/01/2050"},
+			"end_date":   {"02/01/2050"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"123456789"},
+			"room_id":    {e.roomID},
+		}
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session.Put(ctx, "hold_id", 1)
+		session.Put(ctx, "hold_until", time.Now().Add(-time.Minute).Unix())
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+		if session.Exists(ctx, "hold_id") {
+			t.Errorf("%s: expected the hold to be released", e.name)
+		}
+	}
+}
+
+// putHold gives the session a live hold, as choosing a room does
+func putHold(ctx context.Context) {
+	session.Put(ctx, "hold_id", 1)
+	session.Put(ctx, "hold_until", time.Now().Add(time.Minute).Unix())
+}
+
 func getCtx(req *http.Request) context.Context {
 	ctx, err := session.Load(req.Context(), req.Header.Get("X-Sesssion"))
 	if err != nil {
@@ -943,3 +2722,68 @@ func getCtx(req *http.Request) context.Context {
 	}
 	return ctx
 }
+
+func TestRepository_ReservationInvoice(t *testing.T) {
+	var tests = []struct {
+		name               string
+		invoiceID          int
+		expectedStatusCode int
+	}{
+		{"reservation just made", 1, http.StatusOK},
+		{"nothing in session", 0, http.StatusTemporaryRedirect},
+		{"database error", 3, http.StatusTemporaryRedirect},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/reservation-summary/invoice", nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		if e.invoiceID > 0 {
+			session.Put(ctx, "invoice_id", e.invoiceID)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.ReservationInvoice)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if rr.Code == http.StatusOK && rr.Header().Get("Content-Type") != "application/pdf" {
+			t.Errorf("%s: expected a PDF, got %s", e.name, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestRepository_AdminReservationInvoice(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		expectedStatusCode int
+	}{
+		{"invoice", "1", http.StatusOK},
+		{"database error", "3", http.StatusInternalServerError},
+		{"invalid id", "x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/reservations/all/"+e.id+"/invoice", nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminReservationInvoice)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if rr.Code == http.StatusOK && !strings.HasPrefix(rr.Body.String(), "%PDF-") {
+			t.Errorf("%s: expected a PDF body", e.name)
+		}
+	}
+}
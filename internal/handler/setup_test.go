@@ -14,6 +14,7 @@ import (
 	"github.com.br/Leodf/bookings/internal/config"
 	"github.com.br/Leodf/bookings/internal/helpers"
 	"github.com.br/Leodf/bookings/internal/model"
+	"github.com.br/Leodf/bookings/internal/payment"
 	"github.com.br/Leodf/bookings/internal/render"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
@@ -24,7 +25,19 @@ import (
 var app config.AppConfig
 var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
-var functions = template.FuncMap{}
+var functions = template.FuncMap{
+	"humanDate":         render.HumanDate,
+	"formatDate":        render.FormatDate,
+	"iterate":           render.Iterate,
+	"add":               render.Add,
+	"statusLabel":       model.StatusLabel,
+	"canTransition":     model.CanTransition,
+	"sourceLabel":       model.SourceLabel,
+	"housekeepingLabel": model.HousekeepingLabel,
+	"roomStatus":        model.RoomStatus,
+	"formatMoney":       render.FormatMoney,
+	"displayMoney":      render.DisplayMoney,
+}
 
 func TestMain(m *testing.M) {
 	// what am I going to put in the session
@@ -46,6 +59,7 @@ func TestMain(m *testing.M) {
 	session.Cookie.Secure = app.InProduction
 
 	app.Session = session
+	app.Payments = payment.NewFake("secret")
 
 	mailChan := make(chan model.MailData)
 	app.MailChan = mailChan
@@ -63,6 +77,9 @@ func TestMain(m *testing.M) {
 
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
+	if err := repo.LoadExchangeRates(); err != nil {
+		log.Fatal("Cannot load exchange rates")
+	}
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
 
@@ -92,12 +109,17 @@ func getRoutes() http.Handler {
 	mux.Post("/search-availability", Repo.PostAvailability)
 	mux.Post("/search-availability-json", Repo.AvailabilityJSON)
 
+	mux.Get("/waitlist", Repo.Waitlist)
+
 	mux.Get("/contact", Repo.Contact)
 
 	mux.Get("/make-reservation", Repo.Reservation)
 	mux.Post("/make-reservation", Repo.PostReservation)
 	mux.Get("/reservation-summary", Repo.ReservationSummary)
 
+	mux.Get("/guest/register", Repo.GuestRegister)
+	mux.Get("/guest/login", Repo.GuestLogin)
+
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 	return mux
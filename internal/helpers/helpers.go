@@ -30,3 +30,8 @@ func IsAuthenticated(r *http.Request) bool {
 	exists := app.Session.Exists(r.Context(), "user_id")
 	return exists
 }
+
+// IsGuestAuthenticated returns true if a guest account is logged in
+func IsGuestAuthenticated(r *http.Request) bool {
+	return app.Session.Exists(r.Context(), "guest_id")
+}
@@ -0,0 +1,342 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+	"github.com/asaskevich/govalidator"
+)
+
+// Kinds of line in an import file
+const (
+	KindReservation = "reservation"
+	KindBlock       = "block"
+)
+
+// Columns are the columns an import file can have, in any order. room, start_date and end_date are
+// required, room being the id or the name of the room. type defaults to reservation, blocks leave the
+// guest columns empty.
+var Columns = []string{
+	"type", "room", "start_date", "end_date", "first_name", "last_name", "email", "phone",
+	"adults", "children", "status", "source",
+}
+
+var requiredColumns = []string{"room", "start_date", "end_date"}
+
+// dateLayout is the format of the dates in an import file
+const dateLayout = "2006-01-02"
+
+// ErrMissingColumn is returned for a file without one of the required columns
+var ErrMissingColumn = errors.New("missing column")
+
+// Store is the part of the database an import uses
+type Store interface {
+	AllRooms() ([]model.Room, error)
+	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]model.RoomRestrictions, error)
+	ImportRestrictions(restrictions []model.RoomRestrictions) error
+}
+
+// LineError is a problem with a line of an import file, counting the header as line 1
+type LineError struct {
+	Line    int
+	Message string
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Report is the outcome of checking, and importing, a file
+type Report struct {
+	// Restrictions are the valid lines, reservations hold theirs in Reservation
+	Restrictions []model.RoomRestrictions
+	Errors       []LineError
+	Reservations int
+	Blocks       int
+	// Imported is true once the lines are in the database
+	Imported bool
+
+	// lines holds the line number of each restriction
+	lines []int
+}
+
+// Valid returns true if every line of the file can be imported
+func (r Report) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Run reads and checks the file in r and, unless dryRun is set or a line is invalid, imports all
+// of it. Either every line is imported or none is.
+func Run(db Store, r io.Reader, dryRun bool) (Report, error) {
+	rooms, err := db.AllRooms()
+	if err != nil {
+		return Report{}, err
+	}
+
+	report, err := Parse(r, rooms)
+	if err != nil {
+		return report, err
+	}
+
+	err = checkExisting(db, &report)
+	if err != nil {
+		return report, err
+	}
+
+	if dryRun || !report.Valid() || len(report.Restrictions) == 0 {
+		return report, nil
+	}
+
+	err = db.ImportRestrictions(report.Restrictions)
+	if err != nil {
+		return report, err
+	}
+	report.Imported = true
+	return report, nil
+}
+
+// Parse reads the lines of an import file, checking each on its own and against the lines before it.
+// The error is for a file that can't be read at all.
+func Parse(r io.Reader, rooms []model.Room) (Report, error) {
+	var report Report
+
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return report, fmt.Errorf("%w: the file is empty", ErrMissingColumn)
+	}
+	if err != nil {
+		return report, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredColumns {
+		if _, ok := columns[name]; !ok {
+			return report, fmt.Errorf("%w %s", ErrMissingColumn, name)
+		}
+	}
+
+	roomsByKey := make(map[string]model.Room)
+	for _, room := range rooms {
+		roomsByKey[strconv.Itoa(room.ID)] = room
+		roomsByKey[strings.ToLower(room.RoomName)] = room
+	}
+
+	// the lines already read for each room, to find the ones that overlap
+	byRoom := make(map[int][]int)
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				report.Errors = append(report.Errors, LineError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				continue
+			}
+			return report, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		rr, msg := parseLine(get, roomsByKey)
+		if msg == "" {
+			for _, i := range byRoom[rr.RoomID] {
+				other := report.Restrictions[i]
+				if rr.StartDate.Before(other.EndDate) && rr.EndDate.After(other.StartDate) {
+					msg = fmt.Sprintf("overlaps line %d", report.lines[i])
+					break
+				}
+			}
+		}
+		if msg != "" {
+			report.Errors = append(report.Errors, LineError{Line: line, Message: msg})
+			continue
+		}
+
+		byRoom[rr.RoomID] = append(byRoom[rr.RoomID], len(report.Restrictions))
+		report.Restrictions = append(report.Restrictions, rr)
+		report.lines = append(report.lines, line)
+		if rr.RestrictionID == model.RestrictionBlock {
+			report.Blocks++
+		} else {
+			report.Reservations++
+		}
+	}
+
+	return report, nil
+}
+
+// parseLine returns the restriction of a line, or why it is invalid
+func parseLine(get func(string) string, rooms map[string]model.Room) (model.RoomRestrictions, string) {
+	var rr model.RoomRestrictions
+
+	kind := strings.ToLower(get("type"))
+	if kind == "" {
+		kind = KindReservation
+	}
+	if kind != KindReservation && kind != KindBlock {
+		return rr, fmt.Sprintf("unknown type %q, use %s or %s", get("type"), KindReservation, KindBlock)
+	}
+
+	room, ok := rooms[strings.ToLower(get("room"))]
+	if !ok {
+		return rr, fmt.Sprintf("no room %q", get("room"))
+	}
+
+	start, err := time.Parse(dateLayout, get("start_date"))
+	if err != nil {
+		return rr, "start_date must be a date like 2006-01-02"
+	}
+	end, err := time.Parse(dateLayout, get("end_date"))
+	if err != nil {
+		return rr, "end_date must be a date like 2006-01-02"
+	}
+	if !end.After(start) {
+		return rr, "end_date must be after start_date"
+	}
+
+	rr.RoomID = room.ID
+	rr.Room = room
+	rr.StartDate = start
+	rr.EndDate = end
+
+	if kind == KindBlock {
+		rr.RestrictionID = model.RestrictionBlock
+		return rr, ""
+	}
+	rr.RestrictionID = model.RestrictionReservation
+
+	res := model.Reservation{
+		FirstName: get("first_name"),
+		LastName:  get("last_name"),
+		Email:     get("email"),
+		Phone:     get("phone"),
+		StartDate: start,
+		EndDate:   end,
+		RoomID:    room.ID,
+		Room:      room,
+		Status:    strings.ToLower(get("status")),
+		Source:    strings.ToLower(get("source")),
+		Adults:    1,
+		// they come from the old system, there's nothing for staff to process
+		Processed: 1,
+	}
+
+	switch {
+	case res.FirstName == "" || res.LastName == "":
+		return rr, "first_name and last_name are required"
+	case !govalidator.IsEmail(res.Email):
+		return rr, fmt.Sprintf("invalid email %q", res.Email)
+	}
+
+	if x := get("adults"); x != "" {
+		res.Adults, err = strconv.Atoi(x)
+		if err != nil || res.Adults < 1 {
+			return rr, "adults must be a number from 1"
+		}
+	}
+	if x := get("children"); x != "" {
+		res.Children, err = strconv.Atoi(x)
+		if err != nil || res.Children < 0 {
+			return rr, "children must be a number"
+		}
+	}
+	if room.MaxOccupancy > 0 && res.PartySize() > room.MaxOccupancy {
+		return rr, fmt.Sprintf("%s sleeps %d", room.RoomName, room.MaxOccupancy)
+	}
+
+	if res.Status == "" {
+		res.Status = model.StatusConfirmed
+	}
+	if !model.ValidStatus(res.Status) {
+		return rr, fmt.Sprintf("unknown status %q", get("status"))
+	}
+	if res.Source != "" && !model.ValidSource(res.Source) {
+		return rr, fmt.Sprintf("unknown source %q", get("source"))
+	}
+
+	rr.Reservation = res
+	return rr, ""
+}
+
+// checkExisting moves the restrictions of the report overlapping the ones already in their room
+// to its errors. It reads the restrictions of each room once, for the dates the file covers.
+func checkExisting(db Store, report *Report) error {
+	type span struct {
+		start, end time.Time
+	}
+	spans := make(map[int]span)
+	for _, rr := range report.Restrictions {
+		s, ok := spans[rr.RoomID]
+		if !ok || rr.StartDate.Before(s.start) {
+			s.start = rr.StartDate
+		}
+		if !ok || rr.EndDate.After(s.end) {
+			s.end = rr.EndDate
+		}
+		spans[rr.RoomID] = s
+	}
+
+	existing := make(map[int][]model.RoomRestrictions)
+	for roomID, s := range spans {
+		restrictions, err := db.GetRestrictionsForRoomByDate(roomID, s.start, s.end)
+		if err != nil {
+			return err
+		}
+		existing[roomID] = restrictions
+	}
+
+	var valid []model.RoomRestrictions
+	var validLines []int
+	for i, rr := range report.Restrictions {
+		overlaps := false
+		for _, other := range existing[rr.RoomID] {
+			if rr.StartDate.Before(other.EndDate) && rr.EndDate.After(other.StartDate) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			valid = append(valid, rr)
+			validLines = append(validLines, report.lines[i])
+			continue
+		}
+
+		report.Errors = append(report.Errors, LineError{Line: report.lines[i], Message: "the room is already taken for these dates"})
+		if rr.RestrictionID == model.RestrictionBlock {
+			report.Blocks--
+		} else {
+			report.Reservations--
+		}
+	}
+	report.Restrictions = valid
+	report.lines = validLines
+
+	sort.SliceStable(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+
+	return nil
+}
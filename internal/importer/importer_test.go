@@ -0,0 +1,170 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+// fakeStore has two rooms, the first taken from 2050-03-10 to 2050-03-12
+type fakeStore struct {
+	imported  []model.RoomRestrictions
+	importErr error
+}
+
+func (s *fakeStore) AllRooms() ([]model.Room, error) {
+	return []model.Room{
+		{ID: 1, RoomName: "General's Quarters", MaxOccupancy: 2},
+		{ID: 2, RoomName: "Major's Suite", MaxOccupancy: 4},
+	}, nil
+}
+
+func (s *fakeStore) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]model.RoomRestrictions, error) {
+	if roomID != 1 {
+		return nil, nil
+	}
+	return []model.RoomRestrictions{{
+		RoomID:    1,
+		StartDate: time.Date(2050, 3, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 3, 12, 0, 0, 0, 0, time.UTC),
+	}}, nil
+}
+
+func (s *fakeStore) ImportRestrictions(restrictions []model.RoomRestrictions) error {
+	if s.importErr != nil {
+		return s.importErr
+	}
+	s.imported = restrictions
+	return nil
+}
+
+const validFile = `type,room,start_date,end_date,first_name,last_name,email,phone,adults,children,status,source
+reservation,1,2050-01-01,2050-01-03,John,Smith,john@smith.com,555-1234,2,0,checked_out,phone
+,Major's Suite,2050-01-02,2050-01-05,Jane,Doe,jane@doe.com,,,,,
+block,general's quarters,2050-01-03,2050-01-04,,,,,,,,
+`
+
+func TestRun(t *testing.T) {
+	db := &fakeStore{}
+	report, err := Run(db, strings.NewReader(validFile), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.Valid() || !report.Imported {
+		t.Fatalf("expected the file to be imported, got errors %v", report.Errors)
+	}
+	if report.Reservations != 2 || report.Blocks != 1 {
+		t.Errorf("expected 2 reservations and 1 block, got %d and %d", report.Reservations, report.Blocks)
+	}
+	if len(db.imported) != 3 {
+		t.Fatalf("expected 3 restrictions imported, got %d", len(db.imported))
+	}
+
+	res := db.imported[0].Reservation
+	if res.Status != model.StatusCheckedOut || res.Source != model.SourcePhone || res.Adults != 2 || res.Processed != 1 {
+		t.Errorf("unexpected first reservation %+v", res)
+	}
+	if jane := db.imported[1].Reservation; jane.RoomID != 2 || jane.Status != model.StatusConfirmed || jane.Adults != 1 {
+		t.Errorf("expected the defaults for the second reservation, got %+v", jane)
+	}
+	if block := db.imported[2]; block.RestrictionID != model.RestrictionBlock || block.RoomID != 1 {
+		t.Errorf("expected a block of room 1, got %+v", block)
+	}
+}
+
+func TestRun_PendingReservationsAreNotSwept(t *testing.T) {
+	file := `type,room,start_date,end_date,first_name,last_name,email,phone,adults,children,status,source
+reservation,1,2050-01-01,2050-01-03,John,Smith,john@smith.com,,,,pending,
+`
+	db := &fakeStore{}
+	_, err := Run(db, strings.NewReader(file), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.imported) != 1 {
+		t.Fatalf("expected the reservation imported, got %d", len(db.imported))
+	}
+
+	// the sweeper only cancels the reservations whose online checkout was never paid
+	if res := db.imported[0].Reservation; res.Status != model.StatusPending || res.CheckoutAbandoned(time.Now().Add(time.Hour)) {
+		t.Errorf("expected the imported pending reservation to stay, got %+v", res)
+	}
+}
+
+func TestRun_DryRun(t *testing.T) {
+	db := &fakeStore{}
+	report, err := Run(db, strings.NewReader(validFile), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() || report.Imported || db.imported != nil {
+		t.Error("expected a dry run to check the file without importing it")
+	}
+	if report.Reservations != 2 || report.Blocks != 1 {
+		t.Errorf("expected 2 reservations and 1 block, got %d and %d", report.Reservations, report.Blocks)
+	}
+}
+
+func TestRun_InvalidLines(t *testing.T) {
+	file := `room,start_date,end_date,first_name,last_name,email,adults,status
+3,2050-01-01,2050-01-03,John,Smith,john@smith.com,,
+1,01/01/2050,2050-01-03,John,Smith,john@smith.com,,
+1,2050-01-03,2050-01-01,John,Smith,john@smith.com,,
+1,2050-01-01,2050-01-03,,Smith,john@smith.com,,
+1,2050-01-01,2050-01-03,John,Smith,not-an-email,,
+1,2050-01-01,2050-01-03,John,Smith,john@smith.com,3,
+1,2050-01-01,2050-01-03,John,Smith,john@smith.com,,lost
+1,2050-01-01,2050-01-03,John,Smith,john@smith.com,,
+1,2050-01-02,2050-01-04,Jane,Doe,jane@doe.com,,
+1,2050-03-11,2050-03-13,Jane,Doe,jane@doe.com,,
+`
+	db := &fakeStore{}
+	report, err := Run(db, strings.NewReader(file), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported || db.imported != nil {
+		t.Error("imported a file with invalid lines")
+	}
+
+	expected := []LineError{
+		{2, `no room "3"`},
+		{3, "start_date must be a date like 2006-01-02"},
+		{4, "end_date must be after start_date"},
+		{5, "first_name and last_name are required"},
+		{6, `invalid email "not-an-email"`},
+		{7, "General's Quarters sleeps 2"},
+		{8, `unknown status "lost"`},
+		{10, "overlaps line 9"},
+		{11, "the room is already taken for these dates"},
+	}
+	if len(report.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), report.Errors)
+	}
+	for i, e := range expected {
+		if report.Errors[i] != e {
+			t.Errorf("expected %v, got %v", e, report.Errors[i])
+		}
+	}
+	if report.Reservations != 1 {
+		t.Errorf("expected 1 valid reservation, got %d", report.Reservations)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	if _, err := Run(&fakeStore{}, strings.NewReader(""), true); !errors.Is(err, ErrMissingColumn) {
+		t.Errorf("expected a missing column error for an empty file, got %v", err)
+	}
+	if _, err := Run(&fakeStore{}, strings.NewReader("room,start_date\n1,2050-01-01\n"), true); !errors.Is(err, ErrMissingColumn) {
+		t.Errorf("expected a missing column error, got %v", err)
+	}
+
+	importErr := errors.New("room taken")
+	if _, err := Run(&fakeStore{importErr: importErr}, strings.NewReader(validFile), false); !errors.Is(err, importErr) {
+		t.Errorf("expected the import error, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package invoice
+
+import (
+	"fmt"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+	"github.com.br/Leodf/bookings/internal/payment"
+	"github.com.br/Leodf/bookings/internal/pdf"
+	"github.com.br/Leodf/bookings/internal/render"
+)
+
+// Issuer is the business named on the invoices
+const Issuer = "Fort Smythe Bed and Breakfast"
+
+// Line is an amount charged, or taken off when negative
+type Line struct {
+	Description string
+	// Amount is in cents
+	Amount int64
+	// Included lines are part of other lines, like taxes included in the rate, so they don't add up
+	Included bool
+}
+
+// Invoice is what a guest is charged for a reservation and what they paid
+type Invoice struct {
+	Number      string
+	IssuedAt    time.Time
+	Reservation model.Reservation
+	Lines       []Line
+	Taxes       []Line
+	Payments    []model.Payment
+	Currency    string
+}
+
+// New returns the invoice of res: a line per night and the discount, or only the penalty of a cancelled reservation
+func New(res model.Reservation, payments []model.Payment, issuedAt time.Time) Invoice {
+	inv := Invoice{
+		Number:      Number(res.ID),
+		IssuedAt:    issuedAt,
+		Reservation: res,
+		Payments:    payments,
+		Currency:    payment.Currency,
+	}
+
+	if res.Status == model.StatusCancelled {
+		if res.CancellationPenalty > 0 {
+			inv.Lines = append(inv.Lines, Line{Description: "Cancellation penalty", Amount: res.CancellationPenalty})
+		}
+		return inv
+	}
+
+	for night := res.StartDate; night.Before(res.EndDate); night = night.AddDate(0, 0, 1) {
+		inv.Lines = append(inv.Lines, Line{
+			Description: fmt.Sprintf("%s, night of %s", res.Room.RoomName, night.Format("02/01/2006")),
+			Amount:      int64(res.Room.NightlyRate),
+		})
+	}
+	if res.Discount > 0 {
+		description := "Discount"
+		if res.PromoCode != "" {
+			description = fmt.Sprintf("Discount, promo code %s", res.PromoCode)
+		}
+		inv.Lines = append(inv.Lines, Line{Description: description, Amount: -res.Discount})
+	}
+	for _, t := range res.Taxes {
+		line := Line{Description: t.Name, Amount: t.Amount, Included: t.Inclusive}
+		if t.Inclusive {
+			line.Description += " (included)"
+		}
+		inv.Taxes = append(inv.Taxes, line)
+	}
+
+	return inv
+}
+
+// Number returns the invoice number of a reservation
+func Number(reservationID int) string {
+	return fmt.Sprintf("INV-%06d", reservationID)
+}
+
+// Total returns the amount charged, taxes included
+func (i Invoice) Total() int64 {
+	var total int64
+	for _, l := range i.Lines {
+		total += l.Amount
+	}
+	for _, l := range i.Taxes {
+		if !l.Included {
+			total += l.Amount
+		}
+	}
+	return total
+}
+
+// Paid returns the amount the guest was charged through captured payments
+func (i Invoice) Paid() int64 {
+	var paid int64
+	for _, p := range i.Payments {
+		if p.Status == payment.StatusCaptured {
+			paid += p.Amount
+		}
+	}
+	return paid
+}
+
+// Balance returns what the guest still owes, negative if they are owed money
+func (i Invoice) Balance() int64 {
+	return i.Total() - i.Paid()
+}
+
+// Layout of the invoice page, in points
+const (
+	left         = 50.0
+	right        = pdf.PageWidth - 50
+	top          = 60.0
+	bottom       = pdf.PageHeight - 60
+	lineHeight   = 16.0
+	textSize     = 10.0
+	headingSize  = 12.0
+	titleSize    = 20.0
+	sectionSpace = 24.0
+)
+
+// PDF returns the invoice as a PDF file
+func (i Invoice) PDF() []byte {
+	d := pdf.New()
+	money := func(cents int64) string {
+		return render.FormatMoney(cents, i.Currency)
+	}
+	res := i.Reservation
+
+	d.Text(left, top, titleSize, pdf.HelveticaBold, "Invoice")
+	d.Text(left, top+lineHeight*1.5, textSize, pdf.Helvetica, Issuer)
+	d.TextRight(right, top, textSize, i.Number)
+	d.TextRight(right, top+lineHeight, textSize, i.IssuedAt.Format("02/01/2006"))
+
+	y := top + lineHeight*4
+	d.Text(left, y, headingSize, pdf.HelveticaBold, "Billed to")
+	y += lineHeight
+	for _, s := range []string{res.FirstName + " " + res.LastName, res.Email, res.Phone} {
+		if s == "" || s == " " {
+			continue
+		}
+		d.Text(left, y, textSize, pdf.Helvetica, s)
+		y += lineHeight
+	}
+
+	y += sectionSpace / 2
+	d.Text(left, y, headingSize, pdf.HelveticaBold, "Reservation")
+	y += lineHeight
+	d.Text(left, y, textSize, pdf.Helvetica, fmt.Sprintf("Reservation %d, %s", res.ID, res.Room.RoomName))
+	y += lineHeight
+	d.Text(left, y, textSize, pdf.Helvetica, fmt.Sprintf("Arrival %s, departure %s, %d nights",
+		res.StartDate.Format("02/01/2006"), res.EndDate.Format("02/01/2006"), res.Nights()))
+	y += lineHeight
+	if res.Status == model.StatusCancelled {
+		d.Text(left, y, textSize, pdf.Helvetica, "This reservation was cancelled")
+		y += lineHeight
+	}
+
+	// newLine moves to the next line, starting a new page when this one is full
+	newLine := func() {
+		y += lineHeight
+		if y > bottom {
+			d.AddPage()
+			y = top
+		}
+	}
+	row := func(font pdf.Font, description string, amount int64) {
+		d.Text(left, y, textSize, font, description)
+		d.TextRight(right, y, textSize, money(amount))
+		newLine()
+	}
+
+	y += sectionSpace
+	d.Text(left, y, headingSize, pdf.HelveticaBold, "Description")
+	d.TextRight(right, y, headingSize, "Amount")
+	d.Line(left, y+4, right, y+4)
+	newLine()
+	for _, l := range i.Lines {
+		row(pdf.Helvetica, l.Description, l.Amount)
+	}
+	for _, l := range i.Taxes {
+		row(pdf.Helvetica, l.Description, l.Amount)
+	}
+	d.Line(left, y-lineHeight+4, right, y-lineHeight+4)
+	row(pdf.HelveticaBold, "Total", i.Total())
+
+	if len(i.Payments) > 0 {
+		y += sectionSpace
+		d.Text(left, y, headingSize, pdf.HelveticaBold, "Payments")
+		newLine()
+		for _, p := range i.Payments {
+			row(pdf.Helvetica, fmt.Sprintf("%s, %s %s (%s)", p.CreatedAt.Format("02/01/2006"), p.Provider, p.Reference, p.Status), p.Amount)
+		}
+		d.Line(left, y-lineHeight+4, right, y-lineHeight+4)
+		row(pdf.HelveticaBold, "Paid", i.Paid())
+	}
+
+	row(pdf.HelveticaBold, "Balance due", i.Balance())
+
+	return d.Bytes()
+}
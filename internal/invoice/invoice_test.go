@@ -0,0 +1,85 @@
+package invoice
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+	"github.com.br/Leodf/bookings/internal/payment"
+)
+
+func TestNew(t *testing.T) {
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := model.Reservation{
+		ID:        7,
+		FirstName: "John",
+		LastName:  "Smith",
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 3),
+		Room:      model.Room{RoomName: "General's Quarters", NightlyRate: 15000},
+		Discount:  4500,
+		PromoCode: "SAVE10",
+		Taxes: []model.TaxLine{
+			{Name: "VAT 10%", Amount: 3681, Inclusive: true},
+			{Name: "City tax", Amount: 1500},
+		},
+	}
+	payments := []model.Payment{
+		{Amount: 42000, Status: payment.StatusCaptured},
+		{Amount: 1000, Status: payment.StatusRefunded},
+	}
+
+	inv := New(res, payments, start)
+
+	if inv.Number != "INV-000007" {
+		t.Errorf("expected number INV-000007, got %s", inv.Number)
+	}
+	if len(inv.Lines) != 4 {
+		t.Fatalf("expected 3 nights and a discount, got %d lines", len(inv.Lines))
+	}
+	if inv.Total() != res.Total() {
+		t.Errorf("expected the invoice total %d to match the reservation total %d", inv.Total(), res.Total())
+	}
+	if len(inv.Taxes) != 2 {
+		t.Errorf("expected both taxes itemised, got %d", len(inv.Taxes))
+	}
+	if inv.Paid() != 42000 || inv.Balance() != 0 {
+		t.Errorf("expected 42000 paid and nothing due, got %d paid and %d due", inv.Paid(), inv.Balance())
+	}
+
+	out := inv.PDF()
+	if !bytes.HasPrefix(out, []byte("%PDF-")) {
+		t.Error("PDF doesn't start with the PDF header")
+	}
+	if !bytes.Contains(out, []byte("night of 03/01/2050")) {
+		t.Error("PDF is missing the last night")
+	}
+}
+
+func TestNew_Cancelled(t *testing.T) {
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := model.Reservation{
+		StartDate:           start,
+		EndDate:             start.AddDate(0, 0, 3),
+		Room:                model.Room{NightlyRate: 15000},
+		Status:              model.StatusCancelled,
+		CancellationPenalty: 22500,
+	}
+
+	inv := New(res, nil, start)
+
+	if len(inv.Lines) != 1 || inv.Total() != 22500 {
+		t.Errorf("expected only the penalty to be charged, got %d lines totalling %d", len(inv.Lines), inv.Total())
+	}
+}
+
+func TestInvoice_PDFPages(t *testing.T) {
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := model.Reservation{StartDate: start, EndDate: start.AddDate(0, 2, 0), Room: model.Room{NightlyRate: 15000}}
+
+	out := New(res, nil, start).PDF()
+	if !bytes.Contains(out, []byte("/Count 2")) {
+		t.Error("expected a two month stay to need a second page")
+	}
+}
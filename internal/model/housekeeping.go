@@ -0,0 +1,42 @@
+package model
+
+// Housekeeping statuses of a room
+const (
+	RoomDirty     = "dirty"
+	RoomClean     = "clean"
+	RoomInspected = "inspected"
+)
+
+var housekeepingLabels = map[string]string{
+	RoomDirty:     "Dirty",
+	RoomClean:     "Clean",
+	RoomInspected: "Inspected",
+}
+
+// HousekeepingStatuses returns the housekeeping statuses, in the order a room goes through them
+func HousekeepingStatuses() []string {
+	return []string{RoomDirty, RoomClean, RoomInspected}
+}
+
+// ValidHousekeepingStatus returns true if status is a known housekeeping status
+func ValidHousekeepingStatus(status string) bool {
+	_, ok := housekeepingLabels[status]
+	return ok
+}
+
+// HousekeepingLabel returns a human readable label for a housekeeping status
+func HousekeepingLabel(status string) string {
+	if l, ok := housekeepingLabels[status]; ok {
+		return l
+	}
+	return status
+}
+
+// RoomStatus returns the housekeeping status of a room from the statuses of its rooms,
+// inspected for a room that was never cleaned
+func RoomStatus(statuses map[int]string, roomID int) string {
+	if status, ok := statuses[roomID]; ok {
+		return status
+	}
+	return RoomInspected
+}
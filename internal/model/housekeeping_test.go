@@ -0,0 +1,33 @@
+package model
+
+import "testing"
+
+func TestRoomStatus(t *testing.T) {
+	statuses := map[int]string{1: RoomDirty, 2: RoomClean}
+
+	var tests = []struct {
+		roomID   int
+		expected string
+	}{
+		{1, RoomDirty},
+		{2, RoomClean},
+		{3, RoomInspected},
+	}
+
+	for _, e := range tests {
+		if got := RoomStatus(statuses, e.roomID); got != e.expected {
+			t.Errorf("room %d: expected %s, got %s", e.roomID, e.expected, got)
+		}
+	}
+}
+
+func TestValidHousekeepingStatus(t *testing.T) {
+	for _, status := range HousekeepingStatuses() {
+		if !ValidHousekeepingStatus(status) {
+			t.Errorf("expected %s to be valid", status)
+		}
+	}
+	if ValidHousekeepingStatus("bogus") {
+		t.Error("expected bogus to be invalid")
+	}
+}
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com.br/Leodf/bookings/internal/forms"
@@ -18,6 +20,12 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	// IsGuest is 1 when a guest, rather than staff, is logged in
+	IsGuest int
+	// Display is the currency the visitor shows prices in, the zero value shows the base currency
+	Display ExchangeRate
+	// Currencies lists the currencies prices can be shown in
+	Currencies []string
 }
 
 // User is the user model
@@ -34,10 +42,13 @@ type User struct {
 
 // Room is the Room model
 type Room struct {
-	ID        int
-	RoomName  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID           int
+	RoomName     string
+	MaxOccupancy int
+	// NightlyRate is the price of a night in cents
+	NightlyRate int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
 
 // Restriction is the Restriction model
@@ -62,6 +73,111 @@ type Reservation struct {
 	UpdatedAt time.Time
 	Room      Room
 	Processed int
+	Status    string
+	Source    string
+	GuestID   int
+	Guest     Guest
+	Adults    int
+	Children  int
+	// RatePlanID is 0 for reservations booked without a rate plan, which cancel for free
+	RatePlanID int
+	RatePlan   RatePlan
+	// CancellationPenalty is the amount in cents kept when the reservation was cancelled
+	CancellationPenalty int64
+	// CancellationRefund is the amount in cents of its payments given back when the reservation was cancelled
+	CancellationRefund int64
+	// PromotionID is 0 for reservations booked without a promo code
+	PromotionID int
+	PromoCode   string
+	// Discount is the amount in cents taken off the stay by the promo code
+	Discount int64
+	// Taxes are the taxes and fees worked out when the reservation was priced
+	Taxes []TaxLine
+	// CheckoutStartedAt is when the guest was sent to pay for the reservation online, zero for
+	// reservations made any other way
+	CheckoutStartedAt time.Time
+	// per transition timestamps, zero if the reservation never reached the status
+	ConfirmedAt  time.Time
+	CheckedInAt  time.Time
+	CheckedOutAt time.Time
+	CancelledAt  time.Time
+	NoShowAt     time.Time
+	DeletedAt    time.Time
+}
+
+// CheckoutAbandoned returns true if the guest was sent to pay for the reservation online before
+// the given time and never paid. Reservations made by staff, imported or older than online checkout
+// are never abandoned, even while pending.
+func (r Reservation) CheckoutAbandoned(before time.Time) bool {
+	return r.Status == StatusPending && !r.CheckoutStartedAt.IsZero() && r.CheckoutStartedAt.Before(before)
+}
+
+// Nights returns the number of nights of the stay
+func (r Reservation) Nights() int {
+	return int(r.EndDate.Sub(r.StartDate).Hours() / 24)
+}
+
+// PartySize returns the number of people staying
+func (r Reservation) PartySize() int {
+	return r.Adults + r.Children
+}
+
+// Subtotal returns the price of the stay in cents, before any discount
+func (r Reservation) Subtotal() int64 {
+	return int64(r.Nights()) * int64(r.Room.NightlyRate)
+}
+
+// Price returns the price of the stay in cents after the discount, before taxes added on top
+func (r Reservation) Price() int64 {
+	price := r.Subtotal() - r.Discount
+	if price < 0 {
+		return 0
+	}
+	return price
+}
+
+// TaxTotal returns the taxes and fees in cents added on top of the price
+func (r Reservation) TaxTotal() int64 {
+	var total int64
+	for _, t := range r.Taxes {
+		if !t.Inclusive {
+			total += t.Amount
+		}
+	}
+	return total
+}
+
+// Total returns what the stay costs in cents, after the discount and with taxes
+func (r Reservation) Total() int64 {
+	return r.Price() + r.TaxTotal()
+}
+
+// Guest is a person who has made reservations, identified by email
+type Guest struct {
+	ID        int
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	Password  string
+	Notes     string
+	VIP       bool
+	Blocked   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// stay totals, counting only reservations that hold a room
+	Stays       int
+	TotalNights int
+}
+
+// ReservationStatusHistory is a status change of a reservation
+type ReservationStatusHistory struct {
+	ID            int
+	ReservationID int
+	FromStatus    string
+	ToStatus      string
+	UserID        int
+	CreatedAt     time.Time
 }
 
 // RoomRestriction is the RoomRestriction model
@@ -72,18 +188,331 @@ type RoomRestrictions struct {
 	RoomID        int
 	ReservationID int
 	RestrictionID int
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Room          Room
+	// ExpiresAt is when a hold stops taking the room, zero for other restrictions
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Room        Room
+	Reservation Reservation
+	Restriction Restriction
+}
+
+// Restriction ids, matching the rows of the restrictions table
+const (
+	RestrictionReservation = 1
+	RestrictionBlock       = 2
+	// RestrictionHold keeps a room for a guest while they check out
+	RestrictionHold = 3
+)
+
+// AuditChange is the value of a field before and after an admin change
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditEntry is an admin change recorded in the audit log
+type AuditEntry struct {
+	ID        int
+	UserID    int
+	UserName  string
+	Action    string
+	Entity    string
+	EntityID  int
+	Changes   map[string]AuditChange
+	CreatedAt time.Time
+}
+
+// AuditFilter holds the search criteria for the audit log
+type AuditFilter struct {
+	UserID   int
+	Action   string
+	Entity   string
+	EntityID int
+	Query    string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// ReservationFilter holds the search criteria for the reservation lists. Zero values match everything.
+type ReservationFilter struct {
+	// New only matches the reservations staff haven't processed yet
+	New    bool
+	Status string
+	Source string
+	RoomID int
+	// From and To match the stays arriving between them, inclusive
+	From time.Time
+	To   time.Time
+	// During makes From and To match the stays with a night between them instead
+	During bool
+	// Query matches the guest name or email
+	Query string
+}
+
+// StayRule restricts the stays that can be booked, for one room or all rooms (RoomID 0),
+// optionally only for arrivals within a season. Zero values mean no restriction.
+type StayRule struct {
+	ID                int
+	RoomID            int
+	Name              string
+	SeasonStart       time.Time
+	SeasonEnd         time.Time
+	MinNights         int
+	MaxNights         int
+	ClosedToArrival   Weekdays
+	ClosedToDeparture Weekdays
+	MinAdvanceDays    int
+	MaxAdvanceDays    int
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Room              Room
+}
+
+// Weekdays is a set of days of the week
+type Weekdays uint8
+
+// NewWeekdays returns the set holding days
+func NewWeekdays(days ...time.Weekday) Weekdays {
+	var w Weekdays
+	for _, d := range days {
+		w |= 1 << uint(d)
+	}
+	return w
+}
+
+// Has returns true if day is in the set
+func (w Weekdays) Has(day time.Weekday) bool {
+	return w&(1<<uint(day)) != 0
+}
+
+// Days returns the days in the set, starting on Sunday
+func (w Weekdays) Days() []time.Weekday {
+	var days []time.Weekday
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if w.Has(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// WaitlistEntry is a guest waiting for a room to free up for their dates
+type WaitlistEntry struct {
+	ID        int
+	RoomID    int
+	Email     string
+	StartDate time.Time
+	EndDate   time.Time
+	// Token is the booking link sent when the dates free up, empty until then
+	Token      string
+	NotifiedAt time.Time
+	ExpiresAt  time.Time
+	UsedAt     time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Room       Room
+}
+
+// OfferValid returns true if the guest was sent a booking link that can still be used at now
+func (e WaitlistEntry) OfferValid(now time.Time) bool {
+	return e.Token != "" && e.UsedAt.IsZero() && now.Before(e.ExpiresAt)
+}
+
+// Payment is money taken, or reserved, for a reservation through a payment provider
+type Payment struct {
+	ID            int
+	ReservationID int
+	Provider      string
+	Reference     string
+	// Amount is in cents
+	Amount    int64
+	Currency  string
+	Status    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RatePlan is a way of booking a room, with its own cancellation policy
+type RatePlan struct {
+	ID   int
+	Name string
+	// FreeCancellationDays is how many days before arrival the stay can still be cancelled for free,
+	// 0 if it never can
+	FreeCancellationDays int
+	// PenaltyPercent is the part of the stay total kept when cancelling after the free period
+	PenaltyPercent int
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Penalty returns the amount in cents kept from total when a stay arriving on arrival is cancelled at cancelAt
+func (p RatePlan) Penalty(total int64, arrival, cancelAt time.Time) int64 {
+	if p.PenaltyPercent <= 0 || total <= 0 {
+		return 0
+	}
+
+	day := time.Date(cancelAt.Year(), cancelAt.Month(), cancelAt.Day(), 0, 0, 0, 0, arrival.Location())
+	daysBefore := int(arrival.Sub(day).Hours() / 24)
+	if p.FreeCancellationDays > 0 && daysBefore >= p.FreeCancellationDays {
+		return 0
+	}
+
+	percent := p.PenaltyPercent
+	if percent > 100 {
+		percent = 100
+	}
+	return total * int64(percent) / 100
+}
+
+// Policy describes the cancellation policy to guests
+func (p RatePlan) Policy() string {
+	switch {
+	case p.PenaltyPercent <= 0:
+		return "Free cancellation"
+	case p.FreeCancellationDays == 0 && p.PenaltyPercent >= 100:
+		return "Non-refundable"
+	case p.FreeCancellationDays == 0:
+		return fmt.Sprintf("%d%% of the stay is charged on cancellation", p.PenaltyPercent)
+	}
+
+	days := "days"
+	if p.FreeCancellationDays == 1 {
+		days = "day"
+	}
+	return fmt.Sprintf("Free cancellation until %d %s before arrival, %d%% of the stay is charged after that",
+		p.FreeCancellationDays, days, p.PenaltyPercent)
+}
+
+// Promotion discount types
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+)
+
+// Promotion is a promo code guests enter to get a discount. Zero values mean no restriction.
+type Promotion struct {
+	ID          int
+	Code        string
+	Description string
+	// DiscountType is DiscountPercent or DiscountFixed
+	DiscountType string
+	// Amount is a percentage for percent discounts and cents for fixed ones
+	Amount    int64
+	ValidFrom time.Time
+	ValidTo   time.Time
+	RoomID    int
+	// MaxUses limits the reservations that can use the code, MaxUsesPerGuest the ones of each guest
+	MaxUses         int
+	MaxUsesPerGuest int
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Room            Room
+	// Uses is how many reservations used the code
+	Uses int
+}
+
+// Tax rule kinds
+const (
+	// TaxPercent is a percentage of the price
+	TaxPercent = "percent"
+	// TaxPerNight is a fee for every night
+	TaxPerNight = "per_night"
+	// TaxPerPersonNight is a fee for every person and night, like a city tax
+	TaxPerPersonNight = "per_person_night"
+)
+
+// TaxRule is a tax or fee charged on every stay
+type TaxRule struct {
+	ID   int
+	Name string
+	// Kind is TaxPercent, TaxPerNight or TaxPerPersonNight
+	Kind string
+	// Amount is in hundredths of a percent for percentages and in cents for fees
+	Amount int64
+	// Inclusive taxes are already part of the nightly rate, so they are shown but not added
+	Inclusive bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Rate returns the amount of a percentage rule as a percentage, e.g. 7.5%
+func (t TaxRule) Rate() string {
+	rate := fmt.Sprintf("%d.%02d", t.Amount/100, t.Amount%100)
+	return strings.TrimSuffix(strings.TrimRight(rate, "0"), ".") + "%"
+}
+
+// TaxLine is a tax or fee charged on a reservation
+type TaxLine struct {
+	Name string `json:"name"`
+	// Amount is in cents
+	Amount    int64 `json:"amount"`
+	Inclusive bool  `json:"inclusive"`
+}
+
+// ExchangeRate is how much of Currency one unit of the base currency buys, for showing prices to guests
+type ExchangeRate struct {
+	ID        int
+	Currency  string
+	Rate      float64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// HousekeepingTask is the cleaning of a room, opened when a stay ends or when staff mark the room dirty.
+// The status of the room's latest task is the status of the room.
+type HousekeepingTask struct {
+	ID     int
+	RoomID int
+	Room   Room
+	// ReservationID is the stay that ended, 0 for a room marked dirty by staff
+	ReservationID int
 	Reservation   Reservation
-	Restriction   Restriction
+	DueDate       time.Time
+	Status        string
+	// UserID is who last changed the status
+	UserID    int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Kinds of reservation message
+const (
+	// MessageNote is an internal note, only staff see it
+	MessageNote = "note"
+	// MessageEmail is an email sent to the guest
+	MessageEmail = "email"
+)
+
+// ReservationMessage is an entry of the thread of a reservation, a note or an email to the guest
+type ReservationMessage struct {
+	ID            int
+	ReservationID int
+	Kind          string
+	UserID        int
+	UserName      string
+	// To is the address an email was sent to
+	To        string
+	Subject   string
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 // MailData holds an email message
 type MailData struct {
-	To       string
-	From     string
-	Subject  string
-	Content  string
-	Template string
+	To          string
+	From        string
+	Subject     string
+	Content     string
+	Template    string
+	Attachments []MailAttachment
+}
+
+// MailAttachment is a file attached to an email
+type MailAttachment struct {
+	Name     string
+	MimeType string
+	Data     []byte
 }
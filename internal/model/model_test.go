@@ -0,0 +1,168 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReservation_Nights(t *testing.T) {
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		end      time.Time
+		expected int
+	}{
+		{start, 0},
+		{start.AddDate(0, 0, 1), 1},
+		{start.AddDate(0, 1, 0), 31},
+	}
+
+	for _, e := range tests {
+		res := Reservation{StartDate: start, EndDate: e.end}
+		if got := res.Nights(); got != e.expected {
+			t.Errorf("expected %d nights until %s, got %d", e.expected, e.end.Format("2006-01-02"), got)
+		}
+	}
+}
+
+func TestWaitlistEntry_OfferValid(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name     string
+		entry    WaitlistEntry
+		expected bool
+	}{
+		{"not offered", WaitlistEntry{}, false},
+		{"offered", WaitlistEntry{Token: "abc", ExpiresAt: now.Add(time.Hour)}, true},
+		{"expired", WaitlistEntry{Token: "abc", ExpiresAt: now.Add(-time.Hour)}, false},
+		{"used", WaitlistEntry{Token: "abc", ExpiresAt: now.Add(time.Hour), UsedAt: now.Add(-time.Minute)}, false},
+	}
+
+	for _, e := range tests {
+		if got := e.entry.OfferValid(now); got != e.expected {
+			t.Errorf("%s: expected %t, got %t", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestReservation_CheckoutAbandoned(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Hour)
+
+	var tests = []struct {
+		name     string
+		res      Reservation
+		expected bool
+	}{
+		{"unpaid checkout", Reservation{Status: StatusPending, Source: SourceWeb, CheckoutStartedAt: now.Add(-2 * time.Hour)}, true},
+		{"checkout in progress", Reservation{Status: StatusPending, Source: SourceWeb, CheckoutStartedAt: now.Add(-time.Minute)}, false},
+		{"paid checkout", Reservation{Status: StatusConfirmed, Source: SourceWeb, CheckoutStartedAt: now.Add(-2 * time.Hour)}, false},
+		{"legacy pending reservation", Reservation{Status: StatusPending, Source: SourceWeb, CreatedAt: now.AddDate(-1, 0, 0)}, false},
+		{"imported pending reservation", Reservation{Status: StatusPending, Source: SourceChannel, CreatedAt: now.AddDate(0, 0, -1)}, false},
+	}
+
+	for _, e := range tests {
+		if got := e.res.CheckoutAbandoned(before); got != e.expected {
+			t.Errorf("%s: expected %t, got %t", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestReservation_Total(t *testing.T) {
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := Reservation{StartDate: start, EndDate: start.AddDate(0, 0, 3), Room: Room{NightlyRate: 15000}}
+
+	if got := res.Total(); got != 45000 {
+		t.Errorf("expected a total of 45000, got %d", got)
+	}
+
+	res.Discount = 5000
+	if got := res.Total(); got != 40000 {
+		t.Errorf("expected a discounted total of 40000, got %d", got)
+	}
+
+	res.Discount = 50000
+	if got := res.Total(); got != 0 {
+		t.Errorf("expected a discount above the price to leave nothing to pay, got %d", got)
+	}
+}
+
+func TestRatePlan_Penalty(t *testing.T) {
+	arrival := time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+	flexible := RatePlan{FreeCancellationDays: 7, PenaltyPercent: 50}
+	nonRefundable := RatePlan{PenaltyPercent: 100}
+
+	var tests = []struct {
+		name     string
+		plan     RatePlan
+		cancelAt time.Time
+		expected int64
+	}{
+		{"no plan", RatePlan{}, arrival, 0},
+		{"free period", flexible, time.Date(2050, 1, 2, 18, 0, 0, 0, time.UTC), 0},
+		{"last free day", flexible, time.Date(2050, 1, 3, 23, 0, 0, 0, time.UTC), 0},
+		{"after free period", flexible, time.Date(2050, 1, 4, 9, 0, 0, 0, time.UTC), 22500},
+		{"non-refundable", nonRefundable, time.Date(2049, 12, 1, 9, 0, 0, 0, time.UTC), 45000},
+	}
+
+	for _, e := range tests {
+		if got := e.plan.Penalty(45000, arrival, e.cancelAt); got != e.expected {
+			t.Errorf("%s: expected a penalty of %d, got %d", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestRatePlan_Policy(t *testing.T) {
+	var tests = []struct {
+		plan     RatePlan
+		expected string
+	}{
+		{RatePlan{}, "Free cancellation"},
+		{RatePlan{PenaltyPercent: 100}, "Non-refundable"},
+		{RatePlan{FreeCancellationDays: 1, PenaltyPercent: 50}, "Free cancellation until 1 day before arrival, 50% of the stay is charged after that"},
+	}
+
+	for _, e := range tests {
+		if got := e.plan.Policy(); got != e.expected {
+			t.Errorf("expected %q, got %q", e.expected, got)
+		}
+	}
+}
+
+func TestReservation_TotalWithTaxes(t *testing.T) {
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := Reservation{
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 2),
+		Room:      Room{NightlyRate: 10000},
+		Taxes: []TaxLine{
+			{Name: "VAT", Amount: 3333, Inclusive: true},
+			{Name: "City tax", Amount: 1000},
+		},
+	}
+
+	if got := res.TaxTotal(); got != 1000 {
+		t.Errorf("expected only the exclusive taxes to be added, got %d", got)
+	}
+	if got := res.Total(); got != 21000 {
+		t.Errorf("expected a total of 21000, got %d", got)
+	}
+}
+
+func TestTaxRule_Rate(t *testing.T) {
+	var tests = []struct {
+		amount   int64
+		expected string
+	}{
+		{2000, "20%"},
+		{750, "7.5%"},
+		{1, "0.01%"},
+	}
+
+	for _, e := range tests {
+		if got := (TaxRule{Amount: e.amount}).Rate(); got != e.expected {
+			t.Errorf("expected %s for %d, got %s", e.expected, e.amount, got)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package model
+
+// Reservation sources
+const (
+	SourceWeb     = "web"
+	SourcePhone   = "phone"
+	SourceWalkIn  = "walk_in"
+	SourceChannel = "channel"
+)
+
+var sourceLabels = map[string]string{
+	SourceWeb:     "Web",
+	SourcePhone:   "Phone",
+	SourceWalkIn:  "Walk-in",
+	SourceChannel: "Channel",
+}
+
+// Sources returns the sources a reservation can come from
+func Sources() []string {
+	return []string{SourceWeb, SourcePhone, SourceWalkIn, SourceChannel}
+}
+
+// ValidSource returns true if source is a known reservation source
+func ValidSource(source string) bool {
+	_, ok := sourceLabels[source]
+	return ok
+}
+
+// SourceLabel returns a human readable label for source
+func SourceLabel(source string) string {
+	if l, ok := sourceLabels[source]; ok {
+		return l
+	}
+	return source
+}
@@ -0,0 +1,74 @@
+package model
+
+import "errors"
+
+// Reservation statuses
+const (
+	StatusPending    = "pending"
+	StatusConfirmed  = "confirmed"
+	StatusCheckedIn  = "checked_in"
+	StatusCheckedOut = "checked_out"
+	StatusCancelled  = "cancelled"
+	StatusNoShow     = "no_show"
+)
+
+// ErrInvalidTransition is returned when a reservation can't move to the requested status
+var ErrInvalidTransition = errors.New("invalid reservation status transition")
+
+// statusTransitions holds the legal next statuses for each status
+var statusTransitions = map[string][]string{
+	StatusPending:    {StatusConfirmed, StatusCancelled},
+	StatusConfirmed:  {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn:  {StatusCheckedOut},
+	StatusCheckedOut: {},
+	StatusCancelled:  {},
+	StatusNoShow:     {},
+}
+
+var statusLabels = map[string]string{
+	StatusPending:    "Pending",
+	StatusConfirmed:  "Confirmed",
+	StatusCheckedIn:  "Checked in",
+	StatusCheckedOut: "Checked out",
+	StatusCancelled:  "Cancelled",
+	StatusNoShow:     "No-show",
+}
+
+// Statuses returns the reservation statuses, in the order a stay goes through them
+func Statuses() []string {
+	return []string{StatusPending, StatusConfirmed, StatusCheckedIn, StatusCheckedOut, StatusCancelled, StatusNoShow}
+}
+
+// ValidStatus returns true if status is a known reservation status
+func ValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// NextStatuses returns the statuses a reservation can move to from status
+func NextStatuses(status string) []string {
+	return statusTransitions[status]
+}
+
+// CanTransition returns true if a reservation can move from one status to another
+func CanTransition(from, to string) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusLabel returns a human readable label for status
+func StatusLabel(status string) string {
+	if l, ok := statusLabels[status]; ok {
+		return l
+	}
+	return status
+}
+
+// HoldsRoom returns true if a reservation in status still occupies its room
+func HoldsRoom(status string) bool {
+	return status != StatusCancelled && status != StatusNoShow
+}
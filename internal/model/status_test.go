@@ -0,0 +1,45 @@
+package model
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	var tests = []struct {
+		from     string
+		to       string
+		expected bool
+	}{
+		{StatusPending, StatusConfirmed, true},
+		{StatusPending, StatusCheckedIn, false},
+		{StatusConfirmed, StatusCheckedIn, true},
+		{StatusConfirmed, StatusNoShow, true},
+		{StatusCheckedIn, StatusCheckedOut, true},
+		{StatusCheckedIn, StatusCancelled, false},
+		{StatusCheckedOut, StatusPending, false},
+		{StatusCancelled, StatusConfirmed, false},
+		{"unknown", StatusConfirmed, false},
+	}
+
+	for _, e := range tests {
+		if got := CanTransition(e.from, e.to); got != e.expected {
+			t.Errorf("CanTransition(%s, %s): expected %t, got %t", e.from, e.to, e.expected, got)
+		}
+	}
+}
+
+func TestNextStatuses(t *testing.T) {
+	if len(NextStatuses(StatusCancelled)) != 0 {
+		t.Error("cancelled reservation should have no next statuses")
+	}
+	if len(NextStatuses(StatusConfirmed)) != 3 {
+		t.Errorf("expected 3 next statuses for confirmed, got %d", len(NextStatuses(StatusConfirmed)))
+	}
+}
+
+func TestHoldsRoom(t *testing.T) {
+	if !HoldsRoom(StatusConfirmed) {
+		t.Error("confirmed reservation should hold the room")
+	}
+	if HoldsRoom(StatusCancelled) || HoldsRoom(StatusNoShow) {
+		t.Error("cancelled and no-show reservations should not hold the room")
+	}
+}
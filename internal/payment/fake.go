@@ -0,0 +1,144 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// DeclinedCard is the card the fake provider always declines
+const DeclinedCard = "4000000000000002"
+
+// FakeSignatureHeader holds the signature of the fake provider webhook requests
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// Fake is an in process provider for development and tests. It authorizes any card but
+// DeclinedCard and keeps the payments in memory.
+type Fake struct {
+	secret []byte
+
+	mu       sync.Mutex
+	next     int
+	payments map[string]*fakePayment
+}
+
+type fakePayment struct {
+	authorized int64
+	captured   int64
+	refunded   int64
+}
+
+// NewFake returns a fake provider signing its webhooks with secret
+func NewFake(secret string) *Fake {
+	return &Fake{
+		secret:   []byte(secret),
+		payments: make(map[string]*fakePayment),
+	}
+}
+
+// Name identifies the provider
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Authorize reserves the amount unless the card is DeclinedCard
+func (f *Fake) Authorize(a Authorization) (string, error) {
+	if a.Amount <= 0 {
+		return "", ErrInvalidAmount
+	}
+	if a.Source == "" || a.Source == DeclinedCard {
+		return "", ErrDeclined
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	reference := fmt.Sprintf("fake_%d", f.next)
+	f.payments[reference] = &fakePayment{authorized: a.Amount}
+
+	return reference, nil
+}
+
+// Capture takes amount of what is left of the authorization
+func (f *Fake) Capture(reference string, amount int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[reference]
+	if !ok {
+		return ErrUnknownPayment
+	}
+	if amount <= 0 || p.captured+amount > p.authorized {
+		return ErrInvalidAmount
+	}
+	p.captured += amount
+
+	return nil
+}
+
+// Refund gives back amount of what was captured
+func (f *Fake) Refund(reference string, amount int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[reference]
+	if !ok {
+		return ErrUnknownPayment
+	}
+	if amount <= 0 || p.refunded+amount > p.captured {
+		return ErrInvalidAmount
+	}
+	p.refunded += amount
+
+	return nil
+}
+
+// Void releases what wasn't captured of the authorization
+func (f *Fake) Void(reference string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[reference]
+	if !ok {
+		return ErrUnknownPayment
+	}
+	p.authorized = p.captured
+
+	return nil
+}
+
+// Sign returns the signature the fake provider sends with a webhook payload
+func (f *Fake) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the request body was signed with the secret and decodes its event,
+// sent as JSON like {"status": "captured", "reference": "fake_1"}
+func (f *Fake) VerifyWebhook(r *http.Request) (Event, error) {
+	var event Event
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		return event, err
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(FakeSignatureHeader))
+	if err != nil {
+		return event, ErrInvalidSignature
+	}
+	expected, _ := hex.DecodeString(f.Sign(payload))
+	if !hmac.Equal(signature, expected) {
+		return event, ErrInvalidSignature
+	}
+
+	err = json.Unmarshal(payload, &event)
+	return event, err
+}
@@ -0,0 +1,114 @@
+package payment
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFake_Authorize(t *testing.T) {
+	f := NewFake("secret")
+
+	var tests = []struct {
+		name        string
+		auth        Authorization
+		expectedErr error
+	}{
+		{"valid card", Authorization{Amount: 1000, Source: "4242424242424242"}, nil},
+		{"declined card", Authorization{Amount: 1000, Source: DeclinedCard}, ErrDeclined},
+		{"no card", Authorization{Amount: 1000}, ErrDeclined},
+		{"nothing to pay", Authorization{Source: "4242424242424242"}, ErrInvalidAmount},
+	}
+
+	for _, e := range tests {
+		reference, err := f.Authorize(e.auth)
+		if !errors.Is(err, e.expectedErr) {
+			t.Errorf("%s: expected error %v, got %v", e.name, e.expectedErr, err)
+		}
+		if err == nil && reference == "" {
+			t.Errorf("%s: expected a reference", e.name)
+		}
+	}
+}
+
+func TestFake_CaptureAndRefund(t *testing.T) {
+	f := NewFake("secret")
+
+	reference, err := f.Authorize(Authorization{Amount: 1000, Source: "4242424242424242"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = f.Refund(reference, 500); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected refunding before capture to fail, got %v", err)
+	}
+	if err = f.Capture(reference, 1500); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected capturing more than authorized to fail, got %v", err)
+	}
+	if err = f.Capture(reference, 1000); err != nil {
+		t.Errorf("expected capture to succeed, got %v", err)
+	}
+	if err = f.Refund(reference, 400); err != nil {
+		t.Errorf("expected partial refund to succeed, got %v", err)
+	}
+	if err = f.Refund(reference, 700); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected refunding more than captured to fail, got %v", err)
+	}
+	if err = f.Capture("unknown", 100); !errors.Is(err, ErrUnknownPayment) {
+		t.Errorf("expected unknown payment, got %v", err)
+	}
+}
+
+func TestFake_VerifyWebhook(t *testing.T) {
+	f := NewFake("secret")
+	payload := `{"status": "captured", "reference": "fake_1"}`
+
+	var tests = []struct {
+		name        string
+		signature   string
+		expectedErr bool
+	}{
+		{"signed", f.Sign([]byte(payload)), false},
+		{"signed with another secret", NewFake("other").Sign([]byte(payload)), true},
+		{"not signed", "", true},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/payments/webhook", strings.NewReader(payload))
+		req.Header.Set(FakeSignatureHeader, e.signature)
+
+		event, err := f.VerifyWebhook(req)
+		if (err != nil) != e.expectedErr {
+			t.Errorf("%s: expected error %t, got %v", e.name, e.expectedErr, err)
+		}
+		if err == nil && (event.Status != StatusCaptured || event.Reference != "fake_1") {
+			t.Errorf("%s: unexpected event %+v", e.name, event)
+		}
+	}
+}
+
+func TestFake_Void(t *testing.T) {
+	f := NewFake("secret")
+
+	reference, err := f.Authorize(Authorization{Amount: 1000, Source: "4242424242424242"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = f.Capture(reference, 300); err != nil {
+		t.Fatalf("expected capture to succeed, got %v", err)
+	}
+	if err = f.Void(reference); err != nil {
+		t.Errorf("expected void to succeed, got %v", err)
+	}
+	if err = f.Capture(reference, 100); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected capturing a voided authorization to fail, got %v", err)
+	}
+	if err = f.Refund(reference, 300); err != nil {
+		t.Errorf("expected the captured part to stay refundable, got %v", err)
+	}
+	if err = f.Void("unknown"); !errors.Is(err, ErrUnknownPayment) {
+		t.Errorf("expected unknown payment, got %v", err)
+	}
+}
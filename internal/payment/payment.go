@@ -0,0 +1,73 @@
+// Package payment takes the payments for reservations through a pluggable provider
+package payment
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Payment statuses
+const (
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusRefunded   = "refunded"
+	StatusVoided     = "voided"
+	StatusFailed     = "failed"
+)
+
+// Currency is the currency room rates are charged in
+const Currency = "USD"
+
+// ErrDeclined is returned when the provider refuses to authorize a payment
+var ErrDeclined = errors.New("the payment was declined")
+
+// ErrUnknownPayment is returned for a reference the provider doesn't know
+var ErrUnknownPayment = errors.New("unknown payment")
+
+// ErrInvalidAmount is returned when capturing or refunding more than what is left of a payment
+var ErrInvalidAmount = errors.New("invalid payment amount")
+
+// ErrInvalidSignature is returned when a webhook request wasn't signed by the provider
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// ValidStatus returns true if status is a known payment status
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusAuthorized, StatusCaptured, StatusRefunded, StatusVoided, StatusFailed:
+		return true
+	}
+	return false
+}
+
+// Authorization asks the provider to reserve an amount on the guest's card
+type Authorization struct {
+	// Amount is in cents
+	Amount   int64
+	Currency string
+	// Source is the card, or the token standing for it, sent by the checkout form
+	Source      string
+	Description string
+}
+
+// Event is a change to a payment the provider tells us about through the webhook
+type Event struct {
+	// Status is the payment status the event moves the payment to
+	Status    string `json:"status"`
+	Reference string `json:"reference"`
+}
+
+// Provider takes payments
+type Provider interface {
+	// Name identifies the provider in the payments table
+	Name() string
+	// Authorize reserves the amount on the guest's card and returns the provider reference for the payment
+	Authorize(a Authorization) (string, error)
+	// Capture takes amount of an authorized payment
+	Capture(reference string, amount int64) error
+	// Refund gives amount of a payment back
+	Refund(reference string, amount int64) error
+	// Void releases what is left of an authorized payment, so it can no longer be captured
+	Void(reference string) error
+	// VerifyWebhook checks a webhook request came from the provider and returns its event
+	VerifyWebhook(r *http.Request) (Event, error)
+}
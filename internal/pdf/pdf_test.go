@@ -0,0 +1,50 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestDocument_WriteTo(t *testing.T) {
+	d := New()
+	d.Text(50, 50, 12, HelveticaBold, "Invoice (copy)")
+	d.TextRight(545, 70, 10, "USD 150.00")
+	d.Line(50, 80, 545, 80)
+	d.AddPage()
+	d.Text(50, 50, 12, Helvetica, "Café")
+
+	out := d.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("output isn't framed as a PDF file")
+	}
+	if !bytes.Contains(out, []byte(`(Invoice \(copy\)) Tj`)) {
+		t.Error("parentheses in text aren't escaped")
+	}
+	if !bytes.Contains(out, []byte("(Caf\xe9) Tj")) {
+		t.Error("text isn't WinAnsi encoded")
+	}
+	if !bytes.Contains(out, []byte("/Count 2")) {
+		t.Error("expected two pages")
+	}
+
+	// every xref entry must point at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("expected 9 objects, got %d", len(entries))
+	}
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		if !bytes.HasPrefix(out[offset:], []byte(fmt.Sprintf("%d 0 obj", i+1))) {
+			t.Errorf("xref entry %d doesn't point at its object", i+1)
+		}
+	}
+}
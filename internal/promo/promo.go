@@ -0,0 +1,53 @@
+package promo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+// NormalizeCode returns code the way promo codes are stored, so guests can type it in any case
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Check returns the reason p can't be used for a stay in roomID booked on today, given how many
+// reservations used it in total and how many of them are the guest's. An empty result means it applies.
+func Check(p model.Promotion, roomID int, today time.Time, uses, guestUses int) string {
+	day := today.Truncate(24 * time.Hour)
+
+	switch {
+	case !p.ValidFrom.IsZero() && day.Before(p.ValidFrom):
+		return fmt.Sprintf("this code can only be used from %s", p.ValidFrom.Format("02/01/2006"))
+	case !p.ValidTo.IsZero() && day.After(p.ValidTo):
+		return "this code has expired"
+	case p.RoomID != 0 && p.RoomID != roomID:
+		return "this code isn't valid for this room"
+	case p.MaxUses > 0 && uses >= p.MaxUses:
+		return "this code has been used up"
+	case p.MaxUsesPerGuest > 0 && guestUses >= p.MaxUsesPerGuest:
+		return "you have already used this code"
+	}
+	return ""
+}
+
+// Discount returns the amount in cents p takes off a stay costing subtotal cents
+func Discount(p model.Promotion, subtotal int64) int64 {
+	var discount int64
+	switch p.DiscountType {
+	case model.DiscountPercent:
+		discount = subtotal * p.Amount / 100
+	case model.DiscountFixed:
+		discount = p.Amount
+	}
+
+	if discount > subtotal {
+		return subtotal
+	}
+	if discount < 0 {
+		return 0
+	}
+	return discount
+}
@@ -0,0 +1,82 @@
+package promo
+
+import (
+	"testing"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestNormalizeCode(t *testing.T) {
+	if got := NormalizeCode(" summer10 "); got != "SUMMER10" {
+		t.Errorf("expected SUMMER10, got %s", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	today := date("2050-06-15")
+	p := model.Promotion{
+		Code:            "SUMMER10",
+		ValidFrom:       date("2050-06-01"),
+		ValidTo:         date("2050-08-31"),
+		RoomID:          1,
+		MaxUses:         10,
+		MaxUsesPerGuest: 1,
+	}
+
+	var tests = []struct {
+		name      string
+		today     time.Time
+		roomID    int
+		uses      int
+		guestUses int
+		applies   bool
+	}{
+		{"valid", today, 1, 0, 0, true},
+		{"last valid day", date("2050-08-31").Add(18 * time.Hour), 1, 0, 0, true},
+		{"not started", date("2050-05-31"), 1, 0, 0, false},
+		{"expired", date("2050-09-01"), 1, 0, 0, false},
+		{"other room", today, 2, 0, 0, false},
+		{"used up", today, 1, 10, 0, false},
+		{"used by the guest", today, 1, 3, 1, false},
+	}
+
+	for _, e := range tests {
+		reason := Check(p, e.roomID, e.today, e.uses, e.guestUses)
+		if e.applies && reason != "" {
+			t.Errorf("%s: expected the code to apply, got %q", e.name, reason)
+		}
+		if !e.applies && reason == "" {
+			t.Errorf("%s: expected the code not to apply", e.name)
+		}
+	}
+
+	if reason := Check(model.Promotion{Code: "ANY"}, 2, today, 100, 100); reason != "" {
+		t.Errorf("expected a code without limits to apply, got %q", reason)
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	var tests = []struct {
+		name     string
+		p        model.Promotion
+		subtotal int64
+		expected int64
+	}{
+		{"percent", model.Promotion{DiscountType: model.DiscountPercent, Amount: 10}, 45000, 4500},
+		{"fixed", model.Promotion{DiscountType: model.DiscountFixed, Amount: 2000}, 45000, 2000},
+		{"fixed above the price", model.Promotion{DiscountType: model.DiscountFixed, Amount: 50000}, 45000, 45000},
+		{"unknown type", model.Promotion{DiscountType: "bogus", Amount: 10}, 45000, 0},
+	}
+
+	for _, e := range tests {
+		if got := Discount(e.p, e.subtotal); got != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expected, got)
+		}
+	}
+}
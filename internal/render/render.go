@@ -11,15 +11,23 @@ import (
 	"time"
 
 	"github.com.br/Leodf/bookings/internal/config"
+	"github.com.br/Leodf/bookings/internal/currency"
 	"github.com.br/Leodf/bookings/internal/model"
 	"github.com/justinas/nosurf"
 )
 
 var functions = template.FuncMap{
-	"humanDate":  HumanDate,
-	"formatDate": FormatDate,
-	"iterate":    Iterate,
-	"add":        Add,
+	"humanDate":         HumanDate,
+	"formatDate":        FormatDate,
+	"iterate":           Iterate,
+	"add":               Add,
+	"statusLabel":       model.StatusLabel,
+	"canTransition":     model.CanTransition,
+	"sourceLabel":       model.SourceLabel,
+	"housekeepingLabel": model.HousekeepingLabel,
+	"roomStatus":        model.RoomStatus,
+	"formatMoney":       FormatMoney,
+	"displayMoney":      DisplayMoney,
 }
 var app *config.AppConfig
 var pathToTemplates = "./templates"
@@ -51,6 +59,31 @@ func FormatDate(t time.Time, f string) string {
 	return t.Format(f)
 }
 
+// FormatMoney formats an amount in cents, like "USD 150.00"
+func FormatMoney(cents int64, currency string) string {
+	return fmt.Sprintf("%s %d.%02d", currency, cents/100, cents%100)
+}
+
+// DisplayMoney formats an amount in cents of the base currency in the currency of display, followed
+// by the base amount, which is what is charged, like "EUR 138.00 (USD 150.00)". With no display
+// currency it formats the base amount only.
+func DisplayMoney(cents int64, base string, display model.ExchangeRate) string {
+	if display.Currency == "" || display.Currency == base {
+		return FormatMoney(cents, base)
+	}
+	return fmt.Sprintf("%s (%s)", FormatMoney(currency.Convert(cents, display), display.Currency), FormatMoney(cents, base))
+}
+
+// DisplayCurrency returns the exchange rate of the currency the visitor chose to show prices in,
+// the zero value when they haven't chosen one or it is no longer offered
+func DisplayCurrency(r *http.Request) model.ExchangeRate {
+	if app.Currencies == nil {
+		return model.ExchangeRate{}
+	}
+	rate, _ := app.Currencies.Get(app.Session.GetString(r.Context(), "currency"))
+	return rate
+}
+
 func AddDefaultData(td *model.TemplateData, r *http.Request) *model.TemplateData {
 	td.Flash = app.Session.PopString(r.Context(), "flash")
 	td.Error = app.Session.PopString(r.Context(), "error")
@@ -59,6 +92,13 @@ func AddDefaultData(td *model.TemplateData, r *http.Request) *model.TemplateData
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
 	}
+	if app.Session.Exists(r.Context(), "guest_id") {
+		td.IsGuest = 1
+	}
+	td.Display = DisplayCurrency(r)
+	if app.Currencies != nil {
+		td.Currencies = app.Currencies.Codes()
+	}
 	return td
 }
 
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com.br/Leodf/bookings/internal/currency"
 	"github.com.br/Leodf/bookings/internal/model"
 )
 
@@ -66,3 +67,47 @@ func TestCreateTemplateCache(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestFormatMoney(t *testing.T) {
+	if got := FormatMoney(15005, "USD"); got != "USD 150.05" {
+		t.Errorf("expected USD 150.05, got %s", got)
+	}
+}
+
+func TestDisplayMoney(t *testing.T) {
+	var tests = []struct {
+		name     string
+		display  model.ExchangeRate
+		expected string
+	}{
+		{"no display currency", model.ExchangeRate{}, "USD 150.00"},
+		{"base currency", model.ExchangeRate{Currency: "USD", Rate: 1}, "USD 150.00"},
+		{"converted", model.ExchangeRate{Currency: "EUR", Rate: 0.92}, "EUR 138.00 (USD 150.00)"},
+	}
+
+	for _, e := range tests {
+		if got := DisplayMoney(15000, "USD", e.display); got != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestAddDefaultDataCurrency(t *testing.T) {
+	app.Currencies = currency.NewTable()
+	app.Currencies.Set([]model.ExchangeRate{{Currency: "EUR", Rate: 0.92}})
+	defer func() { app.Currencies = nil }()
+
+	r, err := getSession()
+	if err != nil {
+		t.Error(err)
+	}
+	session.Put(r.Context(), "currency", "EUR")
+
+	td := AddDefaultData(&model.TemplateData{}, r)
+	if td.Display.Currency != "EUR" {
+		t.Errorf("expected prices displayed in EUR, got %q", td.Display.Currency)
+	}
+	if len(td.Currencies) != 1 {
+		t.Errorf("expected 1 currency to choose from, got %d", len(td.Currencies))
+	}
+}
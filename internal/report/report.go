@@ -0,0 +1,210 @@
+package report
+
+import (
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+// Month holds the figures of a calendar month of a report
+type Month struct {
+	// Start is the first day of the month
+	Start time.Time
+	// Available is how many nights of the month each room could be sold, within the report dates
+	Available int
+	// Nights are the nights sold of each room, in the order of Report.Rooms
+	Nights []int
+	// Revenue is in cents, what the nights sold cost after discounts and before taxes
+	Revenue int64
+}
+
+// Sold returns the nights sold of all rooms
+func (m Month) Sold() int {
+	var sold int
+	for _, n := range m.Nights {
+		sold += n
+	}
+	return sold
+}
+
+// Occupancy returns the percentage of the nights of all rooms that were sold
+func (m Month) Occupancy() float64 {
+	return percent(m.Sold(), m.Available*len(m.Nights))
+}
+
+// RoomOccupancy returns the percentage of the nights of the room at index i that were sold
+func (m Month) RoomOccupancy(i int) float64 {
+	return percent(m.Nights[i], m.Available)
+}
+
+// ADR returns the average daily rate, the revenue of a night sold, in cents
+func (m Month) ADR() int64 {
+	if sold := m.Sold(); sold > 0 {
+		return m.Revenue / int64(sold)
+	}
+	return 0
+}
+
+// Report holds the occupancy and revenue of the rooms for the nights between From and To, inclusive.
+// Reservations are counted with Add.
+type Report struct {
+	From   time.Time
+	To     time.Time
+	Rooms  []model.Room
+	Months []Month
+	// Arrivals counts the reservations arriving between From and To, whatever their status
+	Arrivals  int
+	Cancelled int
+
+	// the arrivals that stayed, how many nights and how long before arriving they were booked
+	stays      int
+	stayNights int
+	leadDays   int
+	roomIndex  map[int]int
+}
+
+// New returns an empty report of rooms for the nights from from to to, inclusive
+func New(rooms []model.Room, from, to time.Time) *Report {
+	r := &Report{
+		From:      from,
+		To:        to,
+		Rooms:     rooms,
+		roomIndex: make(map[int]int, len(rooms)),
+	}
+	for i, room := range rooms {
+		r.roomIndex[room.ID] = i
+	}
+
+	end := to.AddDate(0, 0, 1)
+	for start := monthStart(from); start.Before(end); start = start.AddDate(0, 1, 0) {
+		first, next := start, start.AddDate(0, 1, 0)
+		if first.Before(from) {
+			first = from
+		}
+		if next.After(end) {
+			next = end
+		}
+		r.Months = append(r.Months, Month{
+			Start:     start,
+			Available: days(first, next),
+			Nights:    make([]int, len(rooms)),
+		})
+	}
+
+	return r
+}
+
+// Add counts a reservation in the report
+func (r *Report) Add(res model.Reservation) {
+	if !res.StartDate.Before(r.From) && !res.StartDate.After(r.To) {
+		r.Arrivals++
+		switch {
+		case res.Status == model.StatusCancelled:
+			r.Cancelled++
+		case model.HoldsRoom(res.Status):
+			r.stays++
+			r.stayNights += res.Nights()
+			if lead := days(res.CreatedAt, res.StartDate); lead > 0 {
+				r.leadDays += lead
+			}
+		}
+	}
+
+	room, ok := r.roomIndex[res.RoomID]
+	nights := res.Nights()
+	if !ok || nights <= 0 || !model.HoldsRoom(res.Status) {
+		return
+	}
+
+	// the price is spread over the nights, the cents that don't divide going to the first ones
+	price := res.Price()
+	perNight, rest := price/int64(nights), price%int64(nights)
+
+	end := r.To.AddDate(0, 0, 1)
+	for i, night := 0, res.StartDate; i < nights; i, night = i+1, night.AddDate(0, 0, 1) {
+		if night.Before(r.From) || !night.Before(end) {
+			continue
+		}
+		m := &r.Months[monthsBetween(r.Months[0].Start, night)]
+		m.Nights[room]++
+		m.Revenue += perNight
+		if int64(i) < rest {
+			m.Revenue++
+		}
+	}
+}
+
+// Sold returns the nights sold in the report
+func (r *Report) Sold() int {
+	var sold int
+	for _, m := range r.Months {
+		sold += m.Sold()
+	}
+	return sold
+}
+
+// Revenue returns the revenue of the nights sold in the report, in cents
+func (r *Report) Revenue() int64 {
+	var revenue int64
+	for _, m := range r.Months {
+		revenue += m.Revenue
+	}
+	return revenue
+}
+
+// Occupancy returns the percentage of the nights of the report that were sold
+func (r *Report) Occupancy() float64 {
+	return percent(r.Sold(), days(r.From, r.To.AddDate(0, 0, 1))*len(r.Rooms))
+}
+
+// ADR returns the average daily rate over the report, in cents
+func (r *Report) ADR() int64 {
+	if sold := r.Sold(); sold > 0 {
+		return r.Revenue() / int64(sold)
+	}
+	return 0
+}
+
+// AverageStay returns the average nights of the arrivals that stayed
+func (r *Report) AverageStay() float64 {
+	if r.stays == 0 {
+		return 0
+	}
+	return float64(r.stayNights) / float64(r.stays)
+}
+
+// AverageLeadTime returns how many days before arriving the arrivals that stayed booked, on average
+func (r *Report) AverageLeadTime() float64 {
+	if r.stays == 0 {
+		return 0
+	}
+	return float64(r.leadDays) / float64(r.stays)
+}
+
+// CancellationRate returns the percentage of the arrivals that were cancelled
+func (r *Report) CancellationRate() float64 {
+	return percent(r.Cancelled, r.Arrivals)
+}
+
+// percent returns n as a percentage of total, 0 when total is 0
+func percent(n, total int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// days returns the whole days from start to end
+func days(start, end time.Time) int {
+	return int(end.Sub(start).Hours() / 24)
+}
+
+// monthStart returns the first day of the month of t
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// monthsBetween returns how many months t is after the month starting at start
+func monthsBetween(start, t time.Time) int {
+	return (t.Year()-start.Year())*12 + int(t.Month()) - int(start.Month())
+}
@@ -0,0 +1,100 @@
+package report
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestReport(t *testing.T) {
+	rooms := []model.Room{
+		{ID: 1, RoomName: "General's Quarters", NightlyRate: 10000},
+		{ID: 2, RoomName: "Major's Suite", NightlyRate: 20000},
+	}
+	// January 15 to February 14, 17 nights in January and 14 in February
+	r := New(rooms, date(2050, 1, 15), date(2050, 2, 14))
+
+	reservations := []model.Reservation{
+		// 2 of its 4 nights are before the report, booked 10 days ahead
+		{RoomID: 1, Room: rooms[0], StartDate: date(2050, 1, 13), EndDate: date(2050, 1, 17), Status: model.StatusCheckedOut,
+			CreatedAt: date(2050, 1, 3)},
+		// over the end of January, with a discount spread over 3 nights
+		{RoomID: 2, Room: rooms[1], StartDate: date(2050, 1, 30), EndDate: date(2050, 2, 2), Status: model.StatusConfirmed,
+			Discount: 1000, CreatedAt: date(2050, 1, 20)},
+		// cancelled, counts as an arrival only
+		{RoomID: 1, Room: rooms[0], StartDate: date(2050, 2, 1), EndDate: date(2050, 2, 5), Status: model.StatusCancelled,
+			CreatedAt: date(2050, 1, 1)},
+		// no-show, neither sold nor cancelled
+		{RoomID: 1, Room: rooms[0], StartDate: date(2050, 2, 10), EndDate: date(2050, 2, 11), Status: model.StatusNoShow,
+			CreatedAt: date(2050, 2, 1)},
+		// last night after the report
+		{RoomID: 1, Room: rooms[0], StartDate: date(2050, 2, 14), EndDate: date(2050, 2, 16), Status: model.StatusPending,
+			CreatedAt: date(2050, 2, 14)},
+	}
+	for _, res := range reservations {
+		r.Add(res)
+	}
+
+	if len(r.Months) != 2 {
+		t.Fatalf("expected 2 months, got %d", len(r.Months))
+	}
+
+	jan, feb := r.Months[0], r.Months[1]
+	if jan.Available != 17 || feb.Available != 14 {
+		t.Errorf("expected 17 and 14 nights available, got %d and %d", jan.Available, feb.Available)
+	}
+	if jan.Nights[0] != 2 || jan.Nights[1] != 2 || feb.Nights[0] != 1 || feb.Nights[1] != 1 {
+		t.Errorf("unexpected nights sold, January %v, February %v", jan.Nights, feb.Nights)
+	}
+	// 2 nights of room 1 and 2 of the 3 nights of room 2 costing 59000 over 3 nights, the extra cent on the first
+	if jan.Revenue != 20000+19667+19667 {
+		t.Errorf("expected January revenue 59334, got %d", jan.Revenue)
+	}
+	if feb.Revenue != 19666+10000 {
+		t.Errorf("expected February revenue 29666, got %d", feb.Revenue)
+	}
+	if got := jan.RoomOccupancy(0); math.Abs(got-2*100.0/17) > 0.001 {
+		t.Errorf("expected room 1 January occupancy %.3f, got %.3f", 2*100.0/17, got)
+	}
+	if got := feb.Occupancy(); math.Abs(got-2*100.0/28) > 0.001 {
+		t.Errorf("expected February occupancy %.3f, got %.3f", 2*100.0/28, got)
+	}
+
+	if r.Sold() != 6 || r.Revenue() != 89000 || r.ADR() != 14833 {
+		t.Errorf("expected 6 nights sold for 89000 at 14833, got %d for %d at %d", r.Sold(), r.Revenue(), r.ADR())
+	}
+	if got := r.Occupancy(); math.Abs(got-6*100.0/62) > 0.001 {
+		t.Errorf("expected occupancy %.3f, got %.3f", 6*100.0/62, got)
+	}
+
+	// arrivals in the report: the stay from January 30, the cancelled one, the no-show and the one from February 14
+	if r.Arrivals != 4 || r.Cancelled != 1 {
+		t.Errorf("expected 4 arrivals and 1 cancelled, got %d and %d", r.Arrivals, r.Cancelled)
+	}
+	if r.CancellationRate() != 25 {
+		t.Errorf("expected a cancellation rate of 25%%, got %f", r.CancellationRate())
+	}
+	if r.AverageStay() != 2.5 {
+		t.Errorf("expected an average stay of 2.5 nights, got %f", r.AverageStay())
+	}
+	if r.AverageLeadTime() != 5 {
+		t.Errorf("expected an average lead time of 5 days, got %f", r.AverageLeadTime())
+	}
+}
+
+func TestReport_Empty(t *testing.T) {
+	r := New(nil, date(2050, 1, 1), date(2050, 12, 31))
+
+	if len(r.Months) != 12 {
+		t.Errorf("expected 12 months, got %d", len(r.Months))
+	}
+	if r.Occupancy() != 0 || r.ADR() != 0 || r.AverageStay() != 0 || r.AverageLeadTime() != 0 || r.CancellationRate() != 0 {
+		t.Error("expected zero figures for an empty report")
+	}
+}
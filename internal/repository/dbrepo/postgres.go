@@ -2,10 +2,15 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com.br/Leodf/bookings/internal/model"
+	"github.com.br/Leodf/bookings/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -14,14 +19,211 @@ func (r *postgresDBRepo) InsertReservation(res model.Reservation) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	return insertReservation(ctx, r.DB, res)
+}
+
+// InsertReservationWithRestriction inserts a reservation and its room restriction in one transaction,
+// failing with repository.ErrRoomUnavailable if the room is taken for the dates, or with
+// repository.ErrPromotionUsedUp if its promotion has no uses left. The hold holdID, if not 0, is
+// released in the same transaction, so the room the guest held doesn't count against them.
+func (r *postgresDBRepo) InsertReservationWithRestriction(res model.Reservation, holdID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// keep other bookings from taking the room between the check and the insert
+	err = lockRestrictions(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if holdID != 0 {
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where id = $1 and restriction_id = $2`, holdID, model.RestrictionHold)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var numRows int
+	query := `select count(id) from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date
+	and (expires_at is null or expires_at > now())`
+	err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate).Scan(&numRows)
+	if err != nil {
+		return 0, err
+	}
+	if numRows > 0 {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	// the lock keeps the uses of the promotion from changing until the reservation is in
+	if res.PromotionID != 0 {
+		var maxUses, maxUsesPerGuest int
+		query = `select max_uses, max_uses_per_guest from promotions where id = $1`
+		err = tx.QueryRowContext(ctx, query, res.PromotionID).Scan(&maxUses, &maxUsesPerGuest)
+		if err != nil {
+			return 0, err
+		}
+
+		uses, guestUses, err := countPromotionUses(ctx, tx, res.PromotionID, res.Email)
+		if err != nil {
+			return 0, err
+		}
+		if (maxUses > 0 && uses >= maxUses) || (maxUsesPerGuest > 0 && guestUses >= maxUsesPerGuest) {
+			return 0, repository.ErrPromotionUsedUp
+		}
+	}
+
+	newID, err := insertReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, created_at, updated_at, restriction_id)
+	values ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = tx.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.RoomID, newID, time.Now(), time.Now(), 1)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// lockRestrictions locks the room restrictions against concurrent writes until tx ends, so an
+// availability check made in tx still holds when tx inserts. Reads aren't blocked.
+func lockRestrictions(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `lock table room_restrictions in share row exclusive mode`)
+	return err
+}
+
+// importBatchSize is how many restrictions ImportRestrictions checks and writes per statement
+const importBatchSize = 500
+
+// ImportRestrictions inserts reservations and owner blocks, given as their room restrictions, in one
+// transaction and in batches. It fails with repository.ErrRoomUnavailable, inserting nothing, if any
+// of them overlaps a restriction already in the database.
+func (r *postgresDBRepo) ImportRestrictions(restrictions []model.RoomRestrictions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// keep bookings from taking the rooms between the check of a batch and its insert
+	err = lockRestrictions(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(restrictions); start += importBatchSize {
+		batch := restrictions[start:min(start+importBatchSize, len(restrictions))]
+
+		var values []string
+		var args []any
+		for _, rr := range batch {
+			values = append(values, fmt.Sprintf("($%d::int, $%d::date, $%d::date)", len(args)+1, len(args)+2, len(args)+3))
+			args = append(args, rr.RoomID, rr.StartDate, rr.EndDate)
+		}
+
+		var numRows int
+		query := `select count(rr.id) from room_restrictions rr
+			join (values ` + strings.Join(values, ", ") + `) v(room_id, start_date, end_date)
+			on rr.room_id = v.room_id and v.start_date < rr.end_date and v.end_date > rr.start_date
+			where rr.expires_at is null or rr.expires_at > now()`
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&numRows)
+		if err != nil {
+			return err
+		}
+		if numRows > 0 {
+			return repository.ErrRoomUnavailable
+		}
+
+		values, args = nil, nil
+		for _, rr := range batch {
+			var reservationID sql.NullInt64
+			if rr.RestrictionID == model.RestrictionReservation {
+				id, err := insertReservation(ctx, tx, rr.Reservation)
+				if err != nil {
+					return err
+				}
+				reservationID = sql.NullInt64{Int64: int64(id), Valid: true}
+			}
+
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+			args = append(args, rr.StartDate, rr.EndDate, rr.RoomID, reservationID, rr.RestrictionID, time.Now(), time.Now())
+		}
+
+		stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+		values ` + strings.Join(values, ", ")
+		_, err = tx.ExecContext(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func insertReservation(ctx context.Context, db queryRower, res model.Reservation) (int, error) {
 	var newID int
 
+	status := res.Status
+	if status == "" {
+		status = model.StatusPending
+	}
+	source := res.Source
+	if source == "" {
+		source = model.SourceWeb
+	}
+
+	var confirmedAt sql.NullTime
+	if status == model.StatusConfirmed {
+		confirmedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	checkoutStartedAt := sql.NullTime{Time: res.CheckoutStartedAt, Valid: !res.CheckoutStartedAt.IsZero()}
+
+	adults := res.Adults
+	if adults < 1 {
+		adults = 1
+	}
+
+	guestID := res.GuestID
+	if guestID == 0 {
+		var err error
+		guestID, err = upsertGuest(ctx, db, res)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	taxes, err := marshalTaxes(res.Taxes)
+	if err != nil {
+		return 0, err
+	}
+
 	stmt := `insert into reservations 
-					(first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at)
-					values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+					(first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at, status, source, processed, confirmed_at, guest_id,
+					adults, children, rate_plan_id, promotion_id, discount, taxes, checkout_started_at)
+					values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 					returning id
 					`
-	err := r.DB.QueryRowContext(ctx, stmt,
+	err = db.QueryRowContext(ctx, stmt,
 		res.FirstName,
 		res.LastName,
 		res.Email,
@@ -31,8 +233,19 @@ func (r *postgresDBRepo) InsertReservation(res model.Reservation) (int, error) {
 		res.RoomID,
 		time.Now(),
 		time.Now(),
+		status,
+		source,
+		res.Processed,
+		confirmedAt,
+		sql.NullInt64{Int64: int64(guestID), Valid: guestID > 0},
+		adults,
+		res.Children,
+		sql.NullInt64{Int64: int64(res.RatePlanID), Valid: res.RatePlanID > 0},
+		sql.NullInt64{Int64: int64(res.PromotionID), Valid: res.PromotionID > 0},
+		res.Discount,
+		taxes,
+		checkoutStartedAt,
 	).Scan(&newID)
-
 	if err != nil {
 		return 0, err
 	}
@@ -40,6 +253,43 @@ func (r *postgresDBRepo) InsertReservation(res model.Reservation) (int, error) {
 	return newID, nil
 }
 
+// marshalTaxes encodes the tax lines of a reservation for its jsonb column
+func marshalTaxes(taxes []model.TaxLine) ([]byte, error) {
+	if taxes == nil {
+		taxes = []model.TaxLine{}
+	}
+	return json.Marshal(taxes)
+}
+
+// guestEmail normalizes an email so the same guest is matched however they typed it
+func guestEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// upsertGuest finds or creates the guest for the reservation email, refreshing their contact details,
+// and returns its id; reservations without an email have no guest and get 0
+func upsertGuest(ctx context.Context, db queryRower, res model.Reservation) (int, error) {
+	email := guestEmail(res.Email)
+	if email == "" {
+		return 0, nil
+	}
+
+	var id int
+	stmt := `insert into guests (first_name, last_name, email, phone, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6)
+		on conflict (email) do update set
+			first_name = excluded.first_name,
+			last_name = excluded.last_name,
+			phone = coalesce(nullif(excluded.phone, ''), guests.phone),
+			updated_at = excluded.updated_at
+		returning id`
+	err := db.QueryRowContext(ctx, stmt, res.FirstName, res.LastName, email, res.Phone, time.Now(), time.Now()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
 // InsertRoomRestriction inserts a room restriction into the database
 func (r *postgresDBRepo) InsertRoomRestriction(rr model.RoomRestrictions) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -76,7 +326,8 @@ func (r *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 		from
 			room_restrictions 
 		where
-			room_id = $1 and $2 < end_date and $3 > start_date`
+			room_id = $1 and $2 < end_date and $3 > start_date and
+			(expires_at is null or expires_at > now())`
 
 	row := r.DB.QueryRowContext(ctx, query, roomID, start, end)
 	err := row.Scan(&numRows)
@@ -90,7 +341,8 @@ func (r *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 }
 
 // SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
-func (r *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]model.Room, error) {
+// that can hold a party of partySize people
+func (r *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time, partySize int) ([]model.Room, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -98,15 +350,17 @@ func (r *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 
 	query := `--sql
 		select
-			r.id, r.room_name
+			r.id, r.room_name, r.max_occupancy, r.nightly_rate
 		from
 			rooms r
 		where
+			r.max_occupancy >= $3 and
 			r.id not in (
 				select rr.room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date
+				and (rr.expires_at is null or rr.expires_at > now())
 			)
 		`
-	rows, err := r.DB.QueryContext(ctx, query, start, end)
+	rows, err := r.DB.QueryContext(ctx, query, start, end, partySize)
 	if err != nil {
 		return rooms, err
 	}
@@ -115,6 +369,8 @@ func (r *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 		err := rows.Scan(
 			&room.ID,
 			&room.RoomName,
+			&room.MaxOccupancy,
+			&room.NightlyRate,
 		)
 		if err != nil {
 			return rooms, err
@@ -138,12 +394,14 @@ func (r *postgresDBRepo) GetRoomByID(id int) (model.Room, error) {
 	var room model.Room
 
 	query := `
-		select id, room_name, created_at, updated_at from rooms where id = $1
+		select id, room_name, max_occupancy, nightly_rate, created_at, updated_at from rooms where id = $1
 	`
 	row := r.DB.QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&room.ID,
 		&room.RoomName,
+		&room.MaxOccupancy,
+		&room.NightlyRate,
 		&room.CreatedAt,
 		&room.UpdatedAt,
 	)
@@ -219,81 +477,91 @@ func (r *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	return id, hashedPassword, nil
 }
 
-// AllReservations returns a slice of all reservations
-func (r *postgresDBRepo) AllReservations() ([]model.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
+// AllReservations returns the reservations matching f
+func (r *postgresDBRepo) AllReservations(f model.ReservationFilter) ([]model.Reservation, error) {
 	var reservations []model.Reservation
 
-	query := `
-		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-		rm.id, rm.room_name
-		from reservations r
-		left join rooms rm on (r.room_id = rm.id)
-		order by r.start_date asc
-		`
-
-	rows, err := r.DB.QueryContext(ctx, query)
-	if err != nil {
-		return reservations, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var i model.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Processed,
-			&i.Room.ID,
-			&i.Room.RoomName,
-		)
-		if err != nil {
-			return reservations, err
-		}
-		reservations = append(reservations, i)
-	}
+	err := r.EachReservation(f, func(res model.Reservation) error {
+		reservations = append(reservations, res)
+		return nil
+	})
 
-	if err = rows.Err(); err != nil {
-		return reservations, err
-	}
+	return reservations, err
+}
 
-	return reservations, nil
+// AllNewReservations returns the reservations matching f staff haven't processed yet
+func (r *postgresDBRepo) AllNewReservations(f model.ReservationFilter) ([]model.Reservation, error) {
+	f.New = true
+	return r.AllReservations(f)
 }
 
-// AllNewReservations returns a slice of all new reservations
-func (r *postgresDBRepo) AllNewReservations() ([]model.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// EachReservation calls fn with the reservations matching f one at a time, by arrival, without
+// loading them all in memory. It stops at the first error fn returns.
+func (r *postgresDBRepo) EachReservation(f model.ReservationFilter, fn func(model.Reservation) error) error {
+	// exports stream every row to the client, so give them longer than a page query
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	var reservations []model.Reservation
+	where := []string{"r.deleted_at is null"}
+	var args []any
+
+	addWhere := func(clause string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+
+	if f.New {
+		where = append(where, "r.processed = 0")
+	}
+	if f.Status != "" {
+		addWhere("r.status = $%d", f.Status)
+	}
+	if f.Source != "" {
+		addWhere("r.source = $%d", f.Source)
+	}
+	if f.RoomID > 0 {
+		addWhere("r.room_id = $%d", f.RoomID)
+	}
+	switch {
+	case f.During:
+		if !f.From.IsZero() {
+			addWhere("r.end_date > $%d", f.From)
+		}
+		if !f.To.IsZero() {
+			addWhere("r.start_date <= $%d", f.To)
+		}
+	default:
+		if !f.From.IsZero() {
+			addWhere("r.start_date >= $%d", f.From)
+		}
+		if !f.To.IsZero() {
+			addWhere("r.start_date <= $%d", f.To)
+		}
+	}
+	if f.Query != "" {
+		addWhere("(r.first_name || ' ' || r.last_name || ' ' || r.email) ilike $%d", "%"+f.Query+"%")
+	}
 
 	query := `
-		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at,
-		rm.id, rm.room_name
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
+		r.status, r.source, r.adults, r.children, coalesce(rm.id, 0), coalesce(rm.room_name, ''), coalesce(rm.nightly_rate, 0),
+		r.cancellation_penalty, r.discount, coalesce(p.code, ''), r.taxes
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
-		where processed = 0
-		order by r.start_date asc
+		left join promotions p on (r.promotion_id = p.id)
+		where ` + strings.Join(where, " and ") + `
+		order by r.start_date asc, r.id asc
 		`
 
-	rows, err := r.DB.QueryContext(ctx, query)
+	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return reservations, err
+		return err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var i model.Reservation
+		var taxes []byte
 		err := rows.Scan(
 			&i.ID,
 			&i.FirstName,
@@ -305,20 +573,35 @@ func (r *postgresDBRepo) AllNewReservations() ([]model.Reservation, error) {
 			&i.RoomID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Processed,
+			&i.Status,
+			&i.Source,
+			&i.Adults,
+			&i.Children,
 			&i.Room.ID,
 			&i.Room.RoomName,
+			&i.Room.NightlyRate,
+			&i.CancellationPenalty,
+			&i.Discount,
+			&i.PromoCode,
+			&taxes,
 		)
 		if err != nil {
-			return reservations, err
+			return err
 		}
-		reservations = append(reservations, i)
-	}
 
-	if err = rows.Err(); err != nil {
-		return reservations, err
+		err = json.Unmarshal(taxes, &i.Taxes)
+		if err != nil {
+			return err
+		}
+
+		err = fn(i)
+		if err != nil {
+			return err
+		}
 	}
 
-	return reservations, nil
+	return rows.Err()
 }
 
 // GetReservationByID gets a reservation by ID
@@ -327,12 +610,20 @@ func (r *postgresDBRepo) GetReservationByID(id int) (model.Reservation, error) {
 	defer cancel()
 
 	var res model.Reservation
+	var confirmedAt, checkedInAt, checkedOutAt, cancelledAt, noShowAt, deletedAt sql.NullTime
+	var taxes []byte
 
 	query := `
 		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-		rm.id, rm.room_name
+		r.status, r.source, r.confirmed_at, r.checked_in_at, r.checked_out_at, r.cancelled_at, r.no_show_at, r.deleted_at,
+		r.adults, r.children, rm.id, rm.room_name, rm.max_occupancy, rm.nightly_rate, coalesce(g.id, 0), coalesce(g.vip, false), coalesce(g.blocked, false),
+		r.cancellation_penalty, r.cancellation_refund, coalesce(rp.id, 0), coalesce(rp.name, ''), coalesce(rp.free_cancellation_days, 0), coalesce(rp.penalty_percent, 0),
+		r.discount, coalesce(p.id, 0), coalesce(p.code, ''), r.taxes
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
+		left join guests g on (r.guest_id = g.id)
+		left join rate_plans rp on (r.rate_plan_id = rp.id)
+		left join promotions p on (r.promotion_id = p.id)
 		where r.id = $1
 		`
 
@@ -350,12 +641,52 @@ func (r *postgresDBRepo) GetReservationByID(id int) (model.Reservation, error) {
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&res.Status,
+		&res.Source,
+		&confirmedAt,
+		&checkedInAt,
+		&checkedOutAt,
+		&cancelledAt,
+		&noShowAt,
+		&deletedAt,
+		&res.Adults,
+		&res.Children,
 		&res.Room.ID,
 		&res.Room.RoomName,
+		&res.Room.MaxOccupancy,
+		&res.Room.NightlyRate,
+		&res.Guest.ID,
+		&res.Guest.VIP,
+		&res.Guest.Blocked,
+		&res.CancellationPenalty,
+		&res.CancellationRefund,
+		&res.RatePlan.ID,
+		&res.RatePlan.Name,
+		&res.RatePlan.FreeCancellationDays,
+		&res.RatePlan.PenaltyPercent,
+		&res.Discount,
+		&res.PromotionID,
+		&res.PromoCode,
+		&taxes,
 	)
 	if err != nil {
 		return res, err
 	}
+
+	err = json.Unmarshal(taxes, &res.Taxes)
+	if err != nil {
+		return res, err
+	}
+
+	res.ConfirmedAt = confirmedAt.Time
+	res.CheckedInAt = checkedInAt.Time
+	res.CheckedOutAt = checkedOutAt.Time
+	res.CancelledAt = cancelledAt.Time
+	res.NoShowAt = noShowAt.Time
+	res.DeletedAt = deletedAt.Time
+	res.GuestID = res.Guest.ID
+	res.RatePlanID = res.RatePlan.ID
+
 	return res, nil
 }
 
@@ -364,103 +695,307 @@ func (r *postgresDBRepo) UpdateReservation(rm model.Reservation) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `update reservations set first_name=$1, last_name=$2, email=$3, phone=$4, updated_at=$5 where id=$6`
+	query := `update reservations set first_name=$1, last_name=$2, email=$3, phone=$4, adults=greatest($5, 1), children=$6, updated_at=$7
+		where id=$8`
 
-	_, err := r.DB.ExecContext(ctx, query, rm.FirstName, rm.LastName, rm.Email, rm.Phone, time.Now(), rm.ID)
+	_, err := r.DB.ExecContext(ctx, query, rm.FirstName, rm.LastName, rm.Email, rm.Phone, rm.Adults, rm.Children, time.Now(), rm.ID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// DeleteReservation deletes a one reservation by ID
-func (r *postgresDBRepo) DeleteReservation(id int) error {
+// UpdateReservationDatesAndRoom moves a reservation to new dates and/or room, with the discount and taxes
+// of the new stay, updating its room restriction.
+// The reservation's own restriction is ignored when checking availability.
+func (r *postgresDBRepo) UpdateReservationDatesAndRoom(res model.Reservation) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `delete from reservations where id = $1`
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	_, err := r.DB.ExecContext(ctx, query, id)
+	var status string
+	err = tx.QueryRowContext(ctx, `select status from reservations where id = $1 for update`, res.ID).Scan(&status)
 	if err != nil {
 		return err
 	}
-	return nil
-}
 
-// UpdateProcessedForReservation updates the processed status of a reservation
-func (r *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	if model.HoldsRoom(status) {
+		// keep other bookings from taking the room between the check and the update
+		err = lockRestrictions(ctx, tx)
+		if err != nil {
+			return err
+		}
 
-	query := `update reservations set processed = $1 where id = $2`
+		var numRows int
+		query := `
+			select count(id) from room_restrictions
+			where room_id = $1 and $2 < end_date and $3 > start_date
+			and (reservation_id is null or reservation_id <> $4)
+			and (expires_at is null or expires_at > now())`
+		err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate, res.ID).Scan(&numRows)
+		if err != nil {
+			return err
+		}
+		if numRows > 0 {
+			return repository.ErrRoomUnavailable
+		}
+	}
 
-	_, err := r.DB.ExecContext(ctx, query, processed, id)
+	taxes, err := marshalTaxes(res.Taxes)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	query := `update reservations set start_date = $1, end_date = $2, room_id = $3, discount = $4, taxes = $5, updated_at = $6
+	where id = $7`
+	_, err = tx.ExecContext(ctx, query, res.StartDate, res.EndDate, res.RoomID, res.Discount, taxes, time.Now(), res.ID)
+	if err != nil {
+		return err
+	}
+
+	query = `update room_restrictions set start_date = $1, end_date = $2, room_id = $3, updated_at = $4 where reservation_id = $5`
+	_, err = tx.ExecContext(ctx, query, res.StartDate, res.EndDate, res.RoomID, time.Now(), res.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// AllRooms returns a slice of all rooms
-func (r *postgresDBRepo) AllRooms() ([]model.Room, error) {
+// DeleteReservation moves a reservation to the trash and frees its room restrictions
+func (r *postgresDBRepo) DeleteReservation(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var rooms []model.Room
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	query := `
-		select id, room_name, created_at, updated_at
-		from rooms
-		order by room_name
-		`
+	query := `update reservations set deleted_at = $1, updated_at = $1 where id = $2 and deleted_at is null`
 
-	rows, err := r.DB.QueryContext(ctx, query)
+	result, err := tx.ExecContext(ctx, query, time.Now(), id)
 	if err != nil {
-		return rooms, err
+		return err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var rm model.Room
-		err := rows.Scan(
-			&rm.ID,
-			&rm.RoomName,
-			&rm.CreatedAt,
-			&rm.UpdatedAt,
-		)
-		if err != nil {
-			return rooms, err
-		}
-		rooms = append(rooms, rm)
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
 	}
 
-	if err = rows.Err(); err != nil {
-		return rooms, err
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+	if err != nil {
+		return err
 	}
 
-	return rooms, nil
+	return tx.Commit()
 }
 
-// GetRestrictionsForRoomByDate returns restrictions for a room by date range
-func (r *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]model.RoomRestrictions, error) {
+// RestoreReservation takes a reservation out of the trash, taking its room back if still free
+func (r *postgresDBRepo) RestoreReservation(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var restrictions []model.RoomRestrictions
-
-	query := `
-		select id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date
-		from room_restrictions where $1 < end_date and $2 >= start_date and room_id = $3
-	`
-
-	rows, err := r.DB.QueryContext(ctx, query, start, end, roomID)
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer tx.Rollback()
+
+	var res model.Reservation
+	query := `select id, room_id, start_date, end_date, status from reservations where id = $1 and deleted_at is not null for update`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&res.ID, &res.RoomID, &res.StartDate, &res.EndDate, &res.Status)
+	if err != nil {
+		return err
+	}
+
+	if model.HoldsRoom(res.Status) {
+		// keep other bookings from taking the room between the check and the insert
+		err = lockRestrictions(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		var numRows int
+		query = `select count(id) from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date
+		and (expires_at is null or expires_at > now())`
+		err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate).Scan(&numRows)
+		if err != nil {
+			return err
+		}
+		if numRows > 0 {
+			return repository.ErrRoomUnavailable
+		}
+
+		stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id, created_at, updated_at, restriction_id)
+		values ($1, $2, $3, $4, $5, $6, $7)`
+		_, err = tx.ExecContext(ctx, stmt, res.StartDate, res.EndDate, res.RoomID, res.ID, time.Now(), time.Now(), 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set deleted_at = null, updated_at = $1 where id = $2`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeReservation permanently removes a reservation from the trash
+func (r *postgresDBRepo) PurgeReservation(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `delete from reservations where id = $1 and deleted_at is not null`
+
+	result, err := r.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AllDeletedReservations returns a slice of the reservations in the trash
+func (r *postgresDBRepo) AllDeletedReservations() ([]model.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []model.Reservation
+
+	query := `
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at,
+		r.status, r.deleted_at, rm.id, rm.room_name
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.deleted_at is not null
+		order by r.deleted_at desc
+		`
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i model.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Status,
+			&i.DeletedAt,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// UpdateProcessedForReservation updates the processed status of a reservation
+func (r *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update reservations set processed = $1 where id = $2`
+
+	_, err := r.DB.ExecContext(ctx, query, processed, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AllRooms returns a slice of all rooms
+func (r *postgresDBRepo) AllRooms() ([]model.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rooms []model.Room
+
+	query := `
+		select id, room_name, max_occupancy, nightly_rate, created_at, updated_at
+		from rooms
+		order by room_name
+		`
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rm model.Room
+		err := rows.Scan(
+			&rm.ID,
+			&rm.RoomName,
+			&rm.MaxOccupancy,
+			&rm.NightlyRate,
+			&rm.CreatedAt,
+			&rm.UpdatedAt,
+		)
+		if err != nil {
+			return rooms, err
+		}
+		rooms = append(rooms, rm)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// GetRestrictionsForRoomByDate returns restrictions for a room by date range
+func (r *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]model.RoomRestrictions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var restrictions []model.RoomRestrictions
+
+	query := `
+		select id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date, expires_at
+		from room_restrictions where $1 < end_date and $2 >= start_date and room_id = $3
+		and (expires_at is null or expires_at > now())
+	`
+
+	rows, err := r.DB.QueryContext(ctx, query, start, end, roomID)
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var r model.RoomRestrictions
+		var expiresAt sql.NullTime
 		err := rows.Scan(
 			&r.ID,
 			&r.ReservationID,
@@ -468,10 +1003,12 @@ func (r *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 			&r.RoomID,
 			&r.StartDate,
 			&r.EndDate,
+			&expiresAt,
 		)
 		if err != nil {
 			return nil, err
 		}
+		r.ExpiresAt = expiresAt.Time
 		restrictions = append(restrictions, r)
 	}
 
@@ -480,3 +1017,1687 @@ func (r *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 	}
 	return restrictions, nil
 }
+
+// statusTimestampColumns maps a reservation status to the column recording when it was reached
+var statusTimestampColumns = map[string]string{
+	model.StatusConfirmed:  "confirmed_at",
+	model.StatusCheckedIn:  "checked_in_at",
+	model.StatusCheckedOut: "checked_out_at",
+	model.StatusCancelled:  "cancelled_at",
+	model.StatusNoShow:     "no_show_at",
+}
+
+// UpdateReservationStatus moves a reservation to a new status, recording the transition in its history
+func (r *postgresDBRepo) UpdateReservationStatus(id int, status string, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateReservationStatus(ctx, tx, id, status, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CancelReservation cancels a reservation, recording the amounts in cents kept and given back for it and
+// the new status of its payments settled with the provider, all or nothing
+func (r *postgresDBRepo) CancelReservation(id, userID int, penalty, refund int64, payments []model.Payment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateReservationStatus(ctx, tx, id, model.StatusCancelled, userID)
+	if err != nil {
+		return err
+	}
+
+	query := `update reservations set cancellation_penalty = $1, cancellation_refund = $2 where id = $3`
+	_, err = tx.ExecContext(ctx, query, penalty, refund, id)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range payments {
+		query = `update payments set status = $1, updated_at = $2 where id = $3 and reservation_id = $4`
+		_, err = tx.ExecContext(ctx, query, p.Status, time.Now(), p.ID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// updateReservationStatus moves a reservation to a new status within tx, recording the transition in its history
+func updateReservationStatus(ctx context.Context, tx *sql.Tx, id int, status string, userID int) error {
+	column, ok := statusTimestampColumns[status]
+	if !ok {
+		return model.ErrInvalidTransition
+	}
+
+	var current string
+	err := tx.QueryRowContext(ctx, `select status from reservations where id = $1 for update`, id).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	if !model.CanTransition(current, status) {
+		return model.ErrInvalidTransition
+	}
+
+	now := time.Now()
+
+	query := fmt.Sprintf(`update reservations set status = $1, %s = $2, updated_at = $2 where id = $3`, column)
+	_, err = tx.ExecContext(ctx, query, status, now, id)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into reservation_status_history (reservation_id, from_status, to_status, user_id, created_at)
+	values ($1, $2, $3, $4, $5)`
+	_, err = tx.ExecContext(ctx, stmt, id, current, status, sql.NullInt64{Int64: int64(userID), Valid: userID > 0}, now)
+	if err != nil {
+		return err
+	}
+
+	// cancelled and no-show reservations give their dates back
+	if !model.HoldsRoom(status) {
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetStatusHistoryForReservation returns the status changes of a reservation, oldest first
+func (r *postgresDBRepo) GetStatusHistoryForReservation(id int) ([]model.ReservationStatusHistory, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var history []model.ReservationStatusHistory
+
+	query := `
+		select id, reservation_id, from_status, to_status, coalesce(user_id, 0), created_at
+		from reservation_status_history
+		where reservation_id = $1
+		order by created_at asc
+		`
+
+	rows, err := r.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return history, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h model.ReservationStatusHistory
+		err := rows.Scan(
+			&h.ID,
+			&h.ReservationID,
+			&h.FromStatus,
+			&h.ToStatus,
+			&h.UserID,
+			&h.CreatedAt,
+		)
+		if err != nil {
+			return history, err
+		}
+		history = append(history, h)
+	}
+
+	if err = rows.Err(); err != nil {
+		return history, err
+	}
+
+	return history, nil
+}
+
+// InsertBlockForRoom inserts an owner block for a room for one night, failing with
+// repository.ErrRoomUnavailable if the room is taken that night
+func (r *postgresDBRepo) InsertBlockForRoom(roomID int, startDate time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// keep other bookings from taking the room between the check and the insert
+	err = lockRestrictions(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	endDate := startDate.AddDate(0, 0, 1)
+
+	var numRows int
+	query := `select count(id) from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date
+	and (expires_at is null or expires_at > now())`
+	err = tx.QueryRowContext(ctx, query, roomID, startDate, endDate).Scan(&numRows)
+	if err != nil {
+		return 0, err
+	}
+	if numRows > 0 {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	var newID int
+
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6)
+	returning id`
+
+	err = tx.QueryRowContext(ctx, stmt, startDate, endDate, roomID, 2, time.Now(), time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// DeleteBlockByID deletes an owner block
+func (r *postgresDBRepo) DeleteBlockByID(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `delete from room_restrictions where id = $1 and reservation_id is null and restriction_id = $2`
+
+	_, err := r.DB.ExecContext(ctx, query, id, model.RestrictionBlock)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// InsertHold holds a room for the dates for ttl while a guest checks out, returning the hold id and
+// when it expires. It fails with repository.ErrRoomUnavailable if the room is taken for the dates.
+func (r *postgresDBRepo) InsertHold(roomID int, start, end time.Time, ttl time.Duration) (int, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	// keep other bookings from taking the room between the check and the insert
+	err = lockRestrictions(ctx, tx)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var numRows int
+	query := `select count(id) from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date
+	and (expires_at is null or expires_at > now())`
+	err = tx.QueryRowContext(ctx, query, roomID, start, end).Scan(&numRows)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if numRows > 0 {
+		return 0, time.Time{}, repository.ErrRoomUnavailable
+	}
+
+	// the expiry is computed by the database, so it compares with the now() of the availability queries
+	var id int
+	var expiresAt time.Time
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, expires_at, created_at, updated_at)
+	values ($1, $2, $3, $4, now() + $5 * interval '1 second', $6, $7)
+	returning id, expires_at`
+	err = tx.QueryRowContext(ctx, stmt, start, end, roomID, model.RestrictionHold, ttl.Seconds(), time.Now(), time.Now()).Scan(&id, &expiresAt)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, time.Time{}, err
+	}
+	return id, expiresAt, nil
+}
+
+// ReleaseHold gives back a room held for checkout
+func (r *postgresDBRepo) ReleaseHold(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `delete from room_restrictions where id = $1 and restriction_id = $2`
+
+	_, err := r.DB.ExecContext(ctx, query, id, model.RestrictionHold)
+	return err
+}
+
+// DeleteExpiredHolds removes the holds whose checkout time ran out, returning how many there were
+func (r *postgresDBRepo) DeleteExpiredHolds() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `delete from room_restrictions where restriction_id = $1 and expires_at <= now()`
+
+	result, err := r.DB.ExecContext(ctx, query, model.RestrictionHold)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CancelUnpaidReservations cancels the reservations whose online checkout started before a time and
+// was never paid, giving their dates back. Reservations that never went through online checkout are
+// left alone. It returns how many were cancelled.
+func (r *postgresDBRepo) CancelUnpaidReservations(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `select id, status, checkout_started_at from reservations
+	where status = $1 and checkout_started_at < $2 and deleted_at is null
+	for update`
+
+	rows, err := tx.QueryContext(ctx, query, model.StatusPending, before)
+	if err != nil {
+		return 0, err
+	}
+	var abandoned []int
+	for rows.Next() {
+		var res model.Reservation
+		var checkoutStartedAt sql.NullTime
+		err = rows.Scan(&res.ID, &res.Status, &checkoutStartedAt)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		res.CheckoutStartedAt = checkoutStartedAt.Time
+		if res.CheckoutAbandoned(before) {
+			abandoned = append(abandoned, res.ID)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range abandoned {
+		err = updateReservationStatus(ctx, tx, id, model.StatusCancelled, 0)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(abandoned)), nil
+}
+
+// InsertAuditEntry records an admin change in the audit log
+func (r *postgresDBRepo) InsertAuditEntry(e model.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into audit_log (user_id, action, entity, entity_id, changes, created_at)
+	values ($1, $2, $3, $4, $5, $6)`
+
+	_, err = r.DB.ExecContext(ctx, stmt,
+		sql.NullInt64{Int64: int64(e.UserID), Valid: e.UserID > 0},
+		e.Action,
+		e.Entity,
+		e.EntityID,
+		changes,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SearchAuditLog returns the audit log entries matching the filter, newest first
+func (r *postgresDBRepo) SearchAuditLog(f model.AuditFilter) ([]model.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []model.AuditEntry
+	var where []string
+	var args []any
+
+	addWhere := func(clause string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+
+	if f.UserID > 0 {
+		addWhere("a.user_id = $%d", f.UserID)
+	}
+	if f.Action != "" {
+		addWhere("a.action = $%d", f.Action)
+	}
+	if f.Entity != "" {
+		addWhere("a.entity = $%d", f.Entity)
+	}
+	if f.EntityID > 0 {
+		addWhere("a.entity_id = $%d", f.EntityID)
+	}
+	if f.Query != "" {
+		addWhere("a.changes::text ilike $%d", "%"+f.Query+"%")
+	}
+	if !f.From.IsZero() {
+		addWhere("a.created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		addWhere("a.created_at < $%d", f.To.AddDate(0, 0, 1))
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 500
+	}
+
+	query := `
+		select a.id, coalesce(a.user_id, 0), coalesce(u.first_name || ' ' || u.last_name, ''),
+		a.action, a.entity, a.entity_id, a.changes, a.created_at
+		from audit_log a
+		left join users u on (a.user_id = u.id)
+		`
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += fmt.Sprintf(" order by a.created_at desc limit %d", limit)
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e model.AuditEntry
+		var changes []byte
+		err := rows.Scan(
+			&e.ID,
+			&e.UserID,
+			&e.UserName,
+			&e.Action,
+			&e.Entity,
+			&e.EntityID,
+			&changes,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		err = json.Unmarshal(changes, &e.Changes)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+// GetGuestByEmail returns the guest with the given email
+func (r *postgresDBRepo) GetGuestByEmail(email string) (model.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var g model.Guest
+	query := `select id, first_name, last_name, email, phone, notes, vip, blocked, created_at, updated_at
+		from guests where email = $1`
+
+	err := r.DB.QueryRowContext(ctx, query, guestEmail(email)).Scan(
+		&g.ID,
+		&g.FirstName,
+		&g.LastName,
+		&g.Email,
+		&g.Phone,
+		&g.Notes,
+		&g.VIP,
+		&g.Blocked,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+	)
+	if err != nil {
+		return g, err
+	}
+
+	return g, nil
+}
+
+// GetGuestByID returns a guest with their stay totals
+func (r *postgresDBRepo) GetGuestByID(id int) (model.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var g model.Guest
+	query := guestSelect + ` where g.id = $1 group by g.id`
+
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(
+		&g.ID,
+		&g.FirstName,
+		&g.LastName,
+		&g.Email,
+		&g.Phone,
+		&g.Notes,
+		&g.VIP,
+		&g.Blocked,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+		&g.Stays,
+		&g.TotalNights,
+	)
+	if err != nil {
+		return g, err
+	}
+
+	return g, nil
+}
+
+// guestSelect selects guests with the stays and nights of their reservations that hold a room
+const guestSelect = `
+	select g.id, g.first_name, g.last_name, g.email, g.phone, g.notes, g.vip, g.blocked, g.created_at, g.updated_at,
+	count(r.id),
+	coalesce(sum(r.end_date - r.start_date), 0)
+	from guests g
+	left join reservations r on (r.guest_id = g.id and r.deleted_at is null and r.status not in ('cancelled', 'no_show'))`
+
+// AllGuests returns the guests whose name, email or phone match search, or all guests if search is empty
+func (r *postgresDBRepo) AllGuests(search string) ([]model.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var guests []model.Guest
+
+	query := guestSelect + `
+		where $1 = '' or g.first_name ilike $2 or g.last_name ilike $2 or g.email ilike $2 or g.phone ilike $2
+		group by g.id
+		order by g.last_name, g.first_name`
+
+	rows, err := r.DB.QueryContext(ctx, query, search, "%"+search+"%")
+	if err != nil {
+		return guests, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g model.Guest
+		err := rows.Scan(
+			&g.ID,
+			&g.FirstName,
+			&g.LastName,
+			&g.Email,
+			&g.Phone,
+			&g.Notes,
+			&g.VIP,
+			&g.Blocked,
+			&g.CreatedAt,
+			&g.UpdatedAt,
+			&g.Stays,
+			&g.TotalNights,
+		)
+		if err != nil {
+			return guests, err
+		}
+		guests = append(guests, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return guests, err
+	}
+
+	return guests, nil
+}
+
+// UpdateGuest updates a guest's details, notes and flags
+func (r *postgresDBRepo) UpdateGuest(g model.Guest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update guests set first_name = $1, last_name = $2, phone = $3, notes = $4, vip = $5, blocked = $6, updated_at = $7
+		where id = $8`
+
+	_, err := r.DB.ExecContext(ctx, query, g.FirstName, g.LastName, g.Phone, g.Notes, g.VIP, g.Blocked, time.Now(), g.ID)
+	return err
+}
+
+// GetReservationsForGuest returns the stay history of a guest, latest first
+func (r *postgresDBRepo) GetReservationsForGuest(guestID int) ([]model.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []model.Reservation
+
+	query := `
+		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at,
+		r.status, r.source, rm.id, rm.room_name, rm.nightly_rate, r.cancellation_penalty, r.discount, r.taxes,
+		coalesce(rp.id, 0), coalesce(rp.name, ''), coalesce(rp.free_cancellation_days, 0), coalesce(rp.penalty_percent, 0)
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		left join rate_plans rp on (r.rate_plan_id = rp.id)
+		where r.guest_id = $1 and r.deleted_at is null
+		order by r.start_date desc
+		`
+
+	rows, err := r.DB.QueryContext(ctx, query, guestID)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i model.Reservation
+		var taxes []byte
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Status,
+			&i.Source,
+			&i.Room.ID,
+			&i.Room.RoomName,
+			&i.Room.NightlyRate,
+			&i.CancellationPenalty,
+			&i.Discount,
+			&taxes,
+			&i.RatePlan.ID,
+			&i.RatePlan.Name,
+			&i.RatePlan.FreeCancellationDays,
+			&i.RatePlan.PenaltyPercent,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		if err = json.Unmarshal(taxes, &i.Taxes); err != nil {
+			return reservations, err
+		}
+		i.GuestID = guestID
+		i.RatePlanID = i.RatePlan.ID
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// RegisterGuest starts the registration of a guest, recording the token of the link emailed to confirm
+// the address and until when it can be used. The guest record made by earlier bookings with the same
+// email is kept as it is until then. It fails with repository.ErrGuestExists if the email already has a login.
+func (r *postgresDBRepo) RegisterGuest(g model.Guest, token string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	stmt := `insert into guests (first_name, last_name, email, phone, confirm_token, confirm_expires_at, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)
+		on conflict (email) do update set
+			confirm_token = excluded.confirm_token,
+			confirm_expires_at = excluded.confirm_expires_at,
+			updated_at = excluded.updated_at
+		where guests.password = ''
+		returning id`
+	err := r.DB.QueryRowContext(ctx, stmt,
+		g.FirstName,
+		g.LastName,
+		guestEmail(g.Email),
+		g.Phone,
+		token,
+		expiresAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrGuestExists
+	}
+	return err
+}
+
+// GetGuestByConfirmToken returns the guest a registration link that can still be used was sent to
+func (r *postgresDBRepo) GetGuestByConfirmToken(token string) (model.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var g model.Guest
+
+	query := `
+		select id, first_name, last_name, email, phone
+		from guests
+		where confirm_token = $1 and confirm_expires_at > $2 and password = ''
+		`
+
+	err := r.DB.QueryRowContext(ctx, query, token, time.Now()).Scan(
+		&g.ID,
+		&g.FirstName,
+		&g.LastName,
+		&g.Email,
+		&g.Phone,
+	)
+	return g, err
+}
+
+// ConfirmGuest creates the login of the guest a registration link was sent to, with the password
+// they chose, and uses up the link. It returns the guest id, or sql.ErrNoRows if the link can't be used.
+func (r *postgresDBRepo) ConfirmGuest(token, password string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	stmt := `update guests set password = $1, confirm_token = null, confirm_expires_at = null, updated_at = $2
+		where confirm_token = $3 and confirm_expires_at > $2 and password = ''
+		returning id`
+	err = r.DB.QueryRowContext(ctx, stmt, string(hashedPassword), time.Now(), token).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// AuthenticateGuest authenticates a guest account, returning the guest id
+func (r *postgresDBRepo) AuthenticateGuest(email, testPassword string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	var hashedPassword string
+
+	query := `select id, password from guests where email = $1`
+	err := r.DB.QueryRowContext(ctx, query, guestEmail(email)).Scan(&id, &hashedPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	// guests created by bookings have no login until they register
+	if hashedPassword == "" {
+		return 0, errors.New("guest has no account")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, errors.New("incorrect password")
+	} else if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// AllStayRules returns all the stay rules, with the name of their room
+func (r *postgresDBRepo) AllStayRules() ([]model.StayRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rules []model.StayRule
+
+	query := `
+		select s.id, coalesce(s.room_id, 0), s.name, s.season_start, s.season_end, s.min_nights, s.max_nights,
+		s.closed_to_arrival, s.closed_to_departure, s.min_advance_days, s.max_advance_days, s.created_at, s.updated_at,
+		coalesce(rm.room_name, '')
+		from stay_rules s
+		left join rooms rm on (s.room_id = rm.id)
+		order by s.season_start nulls first, s.id
+		`
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s model.StayRule
+		var seasonStart, seasonEnd sql.NullTime
+		err := rows.Scan(
+			&s.ID,
+			&s.RoomID,
+			&s.Name,
+			&seasonStart,
+			&seasonEnd,
+			&s.MinNights,
+			&s.MaxNights,
+			&s.ClosedToArrival,
+			&s.ClosedToDeparture,
+			&s.MinAdvanceDays,
+			&s.MaxAdvanceDays,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+			&s.Room.RoomName,
+		)
+		if err != nil {
+			return rules, err
+		}
+		s.SeasonStart = seasonStart.Time
+		s.SeasonEnd = seasonEnd.Time
+		s.Room.ID = s.RoomID
+		rules = append(rules, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// InsertStayRule inserts a stay rule and returns its id
+func (r *postgresDBRepo) InsertStayRule(rule model.StayRule) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	stmt := `insert into stay_rules (room_id, name, season_start, season_end, min_nights, max_nights,
+		closed_to_arrival, closed_to_departure, min_advance_days, max_advance_days, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		returning id`
+
+	err := r.DB.QueryRowContext(ctx, stmt,
+		sql.NullInt64{Int64: int64(rule.RoomID), Valid: rule.RoomID > 0},
+		rule.Name,
+		sql.NullTime{Time: rule.SeasonStart, Valid: !rule.SeasonStart.IsZero()},
+		sql.NullTime{Time: rule.SeasonEnd, Valid: !rule.SeasonEnd.IsZero()},
+		rule.MinNights,
+		rule.MaxNights,
+		rule.ClosedToArrival,
+		rule.ClosedToDeparture,
+		rule.MinAdvanceDays,
+		rule.MaxAdvanceDays,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// DeleteStayRule deletes a stay rule
+func (r *postgresDBRepo) DeleteStayRule(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, `delete from stay_rules where id = $1`, id)
+	return err
+}
+
+// InsertWaitlistEntry puts a guest on the waitlist for a room and returns the entry id
+func (r *postgresDBRepo) InsertWaitlistEntry(e model.WaitlistEntry) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	stmt := `insert into waitlist (room_id, email, start_date, end_date, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6)
+		returning id`
+
+	err := r.DB.QueryRowContext(ctx, stmt,
+		e.RoomID,
+		guestEmail(e.Email),
+		e.StartDate,
+		e.EndDate,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// PendingWaitlistEntries returns the upcoming waitlist entries for a room that haven't been
+// sent a booking link yet, first come first
+func (r *postgresDBRepo) PendingWaitlistEntries(roomID int) ([]model.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []model.WaitlistEntry
+
+	query := `
+		select w.id, w.room_id, w.email, w.start_date, w.end_date, w.created_at, w.updated_at, rm.room_name
+		from waitlist w
+		left join rooms rm on (w.room_id = rm.id)
+		where w.room_id = $1 and w.token is null and w.start_date >= current_date
+		order by w.created_at, w.id
+		`
+
+	rows, err := r.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e model.WaitlistEntry
+		err := rows.Scan(
+			&e.ID,
+			&e.RoomID,
+			&e.Email,
+			&e.StartDate,
+			&e.EndDate,
+			&e.CreatedAt,
+			&e.UpdatedAt,
+			&e.Room.RoomName,
+		)
+		if err != nil {
+			return entries, err
+		}
+		e.Room.ID = e.RoomID
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+// OfferWaitlistEntry records the booking link sent to a waitlisted guest and until when it can be used
+func (r *postgresDBRepo) OfferWaitlistEntry(id int, token string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update waitlist set token = $1, notified_at = $2, expires_at = $3, updated_at = $2 where id = $4`
+
+	_, err := r.DB.ExecContext(ctx, query, token, time.Now(), expiresAt, id)
+	return err
+}
+
+// GetWaitlistEntryByToken returns the waitlist entry a booking link was sent for
+func (r *postgresDBRepo) GetWaitlistEntryByToken(token string) (model.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var e model.WaitlistEntry
+	var notifiedAt, expiresAt, usedAt sql.NullTime
+
+	query := `
+		select w.id, w.room_id, w.email, w.start_date, w.end_date, coalesce(w.token, ''), w.notified_at, w.expires_at,
+		w.used_at, w.created_at, w.updated_at, rm.room_name
+		from waitlist w
+		left join rooms rm on (w.room_id = rm.id)
+		where w.token = $1
+		`
+
+	err := r.DB.QueryRowContext(ctx, query, token).Scan(
+		&e.ID,
+		&e.RoomID,
+		&e.Email,
+		&e.StartDate,
+		&e.EndDate,
+		&e.Token,
+		&notifiedAt,
+		&expiresAt,
+		&usedAt,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+		&e.Room.RoomName,
+	)
+	if err != nil {
+		return e, err
+	}
+	e.NotifiedAt = notifiedAt.Time
+	e.ExpiresAt = expiresAt.Time
+	e.UsedAt = usedAt.Time
+	e.Room.ID = e.RoomID
+
+	return e, nil
+}
+
+// UseWaitlistEntry records that the guest booked through the link sent for a waitlist entry
+func (r *postgresDBRepo) UseWaitlistEntry(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update waitlist set used_at = $1, updated_at = $1 where id = $2 and used_at is null`
+
+	_, err := r.DB.ExecContext(ctx, query, time.Now(), id)
+	return err
+}
+
+// InsertPayment records a payment for a reservation and returns its id
+func (r *postgresDBRepo) InsertPayment(p model.Payment) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	stmt := `insert into payments (reservation_id, provider, reference, amount, currency, status, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)
+		returning id`
+
+	err := r.DB.QueryRowContext(ctx, stmt,
+		p.ReservationID,
+		p.Provider,
+		p.Reference,
+		p.Amount,
+		p.Currency,
+		p.Status,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetPaymentByID returns a payment by id
+func (r *postgresDBRepo) GetPaymentByID(id int) (model.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p model.Payment
+
+	query := `
+		select id, reservation_id, provider, reference, amount, currency, status, created_at, updated_at
+		from payments
+		where id = $1
+		`
+
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(
+		&p.ID,
+		&p.ReservationID,
+		&p.Provider,
+		&p.Reference,
+		&p.Amount,
+		&p.Currency,
+		&p.Status,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+// GetPaymentsForReservation returns the payments of a reservation, oldest first
+func (r *postgresDBRepo) GetPaymentsForReservation(reservationID int) ([]model.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var payments []model.Payment
+
+	query := `
+		select id, reservation_id, provider, reference, amount, currency, status, created_at, updated_at
+		from payments
+		where reservation_id = $1
+		order by created_at, id
+		`
+
+	rows, err := r.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return payments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p model.Payment
+		err := rows.Scan(
+			&p.ID,
+			&p.ReservationID,
+			&p.Provider,
+			&p.Reference,
+			&p.Amount,
+			&p.Currency,
+			&p.Status,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return payments, err
+		}
+		payments = append(payments, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return payments, err
+	}
+
+	return payments, nil
+}
+
+// UpdatePaymentStatus sets the status of the payment the provider knows by reference
+func (r *postgresDBRepo) UpdatePaymentStatus(provider, reference, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `update payments set status = $1, updated_at = $2 where provider = $3 and reference = $4`
+
+	result, err := r.DB.ExecContext(ctx, query, status, time.Now(), provider, reference)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AllRatePlans returns the rate plans guests can book
+func (r *postgresDBRepo) AllRatePlans() ([]model.RatePlan, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var plans []model.RatePlan
+
+	query := `select id, name, free_cancellation_days, penalty_percent, created_at, updated_at from rate_plans order by id`
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return plans, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p model.RatePlan
+		err := rows.Scan(
+			&p.ID,
+			&p.Name,
+			&p.FreeCancellationDays,
+			&p.PenaltyPercent,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return plans, err
+		}
+		plans = append(plans, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return plans, err
+	}
+
+	return plans, nil
+}
+
+// GetRatePlanByID returns a rate plan by id
+func (r *postgresDBRepo) GetRatePlanByID(id int) (model.RatePlan, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p model.RatePlan
+
+	query := `select id, name, free_cancellation_days, penalty_percent, created_at, updated_at from rate_plans where id = $1`
+
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(
+		&p.ID,
+		&p.Name,
+		&p.FreeCancellationDays,
+		&p.PenaltyPercent,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	return p, err
+}
+
+// AllPromotions returns all the promotions, with the name of their room and how many reservations used them
+func (r *postgresDBRepo) AllPromotions() ([]model.Promotion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var promotions []model.Promotion
+
+	query := `
+		select p.id, p.code, p.description, p.discount_type, p.amount, p.valid_from, p.valid_to, coalesce(p.room_id, 0),
+		p.max_uses, p.max_uses_per_guest, p.created_at, p.updated_at, coalesce(rm.room_name, ''),
+		(select count(id) from reservations r where r.promotion_id = p.id and r.status <> $1 and r.deleted_at is null)
+		from promotions p
+		left join rooms rm on (p.room_id = rm.id)
+		order by p.code
+		`
+
+	rows, err := r.DB.QueryContext(ctx, query, model.StatusCancelled)
+	if err != nil {
+		return promotions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p model.Promotion
+		var validFrom, validTo sql.NullTime
+		err := rows.Scan(
+			&p.ID,
+			&p.Code,
+			&p.Description,
+			&p.DiscountType,
+			&p.Amount,
+			&validFrom,
+			&validTo,
+			&p.RoomID,
+			&p.MaxUses,
+			&p.MaxUsesPerGuest,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Room.RoomName,
+			&p.Uses,
+		)
+		if err != nil {
+			return promotions, err
+		}
+		p.ValidFrom = validFrom.Time
+		p.ValidTo = validTo.Time
+		p.Room.ID = p.RoomID
+		promotions = append(promotions, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return promotions, err
+	}
+
+	return promotions, nil
+}
+
+// InsertPromotion adds a promotion, failing with repository.ErrPromoCodeExists if its code is taken
+func (r *postgresDBRepo) InsertPromotion(p model.Promotion) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	stmt := `insert into promotions (code, description, discount_type, amount, valid_from, valid_to, room_id,
+		max_uses, max_uses_per_guest, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		on conflict (code) do nothing
+		returning id`
+
+	err := r.DB.QueryRowContext(ctx, stmt,
+		p.Code,
+		p.Description,
+		p.DiscountType,
+		p.Amount,
+		sql.NullTime{Time: p.ValidFrom, Valid: !p.ValidFrom.IsZero()},
+		sql.NullTime{Time: p.ValidTo, Valid: !p.ValidTo.IsZero()},
+		sql.NullInt64{Int64: int64(p.RoomID), Valid: p.RoomID > 0},
+		p.MaxUses,
+		p.MaxUsesPerGuest,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrPromoCodeExists
+	} else if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// DeletePromotion deletes a promotion, the reservations that used it keep their discount
+func (r *postgresDBRepo) DeletePromotion(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, `delete from promotions where id = $1`, id)
+	return err
+}
+
+// GetPromotionByCode returns the promotion with code
+func (r *postgresDBRepo) GetPromotionByCode(code string) (model.Promotion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p model.Promotion
+	var validFrom, validTo sql.NullTime
+
+	query := `
+		select id, code, description, discount_type, amount, valid_from, valid_to, coalesce(room_id, 0),
+		max_uses, max_uses_per_guest, created_at, updated_at
+		from promotions
+		where code = $1
+		`
+
+	err := r.DB.QueryRowContext(ctx, query, code).Scan(
+		&p.ID,
+		&p.Code,
+		&p.Description,
+		&p.DiscountType,
+		&p.Amount,
+		&validFrom,
+		&validTo,
+		&p.RoomID,
+		&p.MaxUses,
+		&p.MaxUsesPerGuest,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+	p.ValidFrom = validFrom.Time
+	p.ValidTo = validTo.Time
+
+	return p, nil
+}
+
+// CountPromotionUses returns how many live reservations used a promotion, in total and with email
+func (r *postgresDBRepo) CountPromotionUses(promotionID int, email string) (int, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return countPromotionUses(ctx, r.DB, promotionID, email)
+}
+
+func countPromotionUses(ctx context.Context, db queryRower, promotionID int, email string) (int, int, error) {
+	var uses, guestUses int
+
+	query := `
+		select count(id), count(id) filter (where lower(email) = $2)
+		from reservations
+		where promotion_id = $1 and status <> $3 and deleted_at is null
+		`
+
+	err := db.QueryRowContext(ctx, query, promotionID, guestEmail(email), model.StatusCancelled).Scan(&uses, &guestUses)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return uses, guestUses, nil
+}
+
+// AllTaxRules returns the taxes and fees charged on every stay
+func (r *postgresDBRepo) AllTaxRules() ([]model.TaxRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var taxRules []model.TaxRule
+
+	query := `select id, name, kind, amount, inclusive, created_at, updated_at from tax_rules order by id`
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return taxRules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t model.TaxRule
+		err := rows.Scan(
+			&t.ID,
+			&t.Name,
+			&t.Kind,
+			&t.Amount,
+			&t.Inclusive,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return taxRules, err
+		}
+		taxRules = append(taxRules, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return taxRules, err
+	}
+
+	return taxRules, nil
+}
+
+// InsertTaxRule adds a tax or fee
+func (r *postgresDBRepo) InsertTaxRule(t model.TaxRule) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	stmt := `insert into tax_rules (name, kind, amount, inclusive, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6)
+		returning id`
+
+	err := r.DB.QueryRowContext(ctx, stmt, t.Name, t.Kind, t.Amount, t.Inclusive, time.Now(), time.Now()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// DeleteTaxRule deletes a tax or fee, reservations already priced keep theirs
+func (r *postgresDBRepo) DeleteTaxRule(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, `delete from tax_rules where id = $1`, id)
+	return err
+}
+
+// AllExchangeRates returns the currencies guests can show prices in
+func (r *postgresDBRepo) AllExchangeRates() ([]model.ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rates []model.ExchangeRate
+
+	query := `select id, currency, rate, created_at, updated_at from exchange_rates order by currency`
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e model.ExchangeRate
+		err := rows.Scan(
+			&e.ID,
+			&e.Currency,
+			&e.Rate,
+			&e.CreatedAt,
+			&e.UpdatedAt,
+		)
+		if err != nil {
+			return rates, err
+		}
+		rates = append(rates, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rates, err
+	}
+
+	return rates, nil
+}
+
+// UpsertExchangeRate adds the rate of a currency, or updates it when the currency is already there
+func (r *postgresDBRepo) UpsertExchangeRate(e model.ExchangeRate) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	stmt := `insert into exchange_rates (currency, rate, created_at, updated_at)
+		values ($1, $2, $3, $4)
+		on conflict (currency) do update set rate = excluded.rate, updated_at = excluded.updated_at
+		returning id`
+
+	err := r.DB.QueryRowContext(ctx, stmt, e.Currency, e.Rate, time.Now(), time.Now()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// DeleteExchangeRate stops offering a currency
+func (r *postgresDBRepo) DeleteExchangeRate(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, `delete from exchange_rates where id = $1`, id)
+	return err
+}
+
+// GenerateHousekeepingTasks opens the cleaning of the rooms of the stays ending on or before date,
+// once per stay, so the days the job didn't run are caught up, and returns how many tasks were opened
+func (r *postgresDBRepo) GenerateHousekeepingTasks(date time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `insert into housekeeping_tasks (room_id, reservation_id, due_date, status, created_at, updated_at)
+		select r.room_id, r.id, r.end_date, $2, now(), now()
+		from reservations r
+		where r.end_date <= $1 and r.deleted_at is null and r.status not in ($3, $4)
+		and not exists (select 1 from housekeeping_tasks t where t.reservation_id = r.id)
+		on conflict (reservation_id) do nothing`
+
+	result, err := r.DB.ExecContext(ctx, stmt, date, model.RoomDirty, model.StatusCancelled, model.StatusNoShow)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// InsertHousekeepingTask opens the cleaning of a room, unless its stay already has one
+func (r *postgresDBRepo) InsertHousekeepingTask(t model.HousekeepingTask) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `insert into housekeeping_tasks (room_id, reservation_id, due_date, status, user_id, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict (reservation_id) do nothing`
+
+	_, err := r.DB.ExecContext(ctx, stmt,
+		t.RoomID,
+		sql.NullInt64{Int64: int64(t.ReservationID), Valid: t.ReservationID > 0},
+		t.DueDate,
+		t.Status,
+		sql.NullInt64{Int64: int64(t.UserID), Valid: t.UserID > 0},
+		time.Now(),
+		time.Now(),
+	)
+	return err
+}
+
+// HousekeepingTasks returns the cleaning due on date and the cleaning from before it not yet inspected
+func (r *postgresDBRepo) HousekeepingTasks(date time.Time) ([]model.HousekeepingTask, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tasks []model.HousekeepingTask
+
+	query := `select t.id, t.room_id, coalesce(t.reservation_id, 0), t.due_date, t.status, coalesce(t.user_id, 0),
+		t.created_at, t.updated_at, rm.room_name, coalesce(r.first_name, ''), coalesce(r.last_name, '')
+		from housekeeping_tasks t
+		left join rooms rm on (rm.id = t.room_id)
+		left join reservations r on (r.id = t.reservation_id)
+		where t.due_date = $1 or (t.due_date < $1 and t.status <> $2)
+		order by t.due_date, rm.room_name, t.id`
+
+	rows, err := r.DB.QueryContext(ctx, query, date, model.RoomInspected)
+	if err != nil {
+		return tasks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t model.HousekeepingTask
+		err := rows.Scan(
+			&t.ID,
+			&t.RoomID,
+			&t.ReservationID,
+			&t.DueDate,
+			&t.Status,
+			&t.UserID,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+			&t.Room.RoomName,
+			&t.Reservation.FirstName,
+			&t.Reservation.LastName,
+		)
+		if err != nil {
+			return tasks, err
+		}
+		t.Room.ID = t.RoomID
+		t.Reservation.ID = t.ReservationID
+		tasks = append(tasks, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tasks, err
+	}
+
+	return tasks, nil
+}
+
+// RoomHousekeepingStatuses returns the status of the latest cleaning of each room that has one
+func (r *postgresDBRepo) RoomHousekeepingStatuses() (map[int]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	statuses := make(map[int]string)
+
+	query := `select distinct on (room_id) room_id, status
+		from housekeeping_tasks
+		order by room_id, due_date desc, id desc`
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return statuses, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roomID int
+		var status string
+		err := rows.Scan(&roomID, &status)
+		if err != nil {
+			return statuses, err
+		}
+		statuses[roomID] = status
+	}
+
+	if err = rows.Err(); err != nil {
+		return statuses, err
+	}
+
+	return statuses, nil
+}
+
+// SetRoomHousekeepingStatus records that staff cleaned or inspected a room, moving all its open
+// cleaning along, or that they found it dirty, opening a cleaning due today unless one is open
+func (r *postgresDBRepo) SetRoomHousekeepingStatus(roomID int, status string, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	user := sql.NullInt64{Int64: int64(userID), Valid: userID > 0}
+
+	if status == model.RoomDirty {
+		stmt := `insert into housekeeping_tasks (room_id, due_date, status, user_id, created_at, updated_at)
+			select $1, $2, $3, $4, now(), now()
+			where not exists (select 1 from housekeeping_tasks where room_id = $1 and status = $3)`
+
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		_, err := r.DB.ExecContext(ctx, stmt, roomID, today, model.RoomDirty, user)
+		return err
+	}
+
+	stmt := `update housekeeping_tasks set status = $1, user_id = $2, updated_at = now()
+		where room_id = $3 and status not in ($1, $4)`
+
+	_, err := r.DB.ExecContext(ctx, stmt, status, user, roomID, model.RoomInspected)
+	return err
+}
+
+// InsertReservationMessage adds a note or an email to the thread of a reservation
+func (r *postgresDBRepo) InsertReservationMessage(msg model.ReservationMessage) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	stmt := `insert into reservation_messages (reservation_id, kind, user_id, recipient, subject, body, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	err := r.DB.QueryRowContext(ctx, stmt,
+		msg.ReservationID,
+		msg.Kind,
+		sql.NullInt64{Int64: int64(msg.UserID), Valid: msg.UserID > 0},
+		msg.To,
+		msg.Subject,
+		msg.Body,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetMessagesForReservation returns the thread of a reservation, oldest first
+func (r *postgresDBRepo) GetMessagesForReservation(reservationID int) ([]model.ReservationMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var messages []model.ReservationMessage
+
+	query := `
+		select m.id, m.reservation_id, m.kind, coalesce(m.user_id, 0), coalesce(u.first_name || ' ' || u.last_name, ''),
+		m.recipient, m.subject, m.body, m.created_at, m.updated_at
+		from reservation_messages m
+		left join users u on (m.user_id = u.id)
+		where m.reservation_id = $1
+		order by m.created_at asc, m.id asc
+		`
+
+	rows, err := r.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return messages, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m model.ReservationMessage
+		err := rows.Scan(
+			&m.ID,
+			&m.ReservationID,
+			&m.Kind,
+			&m.UserID,
+			&m.UserName,
+			&m.To,
+			&m.Subject,
+			&m.Body,
+			&m.CreatedAt,
+			&m.UpdatedAt,
+		)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return messages, err
+	}
+
+	return messages, nil
+}
@@ -1,11 +1,13 @@
 package dbrepo
 
 import (
+	"database/sql"
 	"errors"
 	"log"
 	"time"
 
 	"github.com.br/Leodf/bookings/internal/model"
+	"github.com.br/Leodf/bookings/internal/repository"
 )
 
 // InsertReservation inserts a reservation into the database
@@ -17,6 +19,22 @@ func (r *testDBRepo) InsertReservation(res model.Reservation) (int, error) {
 	return 1, nil
 }
 
+// InsertReservationWithRestriction inserts a reservation and its room restriction
+func (r *testDBRepo) InsertReservationWithRestriction(res model.Reservation, holdID int) (int, error) {
+	// room 2 is already taken for any dates
+	if res.RoomID == 2 {
+		return 0, repository.ErrRoomUnavailable
+	}
+	if res.RoomID > 2 {
+		return 0, errors.New("some error")
+	}
+	// the ONCE promotion was used up by another booking since it was checked
+	if res.PromoCode == "ONCE" {
+		return 0, repository.ErrPromotionUsedUp
+	}
+	return 1, nil
+}
+
 // InsertRoomRestriction inserts a room restriction into the database
 func (r *testDBRepo) InsertRoomRestriction(rr model.RoomRestrictions) error {
 	if rr.RoomID == 1000 {
@@ -55,7 +73,7 @@ func (r *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roo
 }
 
 // SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
-func (r *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]model.Room, error) {
+func (r *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time, partySize int) ([]model.Room, error) {
 	var rooms []model.Room
 
 	// if the start date is after 2049-12-31, then return empty slice,
@@ -80,10 +98,16 @@ func (r *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]mode
 		return rooms, nil
 	}
 
+	// no room holds more than 4 people
+	if partySize > 4 {
+		return rooms, nil
+	}
+
 	// otherwise, put an entry into the slice, indicating that some room is
 	// available for search dates
 	room := model.Room{
-		ID: 1,
+		ID:           1,
+		MaxOccupancy: 4,
 	}
 	rooms = append(rooms, room)
 
@@ -97,6 +121,9 @@ func (r *testDBRepo) GetRoomByID(id int) (model.Room, error) {
 	if id > 2 {
 		return room, errors.New("some error")
 	}
+	room.ID = id
+	room.MaxOccupancy = 2
+	room.NightlyRate = 15000
 
 	return room, nil
 
@@ -116,21 +143,70 @@ func (r *testDBRepo) Authenticate(email, testPassword string) (int, string, erro
 	return 1, "", nil
 }
 
-func (r *testDBRepo) AllReservations() ([]model.Reservation, error) {
+func (r *testDBRepo) AllReservations(f model.ReservationFilter) ([]model.Reservation, error) {
 	var reservations []model.Reservation
 
 	return reservations, nil
 }
 
-func (r *testDBRepo) AllNewReservations() ([]model.Reservation, error) {
+func (r *testDBRepo) AllNewReservations(f model.ReservationFilter) ([]model.Reservation, error) {
 	var reservations []model.Reservation
 
 	return reservations, nil
 }
 
+func (r *testDBRepo) EachReservation(f model.ReservationFilter, fn func(model.Reservation) error) error {
+	reservations := []model.Reservation{
+		{
+			ID: 1, FirstName: "John", LastName: "Smith", Email: "john@smith.com",
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+			RoomID: 1, Room: model.Room{ID: 1, RoomName: "General's Quarters", NightlyRate: 15000},
+			Status: model.StatusConfirmed, Source: model.SourceWeb, Adults: 2,
+			Taxes: []model.TaxLine{{Name: "City tax", Amount: 1000}},
+		},
+		{
+			ID: 2, FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com",
+			StartDate: time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 2, 2, 0, 0, 0, 0, time.UTC),
+			RoomID: 2, Room: model.Room{ID: 2, RoomName: "Major's Suite", NightlyRate: 20000},
+			Status: model.StatusCancelled, Source: model.SourcePhone, Adults: 1, CancellationPenalty: 10000,
+		},
+	}
+
+	for _, res := range reservations {
+		if f.Status != "" && res.Status != f.Status {
+			continue
+		}
+		if err := fn(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *testDBRepo) ImportRestrictions(restrictions []model.RoomRestrictions) error {
+	return nil
+}
+
 func (r *testDBRepo) GetReservationByID(id int) (model.Reservation, error) {
 
 	var res model.Reservation
+	if id > 2 {
+		return res, errors.New("some error")
+	}
+	res.ID = id
+	res.Status = model.StatusPending
+	// reservation 2 has been paid for already
+	if id == 2 {
+		res.Status = model.StatusConfirmed
+	}
+	// reservation 1 belongs to guest 1 and was booked on the flexible rate plan
+	if id == 1 {
+		res.FirstName = "John"
+		res.Email = "john@smith.com"
+		res.GuestID = 1
+		res.RatePlanID = 1
+		res.RatePlan = model.RatePlan{ID: 1, Name: "Flexible", FreeCancellationDays: 7, PenaltyPercent: 50}
+	}
 
 	return res, nil
 }
@@ -140,8 +216,18 @@ func (r *testDBRepo) UpdateReservation(rm model.Reservation) error {
 	return nil
 }
 
-func (r *testDBRepo) DeleteReservation(id int) error {
+func (r *testDBRepo) UpdateReservationDatesAndRoom(res model.Reservation) error {
+	// room 2 is already taken for any dates
+	if res.RoomID == 2 {
+		return repository.ErrRoomUnavailable
+	}
+	return nil
+}
 
+func (r *testDBRepo) DeleteReservation(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
 	return nil
 }
 
@@ -151,7 +237,10 @@ func (r *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
 }
 
 func (r *testDBRepo) AllRooms() ([]model.Room, error) {
-	var rooms []model.Room
+	rooms := []model.Room{
+		{ID: 1, RoomName: "General's Quarters", MaxOccupancy: 2},
+		{ID: 2, RoomName: "Major's Suite", MaxOccupancy: 2},
+	}
 
 	return rooms, nil
 }
@@ -162,3 +251,418 @@ func (r *testDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Ti
 
 	return restrictions, nil
 }
+
+func (r *testDBRepo) UpdateReservationStatus(id int, status string, userID int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	if !model.CanTransition(model.StatusPending, status) {
+		return model.ErrInvalidTransition
+	}
+	return nil
+}
+
+func (r *testDBRepo) CancelReservation(id, userID int, penalty, refund int64, payments []model.Payment) error {
+	return r.UpdateReservationStatus(id, model.StatusCancelled, userID)
+}
+
+func (r *testDBRepo) GetStatusHistoryForReservation(id int) ([]model.ReservationStatusHistory, error) {
+	var history []model.ReservationStatusHistory
+
+	return history, nil
+}
+
+func (r *testDBRepo) AllDeletedReservations() ([]model.Reservation, error) {
+	var reservations []model.Reservation
+
+	return reservations, nil
+}
+
+func (r *testDBRepo) RestoreReservation(id int) error {
+	// room 2 has been taken by another reservation while in the trash
+	if id == 2 {
+		return repository.ErrRoomUnavailable
+	}
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (r *testDBRepo) PurgeReservation(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (r *testDBRepo) InsertBlockForRoom(roomID int, startDate time.Time) (int, error) {
+	// room 2 is already taken for any dates
+	if roomID == 2 {
+		return 0, repository.ErrRoomUnavailable
+	}
+	return 1, nil
+}
+
+func (r *testDBRepo) DeleteBlockByID(id int) error {
+	return nil
+}
+
+func (r *testDBRepo) InsertAuditEntry(e model.AuditEntry) error {
+	return nil
+}
+
+func (r *testDBRepo) SearchAuditLog(f model.AuditFilter) ([]model.AuditEntry, error) {
+	var entries []model.AuditEntry
+
+	return entries, nil
+}
+
+func (r *testDBRepo) GetGuestByEmail(email string) (model.Guest, error) {
+	switch email {
+	case "blocked@here.com":
+		return model.Guest{ID: 2, Email: email, Blocked: true}, nil
+	case "vip@here.com":
+		return model.Guest{ID: 1, Email: email, VIP: true}, nil
+	case "error@here.com":
+		return model.Guest{}, errors.New("some error")
+	}
+	return model.Guest{}, sql.ErrNoRows
+}
+
+func (r *testDBRepo) GetGuestByID(id int) (model.Guest, error) {
+	var g model.Guest
+	if id > 2 {
+		return g, errors.New("some error")
+	}
+	g.ID = id
+
+	return g, nil
+}
+
+func (r *testDBRepo) AllGuests(search string) ([]model.Guest, error) {
+	var guests []model.Guest
+
+	return guests, nil
+}
+
+func (r *testDBRepo) UpdateGuest(g model.Guest) error {
+	return nil
+}
+
+func (r *testDBRepo) GetReservationsForGuest(guestID int) ([]model.Reservation, error) {
+	var reservations []model.Reservation
+
+	return reservations, nil
+}
+
+func (r *testDBRepo) RegisterGuest(g model.Guest, token string, expiresAt time.Time) error {
+	if g.Email == "exists@here.com" {
+		return repository.ErrGuestExists
+	}
+	return nil
+}
+
+func (r *testDBRepo) GetGuestByConfirmToken(token string) (model.Guest, error) {
+	if token != "valid" {
+		return model.Guest{}, sql.ErrNoRows
+	}
+	return model.Guest{ID: 1, FirstName: "John", LastName: "Smith", Email: "john@smith.com"}, nil
+}
+
+func (r *testDBRepo) ConfirmGuest(token, password string) (int, error) {
+	if token != "valid" {
+		return 0, sql.ErrNoRows
+	}
+	return 1, nil
+}
+
+func (r *testDBRepo) AuthenticateGuest(email, testPassword string) (int, error) {
+	if email == "guest@here.com" && testPassword == "password" {
+		return 1, nil
+	}
+	return 0, errors.New("incorrect password")
+}
+
+func (r *testDBRepo) AllStayRules() ([]model.StayRule, error) {
+	// a three night minimum and no Saturday arrivals during 2045
+	rules := []model.StayRule{
+		{
+			ID:              1,
+			Name:            "2045",
+			SeasonStart:     time.Date(2045, 1, 1, 0, 0, 0, 0, time.UTC),
+			SeasonEnd:       time.Date(2045, 12, 31, 0, 0, 0, 0, time.UTC),
+			MinNights:       3,
+			ClosedToArrival: model.NewWeekdays(time.Saturday),
+		},
+	}
+
+	return rules, nil
+}
+
+func (r *testDBRepo) InsertStayRule(rule model.StayRule) (int, error) {
+	return 1, nil
+}
+
+func (r *testDBRepo) DeleteStayRule(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (r *testDBRepo) InsertWaitlistEntry(e model.WaitlistEntry) (int, error) {
+	if e.RoomID > 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (r *testDBRepo) PendingWaitlistEntries(roomID int) ([]model.WaitlistEntry, error) {
+	// one guest waiting for a stay the test availability reports free, one for a stay it doesn't
+	entries := []model.WaitlistEntry{
+		{ID: 1, RoomID: roomID, Email: "first@here.com", StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2040, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{ID: 2, RoomID: roomID, Email: "second@here.com", StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC)},
+	}
+
+	return entries, nil
+}
+
+func (r *testDBRepo) OfferWaitlistEntry(id int, token string, expiresAt time.Time) error {
+	return nil
+}
+
+func (r *testDBRepo) UseWaitlistEntry(id int) error {
+	return nil
+}
+
+func (r *testDBRepo) GetWaitlistEntryByToken(token string) (model.WaitlistEntry, error) {
+	entry := model.WaitlistEntry{
+		ID:        1,
+		RoomID:    1,
+		Email:     "first@here.com",
+		StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2040, 1, 3, 0, 0, 0, 0, time.UTC),
+		Token:     token,
+		Room:      model.Room{ID: 1, RoomName: "General's Quarters"},
+	}
+
+	switch token {
+	case "valid":
+		entry.ExpiresAt = time.Now().Add(time.Hour)
+	case "expired":
+		entry.ExpiresAt = time.Now().Add(-time.Hour)
+	case "used":
+		entry.ExpiresAt = time.Now().Add(time.Hour)
+		entry.UsedAt = time.Now().Add(-time.Minute)
+	case "taken":
+		// the test availability has no rooms after 2049
+		entry.StartDate = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+		entry.EndDate = time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC)
+		entry.ExpiresAt = time.Now().Add(time.Hour)
+	default:
+		return model.WaitlistEntry{}, sql.ErrNoRows
+	}
+
+	return entry, nil
+}
+
+func (r *testDBRepo) InsertPayment(p model.Payment) (int, error) {
+	if p.ReservationID > 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (r *testDBRepo) GetPaymentByID(id int) (model.Payment, error) {
+	// payment 1 is the first authorization of the fake provider, payment 2 has been captured
+	switch id {
+	case 1:
+		return model.Payment{ID: 1, ReservationID: 1, Provider: "fake", Reference: "fake_1", Amount: 15000, Currency: "USD", Status: "authorized"}, nil
+	case 2:
+		return model.Payment{ID: 2, ReservationID: 1, Provider: "fake", Reference: "fake_2", Amount: 15000, Currency: "USD", Status: "captured"}, nil
+	}
+	return model.Payment{}, sql.ErrNoRows
+}
+
+func (r *testDBRepo) GetPaymentsForReservation(reservationID int) ([]model.Payment, error) {
+	var payments []model.Payment
+
+	return payments, nil
+}
+
+func (r *testDBRepo) UpdatePaymentStatus(provider, reference, status string) error {
+	if reference == "unknown" {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *testDBRepo) InsertHold(roomID int, start, end time.Time, ttl time.Duration) (int, time.Time, error) {
+	// room 2 is already taken for any dates
+	if roomID == 2 {
+		return 0, time.Time{}, repository.ErrRoomUnavailable
+	}
+	return 1, time.Now().Add(ttl), nil
+}
+
+func (r *testDBRepo) ReleaseHold(id int) error {
+	return nil
+}
+
+func (r *testDBRepo) DeleteExpiredHolds() (int64, error) {
+	return 0, nil
+}
+
+func (r *testDBRepo) CancelUnpaidReservations(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *testDBRepo) AllRatePlans() ([]model.RatePlan, error) {
+	plans := []model.RatePlan{
+		{ID: 1, Name: "Flexible", FreeCancellationDays: 7, PenaltyPercent: 50},
+		{ID: 2, Name: "Non-refundable", PenaltyPercent: 100},
+	}
+
+	return plans, nil
+}
+
+func (r *testDBRepo) GetRatePlanByID(id int) (model.RatePlan, error) {
+	plans, _ := r.AllRatePlans()
+	for _, p := range plans {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return model.RatePlan{}, sql.ErrNoRows
+}
+
+func (r *testDBRepo) AllPromotions() ([]model.Promotion, error) {
+	var promotions []model.Promotion
+
+	return promotions, nil
+}
+
+func (r *testDBRepo) InsertPromotion(p model.Promotion) (int, error) {
+	if p.Code == "TAKEN" {
+		return 0, repository.ErrPromoCodeExists
+	}
+	return 1, nil
+}
+
+func (r *testDBRepo) DeletePromotion(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (r *testDBRepo) GetPromotionByCode(code string) (model.Promotion, error) {
+	switch code {
+	case "SAVE10":
+		return model.Promotion{ID: 1, Code: code, DiscountType: model.DiscountPercent, Amount: 10}, nil
+	case "EXPIRED":
+		return model.Promotion{ID: 2, Code: code, DiscountType: model.DiscountPercent, Amount: 10,
+			ValidTo: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}, nil
+	case "ONCE":
+		return model.Promotion{ID: 3, Code: code, DiscountType: model.DiscountFixed, Amount: 1000, MaxUsesPerGuest: 1}, nil
+	}
+	return model.Promotion{}, sql.ErrNoRows
+}
+
+func (r *testDBRepo) CountPromotionUses(promotionID int, email string) (int, int, error) {
+	// john@smith.com already used every code
+	if email == "john@smith.com" {
+		return 1, 1, nil
+	}
+	return 0, 0, nil
+}
+
+func (r *testDBRepo) AllTaxRules() ([]model.TaxRule, error) {
+	taxRules := []model.TaxRule{
+		{ID: 1, Name: "VAT", Kind: model.TaxPercent, Amount: 1000, Inclusive: true},
+		{ID: 2, Name: "City tax", Kind: model.TaxPerPersonNight, Amount: 250},
+	}
+
+	return taxRules, nil
+}
+
+func (r *testDBRepo) InsertTaxRule(t model.TaxRule) (int, error) {
+	return 1, nil
+}
+
+func (r *testDBRepo) DeleteTaxRule(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (r *testDBRepo) AllExchangeRates() ([]model.ExchangeRate, error) {
+	rates := []model.ExchangeRate{
+		{ID: 1, Currency: "EUR", Rate: 0.92},
+		{ID: 2, Currency: "GBP", Rate: 0.79},
+	}
+
+	return rates, nil
+}
+
+func (r *testDBRepo) UpsertExchangeRate(e model.ExchangeRate) (int, error) {
+	return 1, nil
+}
+
+func (r *testDBRepo) DeleteExchangeRate(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (r *testDBRepo) GenerateHousekeepingTasks(date time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *testDBRepo) InsertHousekeepingTask(t model.HousekeepingTask) error {
+	return nil
+}
+
+func (r *testDBRepo) HousekeepingTasks(date time.Time) ([]model.HousekeepingTask, error) {
+	return []model.HousekeepingTask{
+		{
+			ID:            1,
+			RoomID:        1,
+			Room:          model.Room{ID: 1, RoomName: "General's Quarters"},
+			ReservationID: 1,
+			Reservation:   model.Reservation{ID: 1, FirstName: "John", LastName: "Smith"},
+			DueDate:       date,
+			Status:        model.RoomDirty,
+		},
+	}, nil
+}
+
+func (r *testDBRepo) RoomHousekeepingStatuses() (map[int]string, error) {
+	return map[int]string{1: model.RoomDirty}, nil
+}
+
+func (r *testDBRepo) SetRoomHousekeepingStatus(roomID int, status string, userID int) error {
+	if roomID > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (r *testDBRepo) InsertReservationMessage(msg model.ReservationMessage) (int, error) {
+	if msg.ReservationID == 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (r *testDBRepo) GetMessagesForReservation(reservationID int) ([]model.ReservationMessage, error) {
+	return []model.ReservationMessage{
+		{ID: 1, ReservationID: reservationID, Kind: model.MessageNote, UserName: "Admin User", Body: "Late arrival, around 11pm",
+			CreatedAt: time.Date(2050, 1, 1, 9, 0, 0, 0, time.UTC)},
+		{ID: 2, ReservationID: reservationID, Kind: model.MessageEmail, UserName: "Admin User", To: "john@smith.com",
+			Subject: "Your arrival", Body: "We will keep the desk open for you.", CreatedAt: time.Date(2050, 1, 1, 9, 5, 0, 0, time.UTC)},
+	}, nil
+}
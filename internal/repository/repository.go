@@ -1,26 +1,98 @@
 package repository
 
 import (
+	"errors"
 	"time"
 
 	"github.com.br/Leodf/bookings/internal/model"
 )
 
+// ErrRoomUnavailable is returned when the room is already taken for the requested dates
+var ErrRoomUnavailable = errors.New("room is not available for the requested dates")
+
+// ErrGuestExists is returned when registering an email that already has a guest account
+var ErrGuestExists = errors.New("a guest account already exists for this email")
+
+// ErrPromoCodeExists is returned when adding a promotion with a code already in use
+var ErrPromoCodeExists = errors.New("a promotion already exists for this code")
+
+// ErrPromotionUsedUp is returned when booking with a promotion that has no uses left, in total or for the guest
+var ErrPromotionUsedUp = errors.New("the promotion has no uses left")
+
 type DatabaseRepo interface {
 	InsertReservation(res model.Reservation) (int, error)
+	InsertReservationWithRestriction(res model.Reservation, holdID int) (int, error)
 	InsertRoomRestriction(rr model.RoomRestrictions) error
 	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]model.Room, error)
+	SearchAvailabilityForAllRooms(start, end time.Time, partySize int) ([]model.Room, error)
 	GetRoomByID(id int) (model.Room, error)
 	GetUserByID(id int) (model.User, error)
 	UpdateUser(u model.User) error
 	Authenticate(email, testPassword string) (int, string, error)
-	AllReservations() ([]model.Reservation, error)
-	AllNewReservations() ([]model.Reservation, error)
+	AllReservations(f model.ReservationFilter) ([]model.Reservation, error)
+	AllNewReservations(f model.ReservationFilter) ([]model.Reservation, error)
+	EachReservation(f model.ReservationFilter, fn func(model.Reservation) error) error
+	ImportRestrictions(restrictions []model.RoomRestrictions) error
 	GetReservationByID(id int) (model.Reservation, error)
 	UpdateReservation(rm model.Reservation) error
+	UpdateReservationDatesAndRoom(res model.Reservation) error
 	DeleteReservation(id int) error
 	UpdateProcessedForReservation(id, processed int) error
 	AllRooms() ([]model.Room, error)
 	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]model.RoomRestrictions, error)
+	UpdateReservationStatus(id int, status string, userID int) error
+	CancelReservation(id, userID int, penalty, refund int64, payments []model.Payment) error
+	GetStatusHistoryForReservation(id int) ([]model.ReservationStatusHistory, error)
+	AllDeletedReservations() ([]model.Reservation, error)
+	RestoreReservation(id int) error
+	PurgeReservation(id int) error
+	InsertBlockForRoom(roomID int, startDate time.Time) (int, error)
+	DeleteBlockByID(id int) error
+	InsertAuditEntry(e model.AuditEntry) error
+	SearchAuditLog(f model.AuditFilter) ([]model.AuditEntry, error)
+	GetGuestByEmail(email string) (model.Guest, error)
+	GetGuestByID(id int) (model.Guest, error)
+	AllGuests(search string) ([]model.Guest, error)
+	UpdateGuest(g model.Guest) error
+	GetReservationsForGuest(guestID int) ([]model.Reservation, error)
+	RegisterGuest(g model.Guest, token string, expiresAt time.Time) error
+	GetGuestByConfirmToken(token string) (model.Guest, error)
+	ConfirmGuest(token, password string) (int, error)
+	AuthenticateGuest(email, testPassword string) (int, error)
+	AllStayRules() ([]model.StayRule, error)
+	InsertStayRule(rule model.StayRule) (int, error)
+	DeleteStayRule(id int) error
+	InsertWaitlistEntry(e model.WaitlistEntry) (int, error)
+	PendingWaitlistEntries(roomID int) ([]model.WaitlistEntry, error)
+	OfferWaitlistEntry(id int, token string, expiresAt time.Time) error
+	GetWaitlistEntryByToken(token string) (model.WaitlistEntry, error)
+	UseWaitlistEntry(id int) error
+	InsertPayment(p model.Payment) (int, error)
+	GetPaymentByID(id int) (model.Payment, error)
+	GetPaymentsForReservation(reservationID int) ([]model.Payment, error)
+	UpdatePaymentStatus(provider, reference, status string) error
+	InsertHold(roomID int, start, end time.Time, ttl time.Duration) (int, time.Time, error)
+	ReleaseHold(id int) error
+	DeleteExpiredHolds() (int64, error)
+	CancelUnpaidReservations(before time.Time) (int64, error)
+	AllRatePlans() ([]model.RatePlan, error)
+	GetRatePlanByID(id int) (model.RatePlan, error)
+	AllPromotions() ([]model.Promotion, error)
+	InsertPromotion(p model.Promotion) (int, error)
+	DeletePromotion(id int) error
+	GetPromotionByCode(code string) (model.Promotion, error)
+	CountPromotionUses(promotionID int, email string) (int, int, error)
+	AllTaxRules() ([]model.TaxRule, error)
+	InsertTaxRule(t model.TaxRule) (int, error)
+	DeleteTaxRule(id int) error
+	AllExchangeRates() ([]model.ExchangeRate, error)
+	UpsertExchangeRate(e model.ExchangeRate) (int, error)
+	DeleteExchangeRate(id int) error
+	GenerateHousekeepingTasks(date time.Time) (int64, error)
+	InsertHousekeepingTask(t model.HousekeepingTask) error
+	HousekeepingTasks(date time.Time) ([]model.HousekeepingTask, error)
+	RoomHousekeepingStatuses() (map[int]string, error)
+	SetRoomHousekeepingStatus(roomID int, status string, userID int) error
+	InsertReservationMessage(msg model.ReservationMessage) (int, error)
+	GetMessagesForReservation(reservationID int) ([]model.ReservationMessage, error)
 }
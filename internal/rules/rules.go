@@ -0,0 +1,79 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+// ErrInvalidDates is returned when the departure isn't after the arrival
+var ErrInvalidDates = errors.New("departure must be after arrival")
+
+// ValidateDates checks that a stay is at least one night long
+func ValidateDates(start, end time.Time) error {
+	if !end.After(start) {
+		return ErrInvalidDates
+	}
+	return nil
+}
+
+// Applies returns true if rule covers a stay in roomID arriving on start
+func Applies(rule model.StayRule, roomID int, start time.Time) bool {
+	if rule.RoomID != 0 && rule.RoomID != roomID {
+		return false
+	}
+	if !rule.SeasonStart.IsZero() && start.Before(rule.SeasonStart) {
+		return false
+	}
+	if !rule.SeasonEnd.IsZero() && start.After(rule.SeasonEnd) {
+		return false
+	}
+	return true
+}
+
+// Check returns the reasons a stay in roomID from start to end, booked on today, breaks any of rules.
+// An empty result means the stay is allowed.
+func Check(rules []model.StayRule, roomID int, start, end, today time.Time) []string {
+	var reasons []string
+
+	if err := ValidateDates(start, end); err != nil {
+		return []string{err.Error()}
+	}
+
+	nights := int(end.Sub(start).Hours() / 24)
+	advance := int(start.Sub(today.Truncate(24*time.Hour)).Hours() / 24)
+
+	for _, rule := range rules {
+		if !Applies(rule, roomID, start) {
+			continue
+		}
+
+		var suffix string
+		if rule.Name != "" {
+			suffix = fmt.Sprintf(" (%s)", rule.Name)
+		}
+
+		if rule.MinNights > 0 && nights < rule.MinNights {
+			reasons = append(reasons, fmt.Sprintf("the minimum stay is %d nights%s", rule.MinNights, suffix))
+		}
+		if rule.MaxNights > 0 && nights > rule.MaxNights {
+			reasons = append(reasons, fmt.Sprintf("the maximum stay is %d nights%s", rule.MaxNights, suffix))
+		}
+		if rule.ClosedToArrival.Has(start.Weekday()) {
+			reasons = append(reasons, fmt.Sprintf("arrivals are not possible on %s%s", start.Weekday(), suffix))
+		}
+		if rule.ClosedToDeparture.Has(end.Weekday()) {
+			reasons = append(reasons, fmt.Sprintf("departures are not possible on %s%s", end.Weekday(), suffix))
+		}
+		if rule.MinAdvanceDays > 0 && advance < rule.MinAdvanceDays {
+			reasons = append(reasons, fmt.Sprintf("bookings must be made at least %d days before arrival%s", rule.MinAdvanceDays, suffix))
+		}
+		if rule.MaxAdvanceDays > 0 && advance > rule.MaxAdvanceDays {
+			reasons = append(reasons, fmt.Sprintf("bookings open %d days before arrival%s", rule.MaxAdvanceDays, suffix))
+		}
+	}
+
+	return reasons
+}
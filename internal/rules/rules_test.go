@@ -0,0 +1,64 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestCheck(t *testing.T) {
+	today := date("2050-01-01")
+	rules := []model.StayRule{
+		{Name: "High season", RoomID: 0, SeasonStart: date("2050-07-01"), SeasonEnd: date("2050-08-31"), MinNights: 3},
+		{RoomID: 2, MaxNights: 7},
+		{RoomID: 0, ClosedToArrival: model.NewWeekdays(time.Sunday), ClosedToDeparture: model.NewWeekdays(time.Saturday)},
+		{RoomID: 0, MinAdvanceDays: 1, MaxAdvanceDays: 365},
+	}
+
+	var tests = []struct {
+		name     string
+		roomID   int
+		start    string
+		end      string
+		expected int
+	}{
+		{"allowed stay", 1, "2050-03-01", "2050-03-03", 0},
+		{"end before start", 1, "2050-03-03", "2050-03-01", 1},
+		{"zero nights", 1, "2050-03-01", "2050-03-01", 1},
+		{"too short in season", 1, "2050-07-05", "2050-07-06", 1},
+		{"long enough in season", 1, "2050-07-05", "2050-07-08", 0},
+		{"too long for room 2", 2, "2050-03-01", "2050-03-10", 1},
+		{"long stay in room 1", 1, "2050-03-01", "2050-03-10", 0},
+		{"closed to arrival", 1, "2050-03-06", "2050-03-08", 1},
+		{"closed to departure", 1, "2050-03-03", "2050-03-05", 1},
+		{"same day booking", 1, "2050-01-01", "2050-01-04", 1},
+		{"too far ahead", 1, "2051-03-01", "2051-03-03", 1},
+	}
+
+	for _, e := range tests {
+		reasons := Check(rules, e.roomID, date(e.start), date(e.end), today)
+		if len(reasons) != e.expected {
+			t.Errorf("%s: expected %d reasons, got %v", e.name, e.expected, reasons)
+		}
+	}
+}
+
+func TestApplies(t *testing.T) {
+	rule := model.StayRule{RoomID: 1, SeasonStart: date("2050-07-01"), SeasonEnd: date("2050-08-31")}
+
+	if !Applies(rule, 1, date("2050-07-01")) {
+		t.Error("rule should apply on the first day of the season")
+	}
+	if Applies(rule, 2, date("2050-07-15")) {
+		t.Error("rule should not apply to another room")
+	}
+	if Applies(rule, 1, date("2050-09-01")) {
+		t.Error("rule should not apply after the season")
+	}
+}
@@ -0,0 +1,42 @@
+package tax
+
+import (
+	"fmt"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+// Apply returns the taxes and fees rules charge on res. Percentages are of the price after the discount,
+// and inclusive ones are the part of that price that is tax.
+func Apply(rules []model.TaxRule, res model.Reservation) []model.TaxLine {
+	var lines []model.TaxLine
+
+	nights := int64(res.Nights())
+	price := res.Price()
+
+	for _, rule := range rules {
+		line := model.TaxLine{Name: rule.Name, Inclusive: rule.Inclusive}
+
+		switch rule.Kind {
+		case model.TaxPercent:
+			line.Name = fmt.Sprintf("%s %s", rule.Name, rule.Rate())
+			if rule.Inclusive {
+				line.Amount = price * rule.Amount / (10000 + rule.Amount)
+			} else {
+				line.Amount = price * rule.Amount / 10000
+			}
+		case model.TaxPerNight:
+			line.Amount = nights * rule.Amount
+		case model.TaxPerPersonNight:
+			line.Amount = nights * int64(max(res.PartySize(), 1)) * rule.Amount
+		default:
+			continue
+		}
+
+		if line.Amount > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,46 @@
+package tax
+
+import (
+	"testing"
+	"time"
+
+	"github.com.br/Leodf/bookings/internal/model"
+)
+
+func TestApply(t *testing.T) {
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := model.Reservation{
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 3),
+		Adults:    2,
+		Children:  1,
+		Room:      model.Room{NightlyRate: 12000},
+		Discount:  6000,
+	}
+
+	var tests = []struct {
+		name      string
+		rule      model.TaxRule
+		expected  int64
+		inclusive bool
+	}{
+		{"vat on top", model.TaxRule{Name: "VAT", Kind: model.TaxPercent, Amount: 1000}, 3000, false},
+		{"vat included", model.TaxRule{Name: "VAT", Kind: model.TaxPercent, Amount: 2000, Inclusive: true}, 5000, true},
+		{"cleaning fee", model.TaxRule{Name: "Cleaning", Kind: model.TaxPerNight, Amount: 500}, 1500, false},
+		{"city tax", model.TaxRule{Name: "City tax", Kind: model.TaxPerPersonNight, Amount: 250}, 2250, false},
+	}
+
+	for _, e := range tests {
+		lines := Apply([]model.TaxRule{e.rule}, res)
+		if len(lines) != 1 {
+			t.Fatalf("%s: expected one line, got %d", e.name, len(lines))
+		}
+		if lines[0].Amount != e.expected || lines[0].Inclusive != e.inclusive {
+			t.Errorf("%s: expected %d (inclusive %t), got %d (inclusive %t)", e.name, e.expected, e.inclusive, lines[0].Amount, lines[0].Inclusive)
+		}
+	}
+
+	if lines := Apply([]model.TaxRule{{Name: "Bogus", Kind: "bogus", Amount: 100}}, res); len(lines) != 0 {
+		t.Errorf("expected unknown kinds to be skipped, got %d lines", len(lines))
+	}
+}
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reservations
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'pending',
+ADD COLUMN confirmed_at TIMESTAMP,
+ADD COLUMN checked_in_at TIMESTAMP,
+ADD COLUMN checked_out_at TIMESTAMP,
+ADD COLUMN cancelled_at TIMESTAMP,
+ADD COLUMN no_show_at TIMESTAMP;
+
+UPDATE reservations SET status = 'confirmed', confirmed_at = updated_at WHERE processed = 1;
+
+CREATE INDEX IF NOT EXISTS reservations_status_idx ON reservations(status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS reservations_status_idx;
+
+ALTER TABLE reservations
+DROP COLUMN IF EXISTS status,
+DROP COLUMN IF EXISTS confirmed_at,
+DROP COLUMN IF EXISTS checked_in_at,
+DROP COLUMN IF EXISTS checked_out_at,
+DROP COLUMN IF EXISTS cancelled_at,
+DROP COLUMN IF EXISTS no_show_at;
+-- +goose StatementEnd
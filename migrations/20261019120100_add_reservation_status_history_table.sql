@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS reservation_status_history (
+    id SERIAL PRIMARY KEY,
+    reservation_id INTEGER NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    user_id INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE reservation_status_history
+ADD CONSTRAINT reservation_status_history_reservation_id_fk
+FOREIGN KEY (reservation_id) REFERENCES reservations(id)
+ON DELETE CASCADE
+ON UPDATE CASCADE;
+
+CREATE INDEX IF NOT EXISTS reservation_status_history_reservation_id_idx ON reservation_status_history(reservation_id);
+
+-- +goose Down
+DROP TABLE reservation_status_history;
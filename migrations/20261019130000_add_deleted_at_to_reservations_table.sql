@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reservations
+ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS reservations_deleted_at_idx ON reservations(deleted_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS reservations_deleted_at_idx;
+
+ALTER TABLE reservations
+DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
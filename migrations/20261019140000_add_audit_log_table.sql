@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS audit_log (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER,
+    action VARCHAR(50) NOT NULL,
+    entity VARCHAR(50) NOT NULL,
+    entity_id INTEGER NOT NULL DEFAULT 0,
+    changes JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log(entity, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log(user_id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log(created_at);
+
+-- +goose Down
+DROP TABLE audit_log;
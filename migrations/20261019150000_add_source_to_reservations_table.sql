@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reservations
+ADD COLUMN source VARCHAR(20) NOT NULL DEFAULT 'web';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE reservations
+DROP COLUMN IF EXISTS source;
+-- +goose StatementEnd
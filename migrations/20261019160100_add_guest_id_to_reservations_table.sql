@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reservations
+ADD COLUMN guest_id INTEGER REFERENCES guests(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+CREATE INDEX IF NOT EXISTS reservations_guest_id_idx ON reservations(guest_id);
+
+-- one guest per email, named after their latest reservation
+-- +goose StatementBegin
+INSERT INTO guests (first_name, last_name, email, phone, created_at, updated_at)
+SELECT DISTINCT ON (lower(trim(email))) coalesce(first_name, ''), coalesce(last_name, ''), lower(trim(email)), coalesce(phone, ''),
+    created_at, coalesce(updated_at, created_at)
+FROM reservations
+WHERE trim(email) <> ''
+ORDER BY lower(trim(email)), created_at DESC
+ON CONFLICT (email) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE reservations r
+SET guest_id = g.id
+FROM guests g
+WHERE g.email = lower(trim(r.email));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE reservations
+DROP COLUMN IF EXISTS guest_id;
+-- +goose StatementEnd
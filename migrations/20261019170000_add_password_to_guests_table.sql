@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE guests
+ADD COLUMN password VARCHAR(60) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE guests
+DROP COLUMN IF EXISTS password;
+-- +goose StatementEnd
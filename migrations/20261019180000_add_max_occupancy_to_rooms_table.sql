@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE rooms
+ADD COLUMN max_occupancy INTEGER NOT NULL DEFAULT 2;
+-- +goose StatementEnd
+
+UPDATE rooms SET max_occupancy = 4 WHERE room_name = 'Major''s Suite';
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE rooms
+DROP COLUMN IF EXISTS max_occupancy;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reservations
+ADD COLUMN adults INTEGER NOT NULL DEFAULT 1,
+ADD COLUMN children INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE reservations
+DROP COLUMN IF EXISTS adults,
+DROP COLUMN IF EXISTS children;
+-- +goose StatementEnd
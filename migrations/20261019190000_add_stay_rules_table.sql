@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS stay_rules (
+    id SERIAL PRIMARY KEY,
+    room_id INTEGER REFERENCES rooms(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    season_start DATE,
+    season_end DATE,
+    min_nights INTEGER NOT NULL DEFAULT 0,
+    max_nights INTEGER NOT NULL DEFAULT 0,
+    closed_to_arrival SMALLINT NOT NULL DEFAULT 0,
+    closed_to_departure SMALLINT NOT NULL DEFAULT 0,
+    min_advance_days INTEGER NOT NULL DEFAULT 0,
+    max_advance_days INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE stay_rules;
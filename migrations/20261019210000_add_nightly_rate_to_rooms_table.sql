@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE rooms
+ADD COLUMN nightly_rate INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+UPDATE rooms SET nightly_rate = 15000 WHERE room_name = 'General''s Quarters';
+UPDATE rooms SET nightly_rate = 22000 WHERE room_name = 'Major''s Suite';
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE rooms
+DROP COLUMN IF EXISTS nightly_rate;
+-- +goose StatementEnd
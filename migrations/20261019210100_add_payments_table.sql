@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS payments (
+    id SERIAL PRIMARY KEY,
+    reservation_id INTEGER NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    reference VARCHAR(255) NOT NULL,
+    amount BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE payments
+ADD CONSTRAINT payments_reservation_id_fk
+FOREIGN KEY (reservation_id) REFERENCES reservations(id)
+ON DELETE CASCADE
+ON UPDATE CASCADE;
+
+CREATE INDEX IF NOT EXISTS payments_reservation_id_idx ON payments(reservation_id);
+CREATE UNIQUE INDEX IF NOT EXISTS payments_provider_reference_idx ON payments(provider, reference);
+
+-- +goose Down
+DROP TABLE payments;
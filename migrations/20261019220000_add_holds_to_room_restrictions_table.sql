@@ -0,0 +1,20 @@
+-- +goose Up
+INSERT INTO restrictions (id, restriction_name, created_at, updated_at) VALUES (3, 'Hold', now(), now());
+
+-- +goose StatementBegin
+ALTER TABLE room_restrictions
+ADD COLUMN expires_at TIMESTAMP;
+-- +goose StatementEnd
+
+CREATE INDEX IF NOT EXISTS room_restrictions_expires_at_idx ON room_restrictions(expires_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS room_restrictions_expires_at_idx;
+
+-- +goose StatementBegin
+ALTER TABLE room_restrictions
+DROP COLUMN IF EXISTS expires_at;
+-- +goose StatementEnd
+
+DELETE FROM room_restrictions WHERE restriction_id = 3;
+DELETE FROM restrictions WHERE id = 3;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS rate_plans (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    free_cancellation_days INTEGER NOT NULL DEFAULT 0,
+    penalty_percent INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO rate_plans (name, free_cancellation_days, penalty_percent) VALUES ('Flexible', 7, 50);
+INSERT INTO rate_plans (name, free_cancellation_days, penalty_percent) VALUES ('Non-refundable', 0, 100);
+
+-- +goose Down
+DROP TABLE rate_plans;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reservations
+ADD COLUMN rate_plan_id INTEGER REFERENCES rate_plans(id) ON DELETE SET NULL,
+ADD COLUMN cancellation_penalty BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE reservations
+DROP COLUMN IF EXISTS cancellation_penalty,
+DROP COLUMN IF EXISTS rate_plan_id;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS promotions (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    discount_type VARCHAR(20) NOT NULL,
+    amount INTEGER NOT NULL,
+    valid_from DATE,
+    valid_to DATE,
+    room_id INTEGER REFERENCES rooms(id) ON DELETE CASCADE,
+    max_uses INTEGER NOT NULL DEFAULT 0,
+    max_uses_per_guest INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX promotions_code_idx ON promotions (code);
+
+-- +goose Down
+DROP TABLE promotions;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reservations
+ADD COLUMN promotion_id INTEGER REFERENCES promotions(id) ON DELETE SET NULL,
+ADD COLUMN discount BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+CREATE INDEX IF NOT EXISTS reservations_promotion_id_idx ON reservations(promotion_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS reservations_promotion_id_idx;
+
+-- +goose StatementBegin
+ALTER TABLE reservations
+DROP COLUMN IF EXISTS discount,
+DROP COLUMN IF EXISTS promotion_id;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS housekeeping_tasks (
+    id SERIAL PRIMARY KEY,
+    room_id INTEGER NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    reservation_id INTEGER REFERENCES reservations(id) ON DELETE SET NULL,
+    due_date DATE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'dirty',
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- a stay turns over its room once
+CREATE UNIQUE INDEX IF NOT EXISTS housekeeping_tasks_reservation_id_idx ON housekeeping_tasks(reservation_id);
+CREATE INDEX IF NOT EXISTS housekeeping_tasks_room_id_due_date_idx ON housekeeping_tasks(room_id, due_date);
+
+-- +goose Down
+DROP TABLE housekeeping_tasks;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE waitlist
+ADD COLUMN used_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE waitlist
+DROP COLUMN IF EXISTS used_at;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE guests
+ADD COLUMN confirm_token VARCHAR(64),
+ADD COLUMN confirm_expires_at TIMESTAMP;
+-- +goose StatementEnd
+
+CREATE UNIQUE INDEX guests_confirm_token_idx ON guests (confirm_token);
+
+-- +goose Down
+DROP INDEX IF EXISTS guests_confirm_token_idx;
+
+-- +goose StatementBegin
+ALTER TABLE guests
+DROP COLUMN IF EXISTS confirm_token,
+DROP COLUMN IF EXISTS confirm_expires_at;
+-- +goose StatementEnd
@@ -86,3 +86,55 @@ function Prompt() {
     custom: custom,
   };
 }
+
+// RoomAvailability loads which days a room can't be booked from the server, a month at a time,
+// and disables them in the given datepickers as the guest browses the calendar
+function RoomAvailability(roomID) {
+  const unavailable = new Set();
+  const loaded = new Set();
+  // keyed by element so reopening a modal replaces its old picker
+  const pickers = new Map();
+
+  let load = async function (date) {
+    const year = date.getFullYear();
+    const month = date.getMonth() + 1;
+    const key = year + "-" + month;
+    if (loaded.has(key)) {
+      return;
+    }
+    loaded.add(key);
+
+    try {
+      const response = await fetch("/rooms/" + roomID + "/availability.json?y=" + year + "&m=" + month);
+      const data = await response.json();
+      if (!data.ok) {
+        return;
+      }
+      data.unavailable.forEach((day) => unavailable.add(day));
+      pickers.forEach((p) => p.setOptions({ datesDisabled: Array.from(unavailable) }));
+    } catch (error) {
+      loaded.delete(key);
+      console.error("Error:", error);
+    }
+  };
+
+  // attach disables the unavailable days in picker, loading the month it shows and the next
+  let attach = function (picker, elem) {
+    pickers.set(elem, picker);
+    picker.setOptions({ datesDisabled: Array.from(unavailable) });
+
+    const now = new Date();
+    load(now);
+    load(new Date(now.getFullYear(), now.getMonth() + 1, 1));
+
+    elem.addEventListener("changeMonth", (e) => {
+      const viewDate = new Date(e.detail.viewDate);
+      load(viewDate);
+      load(new Date(viewDate.getFullYear(), viewDate.getMonth() + 1, 1));
+    });
+  };
+
+  return {
+    attach: attach,
+  };
+}